@@ -39,12 +39,6 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	// Watch for rising and falling edges
-	gpioEvents, err := gpioPin.WatchCh(gpio.RisingEdge | gpio.FallingEdge)
-	if err != nil {
-		log.Fatal(err)
-	}
-
 	encoding := decoder.IEEE
 	if *thomas {
 		encoding = decoder.Thomas
@@ -53,8 +47,8 @@ func main() {
 	log.Printf("GPIO Pin %d: %s", gpioPin.Number(), gpioPin.Info())
 	log.Printf("Listening on GPIO Pin %d", gpioPin.Number())
 
-	decoderEvents := make(chan decoder.Event, 1024)
-	dec, err := decoder.New(decoderEvents, *bitClock,
+	// The decoder watches the pin for rising and falling edges until it is closed.
+	dec, err := decoder.FromPin(gpioPin, *bitClock,
 		decoder.WithManchesterEncoding(encoding),
 		// comment out the next line to disable debug logging in the decoder
 		//	decoder.WithLogger(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))),
@@ -66,34 +60,7 @@ func main() {
 
 	log.Printf("decoder info: %s", dec.Info())
 
-	// --- Goroutine 1: GPIO → Decoder ---
-	go func() {
-		for {
-			select {
-			case evt, ok := <-gpioEvents:
-				if !ok {
-					return
-				}
-				var edge decoder.Edge
-				switch evt.Edge {
-				case gpio.RisingEdge:
-					edge = decoder.RisingEdge
-				case gpio.FallingEdge:
-					edge = decoder.FallingEdge
-				default:
-					continue
-				}
-				select {
-				case decoderEvents <- decoder.Event{Time: evt.Time, Edge: edge}:
-				default: // Wenn Decoder voll, verwerfen
-				}
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
-
-	// --- Goroutine 2: Bits → Bytes ---
+	// --- Goroutine: Bits → Bytes ---
 	go func() {
 		var b byte
 		var bitCount int
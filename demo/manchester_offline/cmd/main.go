@@ -0,0 +1,232 @@
+// Command manchester_offline renders Manchester-encoded messages to sample files and
+// decodes sample files captured with a logic analyzer or oscilloscope, without GPIO hardware.
+//
+// Supported formats are CSV (time,level), VCD and sigrok session files (.sr); the format
+// is derived from the file extension unless -format is given.
+//
+//	manchester_offline render -o hello.vcd -bitClock 50 "Hello World"
+//	manchester_offline decode -bitClock 50 -signal D0 capture.sr
+//
+// Without -bitClock the decoder discovers the clock from the first intervals of the
+// signal, which must be sync bytes: render the message with at least 3 sync bytes
+// (the default) for the default -samples 32.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/womat/golib/gpio"
+	"github.com/womat/golib/manchester/decoder"
+	"github.com/womat/golib/manchester/encoder"
+	"github.com/womat/golib/manchester/waveform"
+)
+
+// errUsage is returned for an unknown command.
+var errUsage = errors.New("usage: manchester_offline render|decode [flags] message|file")
+
+func main() {
+	err := run(os.Args[1:], os.Stdout)
+	switch {
+	case errors.Is(err, errUsage):
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(2)
+	case err != nil:
+		log.Fatal(err)
+	}
+}
+
+// run executes a command; decoded messages are written to stdout.
+func run(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "render":
+		return render(args[1:])
+	case "decode":
+		return decode(args[1:], stdout)
+	default:
+		return errUsage
+	}
+}
+
+// encodings returns the encoder and decoder tables of an encoding. The decoder names
+// its tables the other way round: the encoder's IEEE 802.3 table (a rising edge in the
+// middle of a 1 bit) is decoded by the decoder's Thomas table, and vice versa.
+func encodings(thomas bool) (encoder.ManchesterEncoding, decoder.ManchesterEncoding) {
+	if thomas {
+		return encoder.Thomas, decoder.IEEE
+	}
+	return encoder.IEEE, decoder.Thomas
+}
+
+// render encodes a message with ideal timing and writes the waveform to a file.
+func render(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	out := fs.String("o", "manchester.vcd", "output file (.csv, .vcd or .sr)")
+	format := fs.String("format", "", "output format: csv, vcd or sr (default: file extension)")
+	bitClock := fs.Int("bitClock", 50, "bit clock in Hz")
+	msb := fs.Bool("msb", false, "Use MSB instead of LSB")
+	thomas := fs.Bool("thomas", false, "use 'Differential Manchester/Thomas' encoding instead of IEEE 802.3")
+	sync := fs.Int("sync", 3, "number of sync bytes (0xff) to send before the message (decoding without -bitClock needs 3)")
+	sampleRate := fs.Int64("rate", 1_000_000, "sample rate in Hz (sigrok only)")
+	signal := fs.String("signal", "", "signal name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return errors.New("no message provided")
+	}
+
+	order := encoder.LSBFirst
+	if *msb {
+		order = encoder.MSBFirst
+	}
+	encoding, _ := encodings(*thomas)
+
+	rec := encoder.Render(*bitClock, []byte(fs.Arg(0)), time.Time{},
+		encoder.WithBitOrder(order),
+		encoder.WithSyncBytes(*sync),
+		encoder.WithManchesterEncoding(encoding),
+	)
+	samples := waveform.FromTransitions(rec.Transitions())
+
+	var buf bytes.Buffer
+	var err error
+	switch fileFormat(*out, *format) {
+	case "csv":
+		err = waveform.WriteCSV(&buf, samples)
+	case "vcd":
+		err = waveform.WriteVCD(&buf, samples, *signal)
+	case "sr":
+		err = waveform.WriteSigrok(&buf, samples, *sampleRate, *signal)
+	default:
+		return fmt.Errorf("unsupported format %q", fileFormat(*out, *format))
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(*out, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	log.Printf("rendered %d transitions (%v) to %s", len(samples), rec.End().Sub(time.Time{}), *out)
+	return nil
+}
+
+// decode reads a sample file, decodes the Manchester signal and prints the decoded bytes.
+func decode(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("decode", flag.ContinueOnError)
+	format := fs.String("format", "", "input format: csv, vcd or sr (default: file extension)")
+	bitClock := fs.Int("bitClock", 0, "bit clock in Hz (0 = discover the clock from the sync bytes)")
+	msb := fs.Bool("msb", false, "Use MSB instead of LSB")
+	thomas := fs.Bool("thomas", false, "use 'Differential Manchester/Thomas' encoding instead of IEEE 802.3")
+	invert := fs.Bool("invert", false, "invert the captured levels (e.g. behind an inverting input stage)")
+	signal := fs.String("signal", "", "signal (VCD) or channel (sigrok) name (default: first signal)")
+	threshold := fs.Float64("threshold", 0.5, "level threshold (CSV only), e.g. 1.65 for a 3.3V oscilloscope capture")
+	samplesClock := fs.Int("samples", 32, "number of intervals for clock discovery")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return errors.New("no file provided")
+	}
+	file := fs.Arg(0)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var samples []waveform.Sample
+	switch fileFormat(file, *format) {
+	case "csv":
+		samples, err = waveform.ReadCSV(bytes.NewReader(data), *threshold)
+	case "vcd":
+		samples, err = waveform.ReadVCD(bytes.NewReader(data), *signal)
+	case "sr":
+		samples, err = waveform.ReadSigrok(bytes.NewReader(data), int64(len(data)), *signal)
+	default:
+		return fmt.Errorf("unsupported format %q", fileFormat(file, *format))
+	}
+	if err != nil {
+		return err
+	}
+
+	if *invert {
+		for i := range samples {
+			samples[i].Level = gpio.High - samples[i].Level
+		}
+	}
+
+	_, encoding := encodings(*thomas)
+	bits, stats, err := decoder.DecodeEvents(waveform.Events(samples, time.Time{}), *bitClock,
+		decoder.WithManchesterEncoding(encoding),
+		decoder.WithClockSamples(*samplesClock),
+	)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, string(frames(bits, *msb)))
+	log.Printf("%d samples, %d valid bits, %d invalid bits, frequency %.2f Hz",
+		len(samples), stats.ValidBits, stats.InvalidBits, stats.Frequency)
+	return nil
+}
+
+// frames assembles bytes framed by a start bit (0) and a stop bit (1) from the decoded bits.
+func frames(bits []decoder.Bit, msb bool) []byte {
+	var out []byte
+	var b byte
+	var bitCount int
+
+	for _, bit := range bits {
+		if bit == decoder.Invalid {
+			b, bitCount = 0, 0
+			continue
+		}
+
+		switch bitCount {
+		case 0: // Startbit = 0
+			if bit == decoder.Low {
+				b = 0
+				bitCount++
+			}
+		case 9: // Stopbit = 1
+			if bit == decoder.High {
+				out = append(out, b)
+			}
+			b, bitCount = 0, 0
+		default:
+			if msb {
+				b |= byte(bit) << (8 - bitCount)
+			} else {
+				b |= byte(bit) << (bitCount - 1)
+			}
+			bitCount++
+		}
+	}
+	return out
+}
+
+// fileFormat returns the explicit format or derives it from the file extension.
+func fileFormat(file, format string) string {
+	if format != "" {
+		return strings.ToLower(format)
+	}
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(file)), ".")
+}
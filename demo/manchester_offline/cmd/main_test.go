@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenderDecode(t *testing.T) {
+	w := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(w)
+
+	const msg = "Hello World"
+	tests := []struct {
+		name   string
+		file   string
+		render []string
+		decode []string
+	}{
+		{"vcd", "h.vcd", []string{"-bitClock", "50", "-sync", "2"}, []string{"-bitClock", "50"}},
+		{"csv", "h.csv", nil, []string{"-bitClock", "50"}},
+		{"sigrok", "h.sr", nil, []string{"-bitClock", "50"}},
+		{"thomas", "h.vcd", []string{"-thomas"}, []string{"-thomas", "-bitClock", "50"}},
+		{"msb", "h.vcd", []string{"-msb", "-bitClock", "100"}, []string{"-msb", "-bitClock", "100"}},
+		{"discover clock", "h.vcd", nil, nil},
+		{"discover clock thomas", "h.vcd", []string{"-thomas"}, []string{"-thomas"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), tt.file)
+
+			args := append(append([]string{"render", "-o", file}, tt.render...), msg)
+			if err := run(args, io.Discard); err != nil {
+				t.Fatalf("render error = %v", err)
+			}
+
+			var out bytes.Buffer
+			args = append(append([]string{"decode"}, tt.decode...), file)
+			if err := run(args, &out); err != nil {
+				t.Fatalf("decode error = %v", err)
+			}
+			if got := out.String(); got != msg+"\n" {
+				t.Errorf("decoded %q, want %q", got, msg+"\n")
+			}
+		})
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	w := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(w)
+
+	for _, args := range [][]string{nil, {"play"}} {
+		if err := run(args, io.Discard); !errors.Is(err, errUsage) {
+			t.Errorf("run(%q) error = %v, want %v", args, err, errUsage)
+		}
+	}
+	if err := run([]string{"decode", filepath.Join(t.TempDir(), "missing.vcd")}, io.Discard); err == nil {
+		t.Error("decode of a missing file: expected error")
+	}
+	if err := run([]string{"render", "-o", filepath.Join(t.TempDir(), "h.txt"), "x"}, io.Discard); err == nil {
+		t.Error("render to an unsupported format: expected error")
+	}
+}
@@ -0,0 +1,7 @@
+module github.com/womat/golib/demo/manchester_offline
+
+go 1.26
+
+require github.com/womat/golib v1.0.4
+
+replace github.com/womat/golib => ../..
@@ -24,6 +24,7 @@ func main() {
 	msb := flag.Bool("msb", false, "Use MSB instead of LSB")
 	thomas := flag.Bool("thomas", false, "use 'Differential Manchester/Thomas' encoding instead of IEEE 802.3")
 	sync := flag.Int("sync", 1, "number of sync bytes (0xff) to send before the message")
+	precise := flag.Bool("precise", false, "use the precise (deadline based) timing engine")
 	flag.Parse()
 
 	if flag.NArg() == 0 {
@@ -41,10 +42,6 @@ func main() {
 
 	log.Printf("GPIO Pin %d: %s", gpioPin.Number(), gpioPin.Info())
 
-	setValue := func(level encoder.Level) error {
-		return gpioPin.SetValue(gpio.Level(level))
-	}
-
 	order := encoder.LSBFirst
 	if *msb {
 		order = encoder.MSBFirst
@@ -54,13 +51,18 @@ func main() {
 		encoding = encoder.Thomas
 	}
 
-	enc := encoder.New(*bitClock, setValue,
+	opts := []encoder.Option{
 		encoder.WithBitOrder(order),
 		encoder.WithSyncBytes(*sync),
 		encoder.WithManchesterEncoding(encoding),
 		// comment out the next line to disable debug logging in the encoder
 		encoder.WithErrorHandler(func(err error) { slog.Error("encoder GPIO error", "error", err) }),
-	)
+	}
+	if *precise {
+		opts = append(opts, encoder.WithPreciseTiming(-1))
+	}
+
+	enc := encoder.ToPin(gpioPin, *bitClock, opts...)
 
 	defer enc.Close()
 	_, err = enc.Send(msg)
@@ -71,4 +73,10 @@ func main() {
 	// Warten, bis alles gesendet wurde
 	enc.Wait()
 	log.Println("Message sent!")
+
+	if *precise {
+		stats := enc.TimingStats()
+		log.Printf("timing: %d transitions, mean error %v, max error %v, overruns %d",
+			stats.Transitions, stats.MeanError, stats.MaxError, stats.Overruns)
+	}
 }
@@ -3,6 +3,7 @@ module github.com/womat/golib
 go 1.25.0
 
 require (
+	github.com/eclipse/paho.golang v0.23.0
 	github.com/eclipse/paho.mqtt.golang v1.5.1
 	github.com/golang-jwt/jwt/v5 v5.3.1
 	github.com/mikesmitty/edkey v0.0.0-20170222072505-3356ea4e686a
@@ -0,0 +1,204 @@
+// Package linecode provides the shared plumbing for line codes other than Manchester,
+// such as a software UART (package uart), pulse-distance and pulse-width codes of
+// 433 MHz remotes (package pulse) and the NEC infrared protocol (package nec).
+//
+// All line codes follow the architecture of the manchester packages:
+//   - Decoders receive edge events (decoder.Event) on a channel, e.g. translated from
+//     a gpio.Pin with decoder.FromGPIOEvent, and deliver decoded values on a channel.
+//   - Encoders drive an output via a SetValue function (encoder.SetValue), e.g.
+//     encoder.PinSetValue(pin), and transmit in the background.
+//
+// An encoder describes its output as a train of Pulses (a level held for a duration),
+// which is played by a Transmitter with drift-free absolute deadlines, or converted to
+// ideal edge events with Events for offline rendering and testing.
+package linecode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/womat/golib/manchester/decoder"
+	"github.com/womat/golib/manchester/encoder"
+)
+
+// Event is an edge event as delivered to the manchester decoder.
+type Event = decoder.Event
+
+// Edge represents a line state change (RisingEdge or FallingEdge).
+type Edge = decoder.Edge
+
+// SetValue is a function that sets the output level, as used by the manchester encoder.
+type SetValue = encoder.SetValue
+
+// Level represents an output level (Low or High).
+type Level = encoder.Level
+
+const (
+	FallingEdge = decoder.FallingEdge // FallingEdge represents a high → low transition
+	RisingEdge  = decoder.RisingEdge  // RisingEdge represents a low → high transition
+
+	Low  = encoder.Low  // Low represents a low signal level.
+	High = encoder.High // High represents a high signal level.
+)
+
+var ErrTransmitterStopped = errors.New("transmitter stopped")
+
+// Pulse is an output level held for a duration.
+type Pulse struct {
+	Level    Level
+	Duration time.Duration
+}
+
+// Events converts a pulse train into ideal edge events starting at start.
+// initial is the line level before the first pulse; consecutive pulses with the
+// same level do not produce an edge.
+func Events(pulses []Pulse, start time.Time, initial Level) []Event {
+	var events []Event
+	level := initial
+	t := start
+	for _, p := range pulses {
+		if p.Level != level {
+			edge := FallingEdge
+			if p.Level == High {
+				edge = RisingEdge
+			}
+			events = append(events, Event{Time: t, Edge: edge})
+			level = p.Level
+		}
+		t = t.Add(p.Duration)
+	}
+	return events
+}
+
+// Invert returns a copy of the pulse train with inverted levels, e.g. for active-low outputs.
+func Invert(pulses []Pulse) []Pulse {
+	out := make([]Pulse, len(pulses))
+	for i, p := range pulses {
+		out[i] = Pulse{Level: High - p.Level, Duration: p.Duration}
+	}
+	return out
+}
+
+// Transmitter plays pulse trains on a SetValue function in a background goroutine.
+// Every level change is scheduled against an absolute deadline relative to the start
+// of the pulse train, so scheduling latency does not accumulate over a message.
+type Transmitter struct {
+	setValue SetValue
+	idle     Level
+	onError  func(err error)
+
+	writeMutex sync.Mutex // Mutex to synchronize Send() access
+	buffer     chan []Pulse
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup // tracks the transmitter goroutine
+	wgPulses   sync.WaitGroup // tracks queued pulse trains
+	closeOnce  sync.Once
+}
+
+// NewTransmitter creates a Transmitter that sets the idle level immediately and after
+// every pulse train. onError is called on SetValue errors and may be nil.
+func NewTransmitter(setValue SetValue, idle Level, bufferSize int, onError func(err error)) *Transmitter {
+	if bufferSize <= 0 {
+		bufferSize = 1
+	}
+	t := &Transmitter{
+		setValue: setValue,
+		idle:     idle,
+		onError:  onError,
+		buffer:   make(chan []Pulse, bufferSize),
+	}
+	t.set(idle)
+
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	t.wg.Add(1)
+	go t.run()
+	return t
+}
+
+// Send queues a pulse train. It blocks while the buffer is full and returns
+// ErrTransmitterStopped if Close() was called.
+func (t *Transmitter) Send(pulses []Pulse) error {
+	t.writeMutex.Lock()
+	defer t.writeMutex.Unlock()
+
+	// Close() cancels the context before it closes the buffer while holding writeMutex.
+	if t.ctx.Err() != nil {
+		return ErrTransmitterStopped
+	}
+
+	// Add before the send, otherwise run() may call Done() first and Wait() returns too early.
+	t.wgPulses.Add(1)
+	select {
+	case t.buffer <- pulses:
+		return nil
+	case <-t.ctx.Done():
+		t.wgPulses.Done()
+		return ErrTransmitterStopped
+	}
+}
+
+// Wait waits until all queued pulse trains have been transmitted.
+func (t *Transmitter) Wait() {
+	t.wgPulses.Wait()
+}
+
+// Close stops the transmitter; queued pulse trains are discarded.
+// It is safe to call Close multiple times.
+func (t *Transmitter) Close() error {
+	t.closeOnce.Do(func() {
+		t.cancel()
+
+		t.writeMutex.Lock()
+		close(t.buffer)
+		t.writeMutex.Unlock()
+
+		t.wg.Wait()
+	})
+	return nil
+}
+
+// run transmits the queued pulse trains until the transmitter is closed.
+func (t *Transmitter) run() {
+	defer t.wg.Done()
+
+	for pulses := range t.buffer {
+		if t.ctx.Err() == nil {
+			t.play(pulses)
+			t.set(t.idle)
+		}
+		t.wgPulses.Done()
+	}
+}
+
+// play sets the levels of the pulse train at their deadlines.
+func (t *Transmitter) play(pulses []Pulse) {
+	deadline := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	for _, p := range pulses {
+		t.set(p.Level)
+		deadline = deadline.Add(p.Duration)
+
+		if d := time.Until(deadline); d > 0 {
+			timer.Reset(d)
+			select {
+			case <-t.ctx.Done():
+				return
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// set sets the output level and reports errors to the error handler.
+func (t *Transmitter) set(level Level) {
+	if err := t.setValue(level); err != nil && t.onError != nil {
+		t.onError(fmt.Errorf("failed to set GPIO level: %w", err))
+	}
+}
@@ -0,0 +1,202 @@
+// Package nec implements the NEC infrared remote control protocol on top of package pulse.
+//
+// A NEC frame starts with a 9ms mark and a 4.5ms space, followed by 32 bits LSB first
+// (address, inverted address, command, inverted command) and a trailer mark. Extended
+// NEC replaces the inverted address by the high byte of a 16-bit address. While a key
+// is held, the remote sends repeat frames (9ms mark, 2.25ms space, trailer mark).
+//
+// The marks are the bursts of the 38kHz carrier. IR receiver modules (e.g. TSOP38238)
+// demodulate the carrier and output an active-low signal, so use pulse.WithInverted()
+// for the decoder:
+//
+//	dec, err := nec.NewDecoder(events, pulse.WithInverted())
+//	...
+//	for msg := range dec.Messages() {
+//		fmt.Println(msg.Address, msg.Command, msg.Repeat)
+//	}
+package nec
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/womat/golib/linecode"
+	"github.com/womat/golib/linecode/pulse"
+)
+
+// unit is the NEC base period of 562.5µs.
+const unit = 562500 * time.Nanosecond
+
+// Code is the pulse code of the NEC protocol.
+var Code = pulse.Code{
+	HeaderMark:  16 * unit,
+	HeaderSpace: 8 * unit,
+	RepeatSpace: 4 * unit,
+	ZeroMark:    unit,
+	ZeroSpace:   unit,
+	OneMark:     unit,
+	OneSpace:    3 * unit,
+	TrailerMark: unit,
+	Gap:         40 * time.Millisecond,
+	Bits:        32,
+}
+
+// Message is a NEC command.
+type Message struct {
+	Address  uint16    // 8-bit address, or 16-bit address if Extended is set
+	Command  uint8     // Command code
+	Extended bool      // Extended NEC with 16-bit address
+	Repeat   bool      // Repeat frame of the last message (key held)
+	Time     time.Time // Time of the first edge of the frame
+}
+
+// Encode returns the 32 data bits of a message.
+// Addresses above 255 are always encoded as extended NEC.
+func Encode(m Message) uint64 {
+	address := uint64(m.Address)
+	if !m.Extended && m.Address <= 0xff {
+		address = uint64(m.Address&0xff) | uint64(^uint8(m.Address))<<8
+	}
+	return address | uint64(m.Command)<<16 | uint64(^m.Command)<<24
+}
+
+// Parse decodes the 32 data bits of a frame. The inverted address byte is checked
+// to detect extended NEC; the inverted command byte must always match.
+func Parse(data uint64) (Message, error) {
+	command := uint8(data >> 16)
+	if ^command != uint8(data>>24) {
+		return Message{}, fmt.Errorf("invalid command checksum: %#08x", data)
+	}
+
+	m := Message{Address: uint16(data), Command: command}
+	if ^uint8(data) == uint8(data>>8) {
+		m.Address &= 0xff
+	} else {
+		m.Extended = true
+	}
+	return m, nil
+}
+
+// Encoder transmits NEC messages in the background.
+type Encoder struct {
+	enc *pulse.Encoder
+}
+
+// NewEncoder creates a new NEC encoder. The output is set to the idle level immediately.
+// The output is the envelope of the carrier; drive an IR LED via a modulating circuit
+// or invert it with pulse.WithInverted() for active-low transmitters.
+func NewEncoder(setValue linecode.SetValue, opts ...pulse.Option) (*Encoder, error) {
+	enc, err := pulse.NewEncoder(Code, setValue, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Encoder{enc: enc}, nil
+}
+
+// Send queues a message. If m.Repeat is set, a repeat frame is sent instead.
+func (e *Encoder) Send(m Message) error {
+	if m.Repeat {
+		return e.enc.SendRepeat()
+	}
+	return e.enc.Send(Encode(m))
+}
+
+// Wait waits until all queued messages have been transmitted.
+func (e *Encoder) Wait() {
+	e.enc.Wait()
+}
+
+// Close gracefully shuts down the encoder.
+// It is safe to call Close multiple times.
+func (e *Encoder) Close() error {
+	return e.enc.Close()
+}
+
+// Decoder decodes NEC messages from edge events in the background.
+// Repeat frames are delivered as a copy of the last message with Repeat set;
+// repeat frames without a preceding message are ignored.
+type Decoder struct {
+	dec *pulse.Decoder
+	c   chan Message
+
+	invalidFrames   atomic.Uint64
+	bufferOverflows atomic.Uint64
+
+	wg sync.WaitGroup
+}
+
+// Stats contains the counters of a Decoder.
+type Stats struct {
+	pulse.Stats
+	InvalidFrames uint64 // Number of frames with an invalid checksum
+}
+
+// NewDecoder creates a new NEC decoder and starts the decoding goroutine.
+// Call Close() to stop the decoder and wait for a clean shutdown.
+func NewDecoder(c <-chan linecode.Event, opts ...pulse.Option) (*Decoder, error) {
+	dec, err := pulse.NewDecoder(c, Code, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Decoder{dec: dec, c: make(chan Message, cap(dec.Frames()))}
+	d.wg.Add(1)
+	go d.run()
+	return d, nil
+}
+
+// Messages returns a read-only channel on which decoded messages are delivered.
+// The channel is closed when the decoder has shut down.
+func (d *Decoder) Messages() <-chan Message {
+	return d.c
+}
+
+// Stats returns the decoder counters. It is safe to call from another goroutine.
+func (d *Decoder) Stats() Stats {
+	s := Stats{Stats: d.dec.Stats(), InvalidFrames: d.invalidFrames.Load()}
+	s.BufferOverflows += d.bufferOverflows.Load()
+	return s
+}
+
+// Close stops the decoder and waits for the goroutine to finish.
+func (d *Decoder) Close() error {
+	err := d.dec.Close()
+	d.wg.Wait()
+	return err
+}
+
+// run converts frames to messages until the pulse decoder has shut down.
+func (d *Decoder) run() {
+	defer func() {
+		close(d.c)
+		d.wg.Done()
+	}()
+
+	var last *Message
+	for f := range d.dec.Frames() {
+		var m Message
+		switch {
+		case f.Repeat && last == nil:
+			continue
+		case f.Repeat:
+			m = *last
+			m.Repeat = true
+		default:
+			var err error
+			if m, err = Parse(f.Data); err != nil {
+				d.invalidFrames.Add(1)
+				continue
+			}
+			last = &m
+		}
+		m.Time = f.Time
+
+		select {
+		case d.c <- m:
+		default:
+			d.bufferOverflows.Add(1)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package nec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/womat/golib/linecode"
+	"github.com/womat/golib/linecode/pulse"
+)
+
+func TestEncodeParse(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+		data uint64
+	}{
+		{name: "standard", msg: Message{Address: 0x04, Command: 0x08}, data: 0xf708fb04},
+		{name: "extended", msg: Message{Address: 0x1234, Command: 0x56, Extended: true}, data: 0xa9561234},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Encode(tt.msg); got != tt.data {
+				t.Errorf("Encode: got %#08x, want %#08x", got, tt.data)
+			}
+			got, err := Parse(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.msg {
+				t.Errorf("Parse: got %+v, want %+v", got, tt.msg)
+			}
+		})
+	}
+
+	if _, err := Parse(0xf709fb04); err == nil {
+		t.Error("expected checksum error")
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	msg := Message{Address: 0x00, Command: 0x45}
+
+	var pulses []linecode.Pulse
+	pulses = append(pulses, Code.EncodeRepeat()...) // no preceding message, ignored
+	pulses = append(pulses, Code.Encode(Encode(msg))...)
+	pulses = append(pulses, Code.EncodeRepeat()...)
+	pulses = append(pulses, Code.EncodeRepeat()...)
+	pulses = append(pulses, Code.Encode(0xf709fb04)...) // invalid checksum
+
+	// IR receiver modules are active-low
+	events := linecode.Events(linecode.Invert(pulses), time.Unix(0, 0), linecode.High)
+	c := make(chan linecode.Event, len(events))
+	for _, evt := range events {
+		c <- evt
+	}
+	close(c)
+
+	d, err := NewDecoder(c, pulse.WithInverted())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Message
+	for m := range d.Messages() {
+		got = append(got, m)
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("got %d messages, want 3: %+v", len(got), got)
+	}
+	for i, m := range got {
+		if m.Address != msg.Address || m.Command != msg.Command || m.Repeat != (i > 0) {
+			t.Errorf("message %d: got %+v", i, m)
+		}
+	}
+	if !got[1].Time.After(got[0].Time) {
+		t.Errorf("repeat time %v not after message time %v", got[1].Time, got[0].Time)
+	}
+
+	stats := d.Stats()
+	if stats.Frames != 2 || stats.Repeats != 3 || stats.InvalidFrames != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
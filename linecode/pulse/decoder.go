@@ -0,0 +1,299 @@
+package pulse
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/womat/golib/linecode"
+)
+
+// Stats contains the counters of a Decoder.
+type Stats struct {
+	Frames          uint64 // Number of decoded data frames
+	Repeats         uint64 // Number of decoded repeat frames
+	Errors          uint64 // Number of frames aborted due to an unexpected mark or space
+	BufferOverflows uint64 // Number of frames dropped because the Frames() channel was full
+}
+
+// decoder states
+const (
+	waitHeader  = iota // waiting for the header mark (or the first bit mark without header)
+	waitSpace          // header mark received, waiting for the header or repeat space
+	waitMark           // waiting for the mark of the next bit
+	waitBit            // bit mark received, waiting for its space
+	waitTrailer        // all bits received, waiting for the trailer mark
+)
+
+// Decoder decodes frames of a pulse code from edge events in the background.
+//
+// The durations between edges are classified as marks and spaces of the Code.
+// A frame is delivered at the end of its trailer mark, or at the end of the last
+// bit mark for pulse-width codes without trailer. Any unexpected duration aborts
+// the frame and the decoder waits for the next header.
+type Decoder struct {
+	config
+	code Code
+
+	level  linecode.Level // Current line level
+	last   time.Time      // Time of the last edge
+	state  int
+	repeat bool          // Receiving a repeat frame
+	start  time.Time     // Time of the first edge of the frame
+	mark   time.Duration // Mark of the current bit
+	bits   int           // Number of received bits
+	data   uint64        // Received bits
+
+	frames          atomic.Uint64
+	repeats         atomic.Uint64
+	errors          atomic.Uint64
+	bufferOverflows atomic.Uint64
+
+	eventC <-chan linecode.Event // Input channel for edge events
+	c      chan Frame            // Output channel for decoded frames
+
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+}
+
+// NewDecoder creates a new decoder for the given code and starts the decoding goroutine.
+// Call Close() to stop the decoder and wait for a clean shutdown.
+func NewDecoder(c <-chan linecode.Event, code Code, opts ...Option) (*Decoder, error) {
+	cfg, err := newConfig(code, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Decoder{
+		config: cfg,
+		code:   code,
+		eventC: c,
+		c:      make(chan Frame, cfg.bufferSize),
+	}
+	d.level = d.idleLevel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.wg.Add(1)
+	go d.listenForEvents(ctx)
+	return d, nil
+}
+
+// Frames returns a read-only channel on which decoded frames are delivered.
+// The channel is closed when the decoder has shut down.
+func (d *Decoder) Frames() <-chan Frame {
+	return d.c
+}
+
+// Stats returns the decoder counters. It is safe to call from another goroutine.
+func (d *Decoder) Stats() Stats {
+	return Stats{
+		Frames:          d.frames.Load(),
+		Repeats:         d.repeats.Load(),
+		Errors:          d.errors.Load(),
+		BufferOverflows: d.bufferOverflows.Load(),
+	}
+}
+
+// Close stops the decoder and waits for the goroutine to finish.
+func (d *Decoder) Close() error {
+	d.cancel()
+	d.wg.Wait()
+	return nil
+}
+
+// markLevel returns the active line level.
+func (d *Decoder) markLevel() linecode.Level {
+	if d.inverted {
+		return linecode.Low
+	}
+	return linecode.High
+}
+
+// idleLevel returns the level of the idle line.
+func (d *Decoder) idleLevel() linecode.Level {
+	return linecode.High - d.markLevel()
+}
+
+// within reports whether the duration matches ref within the configured tolerance.
+func (d *Decoder) within(duration, ref time.Duration) bool {
+	diff := duration - ref
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= ref*time.Duration(d.tolerance)/100
+}
+
+// eventHandler processes a single edge event.
+func (d *Decoder) eventHandler(evt linecode.Event) {
+	level := linecode.Low
+	if evt.Edge == linecode.RisingEdge {
+		level = linecode.High
+	}
+
+	if level == d.level {
+		// a missed edge, the durations are meaningless
+		d.abort()
+	} else if !d.last.IsZero() {
+		duration := evt.Time.Sub(d.last)
+		if d.level == d.markLevel() {
+			d.handleMark(duration)
+		} else {
+			d.handleSpace(duration)
+		}
+	}
+
+	if d.state == waitHeader && level == d.markLevel() {
+		d.start = evt.Time
+	}
+	d.level = level
+	d.last = evt.Time
+}
+
+// handleMark processes a mark that ended.
+func (d *Decoder) handleMark(duration time.Duration) {
+	c := d.code
+	switch d.state {
+	case waitHeader:
+		if c.HeaderMark > 0 {
+			if d.within(duration, c.HeaderMark) {
+				d.state = waitSpace
+			}
+			return
+		}
+		d.state = waitMark
+		d.handleMark(duration)
+
+	case waitMark:
+		d.mark = duration
+		d.state = waitBit
+
+		// pulse-width codes without trailer: the space of the last bit merges with the idle line
+		if d.bits == c.Bits-1 && c.TrailerMark == 0 {
+			switch {
+			case d.within(duration, c.OneMark):
+				d.addBit(1)
+			case d.within(duration, c.ZeroMark):
+				d.addBit(0)
+			default:
+				d.abort()
+				return
+			}
+			d.deliver()
+		}
+
+	case waitTrailer:
+		if !d.within(duration, c.TrailerMark) {
+			d.abort()
+			return
+		}
+		d.deliver()
+
+	default:
+		d.abort()
+	}
+}
+
+// handleSpace processes a space that ended.
+func (d *Decoder) handleSpace(duration time.Duration) {
+	c := d.code
+	switch d.state {
+	case waitHeader:
+		// idle line
+
+	case waitSpace:
+		switch {
+		case d.within(duration, c.HeaderSpace):
+			d.state = waitMark
+		case c.RepeatSpace > 0 && d.within(duration, c.RepeatSpace):
+			d.repeat = true
+			d.state = waitTrailer
+		default:
+			d.abort()
+		}
+
+	case waitBit:
+		switch {
+		case d.within(d.mark, c.OneMark) && d.within(duration, c.OneSpace):
+			d.addBit(1)
+		case d.within(d.mark, c.ZeroMark) && d.within(duration, c.ZeroSpace):
+			d.addBit(0)
+		default:
+			d.abort()
+			return
+		}
+
+		d.state = waitMark
+		if d.bits == c.Bits {
+			d.state = waitTrailer
+		}
+
+	default:
+		d.abort()
+	}
+}
+
+// addBit appends a received bit to the frame data.
+func (d *Decoder) addBit(bit uint64) {
+	if d.code.MSBFirst {
+		d.data = d.data<<1 | bit
+	} else {
+		d.data |= bit << d.bits
+	}
+	d.bits++
+}
+
+// deliver sends the completed frame to the output channel and resets the decoder.
+func (d *Decoder) deliver() {
+	f := Frame{Data: d.data, Bits: d.bits, Repeat: d.repeat, Time: d.start}
+	if f.Repeat {
+		d.repeats.Add(1)
+	} else {
+		d.frames.Add(1)
+	}
+
+	select {
+	case d.c <- f:
+	default:
+		d.bufferOverflows.Add(1)
+	}
+	d.reset()
+}
+
+// abort discards a frame in progress.
+func (d *Decoder) abort() {
+	if d.state != waitHeader {
+		d.errors.Add(1)
+	}
+	d.reset()
+}
+
+// reset prepares the decoder for the next frame.
+func (d *Decoder) reset() {
+	d.state = waitHeader
+	d.repeat = false
+	d.bits = 0
+	d.data = 0
+}
+
+// listenForEvents listens for events from eventC and processes them asynchronously.
+func (d *Decoder) listenForEvents(ctx context.Context) {
+	defer func() {
+		close(d.c)
+		d.wg.Done()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-d.eventC:
+			if !ok {
+				// Exit if the buffer channel is closed
+				return
+			}
+			d.eventHandler(evt)
+		}
+	}
+}
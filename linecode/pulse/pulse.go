@@ -0,0 +1,255 @@
+// Package pulse implements pulse-distance and pulse-width line codes, as used by
+// 433 MHz remote controls and infrared remotes.
+//
+// Every bit consists of a mark (active level) followed by a space (idle level).
+// Pulse-distance codes encode the bit in the length of the space (e.g. NEC), pulse-width
+// codes in the length of the mark (e.g. EV1527). A frame may start with a header and
+// end with a trailer mark; the timing is described by a Code.
+//
+//	code := pulse.EV1527(350 * time.Microsecond)
+//	enc, err := pulse.NewEncoder(code, encoder.PinSetValue(pin))
+//	...
+//	err = enc.Send(0xa5c3f1)
+//
+//	dec, err := pulse.NewDecoder(events, code)
+//	for f := range dec.Frames() { ... }
+package pulse
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/womat/golib/linecode"
+)
+
+// Code describes the timing of a pulse-distance or pulse-width line code.
+type Code struct {
+	HeaderMark  time.Duration // Mark at the start of a frame (0 = no header)
+	HeaderSpace time.Duration // Space after the header mark
+	RepeatSpace time.Duration // Space after the header mark of a repeat frame (0 = no repeat frames)
+
+	ZeroMark  time.Duration // Mark of a 0 bit
+	ZeroSpace time.Duration // Space of a 0 bit
+	OneMark   time.Duration // Mark of a 1 bit
+	OneSpace  time.Duration // Space of a 1 bit
+
+	TrailerMark time.Duration // Mark after the last bit (0 = no trailer)
+	Gap         time.Duration // Minimum idle time after a frame (encoder only)
+
+	Bits     int  // Number of bits per frame (1..64)
+	MSBFirst bool // Transmit the most significant bit first
+}
+
+// Frame is a decoded frame.
+type Frame struct {
+	Data   uint64    // Data bits, the first received bit is the LSB unless MSBFirst is set
+	Bits   int       // Number of data bits
+	Repeat bool      // Repeat frame without data (see Code.RepeatSpace)
+	Time   time.Time // Time of the first edge of the frame
+}
+
+// EV1527 returns the pulse-width code of EV1527/PT2262-style 433 MHz remotes with
+// the base period t (typically 250..450µs): a sync of 1t mark and 31t space
+// followed by 24 bits MSB first; 0 is 1t mark and 3t space, 1 is 3t mark and 1t space.
+func EV1527(t time.Duration) Code {
+	return Code{
+		HeaderMark:  t,
+		HeaderSpace: 31 * t,
+		ZeroMark:    t,
+		ZeroSpace:   3 * t,
+		OneMark:     3 * t,
+		OneSpace:    t,
+		Bits:        24,
+		MSBFirst:    true,
+	}
+}
+
+// Validate checks that the code can be encoded and decoded unambiguously.
+func (c Code) Validate() error {
+	if c.Bits < 1 || c.Bits > 64 {
+		return fmt.Errorf("bits must be between 1 and 64: %v", c.Bits)
+	}
+	if c.ZeroMark <= 0 || c.ZeroSpace <= 0 || c.OneMark <= 0 || c.OneSpace <= 0 {
+		return fmt.Errorf("bit marks and spaces must be > 0")
+	}
+	if c.ZeroMark == c.OneMark && c.ZeroSpace == c.OneSpace {
+		return fmt.Errorf("0 and 1 bits must differ in mark or space")
+	}
+	if c.ZeroMark == c.OneMark && c.TrailerMark == 0 {
+		// the space of the last bit only ends with the next mark
+		return fmt.Errorf("pulse-distance codes require a trailer mark")
+	}
+	if (c.HeaderMark > 0) != (c.HeaderSpace > 0) {
+		return fmt.Errorf("header mark and space must both be set")
+	}
+	if c.RepeatSpace > 0 && c.HeaderMark == 0 {
+		return fmt.Errorf("repeat frames require a header")
+	}
+	return nil
+}
+
+// Encode returns the pulse train of a frame with the given data; the mark level is High.
+func (c Code) Encode(data uint64) []linecode.Pulse {
+	var pulses []linecode.Pulse
+	if c.HeaderMark > 0 {
+		pulses = append(pulses, mark(c.HeaderMark), space(c.HeaderSpace))
+	}
+
+	for i := 0; i < c.Bits; i++ {
+		n := i
+		if c.MSBFirst {
+			n = c.Bits - 1 - i
+		}
+		if (data>>n)&1 == 1 {
+			pulses = append(pulses, mark(c.OneMark), space(c.OneSpace))
+		} else {
+			pulses = append(pulses, mark(c.ZeroMark), space(c.ZeroSpace))
+		}
+	}
+
+	return c.finish(pulses)
+}
+
+// EncodeRepeat returns the pulse train of a repeat frame; the mark level is High.
+// It returns nil if the code has no repeat frames.
+func (c Code) EncodeRepeat() []linecode.Pulse {
+	if c.RepeatSpace == 0 {
+		return nil
+	}
+	return c.finish([]linecode.Pulse{mark(c.HeaderMark), space(c.RepeatSpace)})
+}
+
+// finish appends the trailer mark and the gap to a frame.
+func (c Code) finish(pulses []linecode.Pulse) []linecode.Pulse {
+	if c.TrailerMark > 0 {
+		pulses = append(pulses, mark(c.TrailerMark))
+	}
+	if c.Gap > 0 {
+		if last := &pulses[len(pulses)-1]; last.Level == linecode.Low {
+			last.Duration = max(last.Duration, c.Gap)
+		} else {
+			pulses = append(pulses, space(c.Gap))
+		}
+	}
+	return pulses
+}
+
+func mark(d time.Duration) linecode.Pulse  { return linecode.Pulse{Level: linecode.High, Duration: d} }
+func space(d time.Duration) linecode.Pulse { return linecode.Pulse{Level: linecode.Low, Duration: d} }
+
+// Option configures an Encoder or Decoder.
+type Option func(*config)
+
+// config holds the settings shared by Encoder and Decoder.
+type config struct {
+	inverted   bool            // Mark level is Low (e.g. active-low IR receiver output)
+	tolerance  int             // Percent tolerance for marks and spaces (default 25)
+	bufferSize int             // Size of the internal buffer channel (default 64)
+	onError    func(err error) // Optional error handler callback (Encoder only)
+}
+
+func newConfig(code Code, opts ...Option) (config, error) {
+	c := config{tolerance: 25, bufferSize: 64}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	if err := code.Validate(); err != nil {
+		return c, err
+	}
+	if c.tolerance <= 0 || c.tolerance >= 50 {
+		return c, fmt.Errorf("tolerance must be between 1 and 49 percent: %v", c.tolerance)
+	}
+	return c, nil
+}
+
+// WithInverted inverts the line levels: marks are Low and the idle line is High,
+// e.g. for the output of an IR receiver module (TSOP) or an active-low transmitter.
+func WithInverted() Option {
+	return func(c *config) {
+		c.inverted = true
+	}
+}
+
+// WithTolerance sets the accepted deviation of marks and spaces in percent (default 25).
+// Values outside 1..49 will be rejected with an error.
+func WithTolerance(percent int) Option {
+	return func(c *config) {
+		c.tolerance = percent
+	}
+}
+
+// WithBufferSize sets the size of the internal buffer channel.
+func WithBufferSize(size int) Option {
+	return func(c *config) {
+		if size > 0 {
+			c.bufferSize = size
+		}
+	}
+}
+
+// WithErrorHandler sets a callback that is called when a GPIO error occurs during transmission.
+// If not set, GPIO errors are silently ignored.
+func WithErrorHandler(fn func(err error)) Option {
+	return func(c *config) {
+		c.onError = fn
+	}
+}
+
+// Encoder transmits frames of a pulse code in the background.
+type Encoder struct {
+	code     Code
+	inverted bool
+	tx       *linecode.Transmitter
+}
+
+// NewEncoder creates a new Encoder for the given code. The output is set to the idle level immediately.
+func NewEncoder(code Code, setValue linecode.SetValue, opts ...Option) (*Encoder, error) {
+	c, err := newConfig(code, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	idle := linecode.Low
+	if c.inverted {
+		idle = linecode.High
+	}
+	return &Encoder{
+		code:     code,
+		inverted: c.inverted,
+		tx:       linecode.NewTransmitter(setValue, idle, c.bufferSize, c.onError),
+	}, nil
+}
+
+// Send queues a frame with the given data.
+// It blocks if the buffer is full and returns linecode.ErrTransmitterStopped if Close() was called.
+func (e *Encoder) Send(data uint64) error {
+	return e.send(e.code.Encode(data))
+}
+
+// SendRepeat queues a repeat frame. It returns an error if the code has no repeat frames.
+func (e *Encoder) SendRepeat() error {
+	pulses := e.code.EncodeRepeat()
+	if pulses == nil {
+		return fmt.Errorf("code has no repeat frames")
+	}
+	return e.send(pulses)
+}
+
+func (e *Encoder) send(pulses []linecode.Pulse) error {
+	if e.inverted {
+		pulses = linecode.Invert(pulses)
+	}
+	return e.tx.Send(pulses)
+}
+
+// Wait waits until all queued frames have been transmitted.
+func (e *Encoder) Wait() {
+	e.tx.Wait()
+}
+
+// Close gracefully shuts down the encoder.
+// It is safe to call Close multiple times.
+func (e *Encoder) Close() error {
+	return e.tx.Close()
+}
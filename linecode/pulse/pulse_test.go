@@ -0,0 +1,183 @@
+package pulse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/womat/golib/linecode"
+)
+
+// decode feeds the ideal edges of the pulse train to a decoder and returns the received frames.
+func decode(t *testing.T, pulses []linecode.Pulse, code Code, opts ...Option) ([]Frame, Stats) {
+	t.Helper()
+
+	c, err := newConfig(code, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idle := linecode.Low
+	if c.inverted {
+		idle = linecode.High
+		pulses = linecode.Invert(pulses)
+	}
+
+	events := linecode.Events(pulses, time.Unix(0, 0), idle)
+	ch := make(chan linecode.Event, len(events))
+	for _, evt := range events {
+		ch <- evt
+	}
+	close(ch)
+
+	d, err := NewDecoder(ch, code, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frames []Frame
+	for f := range d.Frames() {
+		frames = append(frames, f)
+	}
+	return frames, d.Stats()
+}
+
+// distance is a pulse-distance code with repeat frames, similar to NEC with 16 bits.
+var distance = Code{
+	HeaderMark:  4 * time.Millisecond,
+	HeaderSpace: 2 * time.Millisecond,
+	RepeatSpace: time.Millisecond,
+	ZeroMark:    250 * time.Microsecond,
+	ZeroSpace:   250 * time.Microsecond,
+	OneMark:     250 * time.Microsecond,
+	OneSpace:    750 * time.Microsecond,
+	TrailerMark: 250 * time.Microsecond,
+	Gap:         10 * time.Millisecond,
+	Bits:        16,
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		code Code
+		data []uint64
+		opts []Option
+	}{
+		{name: "EV1527", code: EV1527(350 * time.Microsecond), data: []uint64{0xa5c3f1, 0x000000, 0xffffff, 0x000001}},
+		{name: "pulse distance", code: distance, data: []uint64{0x1234, 0xffff, 0x0000, 0x8001}},
+		{name: "inverted", code: distance, data: []uint64{0xbeef}, opts: []Option{WithInverted()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pulses []linecode.Pulse
+			for _, data := range tt.data {
+				pulses = append(pulses, tt.code.Encode(data)...)
+			}
+
+			frames, stats := decode(t, pulses, tt.code, tt.opts...)
+			if len(frames) != len(tt.data) {
+				t.Fatalf("got %d frames, want %d (stats %+v)", len(frames), len(tt.data), stats)
+			}
+			for i, f := range frames {
+				if f.Data != tt.data[i] || f.Bits != tt.code.Bits || f.Repeat {
+					t.Errorf("frame %d: got %+v, want data %#x", i, f, tt.data[i])
+				}
+			}
+			if stats.Frames != uint64(len(tt.data)) || stats.Errors != 0 {
+				t.Errorf("unexpected stats: %+v", stats)
+			}
+		})
+	}
+}
+
+func TestRepeatAndErrors(t *testing.T) {
+	var pulses []linecode.Pulse
+	pulses = append(pulses, distance.Encode(0x00ff)...)
+	pulses = append(pulses, distance.EncodeRepeat()...)
+
+	// a frame with a bit space of 500µs, between 0 and 1
+	broken := distance.Encode(0x0001)
+	broken[3].Duration = 500 * time.Microsecond
+	pulses = append(pulses, broken...)
+	pulses = append(pulses, distance.Encode(0x0002)...)
+
+	frames, stats := decode(t, pulses, distance)
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames, want 3: %+v", len(frames), frames)
+	}
+	if frames[0].Data != 0x00ff || !frames[1].Repeat || frames[2].Data != 0x0002 {
+		t.Errorf("unexpected frames: %+v", frames)
+	}
+	if stats.Frames != 2 || stats.Repeats != 1 || stats.Errors != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	// the frame timestamps are the header mark edges
+	if want := time.Unix(0, 0); !frames[0].Time.Equal(want) {
+		t.Errorf("frame time: got %v, want %v", frames[0].Time, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		code func(c *Code)
+	}{
+		{name: "bits", code: func(c *Code) { c.Bits = 65 }},
+		{name: "zero space", code: func(c *Code) { c.ZeroSpace = 0 }},
+		{name: "same bits", code: func(c *Code) { c.OneSpace = c.ZeroSpace }},
+		{name: "no trailer", code: func(c *Code) { c.TrailerMark = 0 }},
+		{name: "header", code: func(c *Code) { c.HeaderSpace = 0 }},
+		{name: "repeat without header", code: func(c *Code) { c.HeaderMark, c.HeaderSpace = 0, 0 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := distance
+			tt.code(&code)
+			if err := code.Validate(); err == nil {
+				t.Error("expected error")
+			}
+			if _, err := NewDecoder(nil, code); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+
+	if _, err := NewDecoder(nil, distance, WithTolerance(50)); err == nil {
+		t.Error("expected tolerance error")
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	var levels []linecode.Level
+	setValue := func(l linecode.Level) error {
+		levels = append(levels, l)
+		return nil
+	}
+
+	code := Code{ZeroMark: time.Microsecond, ZeroSpace: 3 * time.Microsecond, OneMark: 3 * time.Microsecond, OneSpace: time.Microsecond, Bits: 2}
+	e, err := NewEncoder(code, setValue, WithInverted())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Send(0b01); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SendRepeat(); err == nil {
+		t.Error("expected error for code without repeat frames")
+	}
+	e.Wait()
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// idle, mark/space of bit 0 (1), mark/space of bit 1 (0), idle
+	want := []linecode.Level{1, 0, 1, 0, 1, 1}
+	if len(levels) != len(want) {
+		t.Fatalf("got levels %v, want %v", levels, want)
+	}
+	for i := range want {
+		if levels[i] != want[i] {
+			t.Fatalf("got levels %v, want %v", levels, want)
+		}
+	}
+}
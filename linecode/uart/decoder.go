@@ -0,0 +1,214 @@
+package uart
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/womat/golib/linecode"
+)
+
+// Stats contains the counters of a Decoder.
+type Stats struct {
+	Bytes           uint64 // Number of decoded bytes
+	FramingErrors   uint64 // Number of frames with an invalid start or stop bit
+	ParityErrors    uint64 // Number of frames with a wrong parity bit
+	BufferOverflows uint64 // Number of bytes dropped because the Bytes() channel was full
+}
+
+// edge is a level change within a frame.
+type edge struct {
+	time  time.Time
+	level linecode.Level // level after the edge
+}
+
+// Decoder decodes UART frames from edge events in the background.
+//
+// The line level at the center of each bit is derived from the edges of the frame.
+// A frame is decoded when the first edge after the center of its last stop bit
+// arrives, or when the line stays quiet for one more bit time, so the last byte
+// of a transmission is delivered without waiting for further edges.
+type Decoder struct {
+	config
+	bitTime time.Duration
+
+	level      linecode.Level // Current line level
+	inFrame    bool           // A start bit has been detected
+	frameStart time.Time      // Time of the start bit edge
+	edges      []edge         // Edges within the current frame
+
+	bytes           atomic.Uint64
+	framingErrors   atomic.Uint64
+	parityErrors    atomic.Uint64
+	bufferOverflows atomic.Uint64
+
+	eventC <-chan linecode.Event // Input channel for edge events
+	c      chan byte             // Output channel for decoded bytes
+
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+}
+
+// NewDecoder creates a new UART decoder with the given baud rate and starts the decoding goroutine.
+// Call Close() to stop the decoder and wait for a clean shutdown.
+func NewDecoder(c <-chan linecode.Event, baud int, opts ...Option) (*Decoder, error) {
+	cfg, err := newConfig(baud, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Decoder{
+		config:  cfg,
+		bitTime: time.Second / time.Duration(baud),
+		eventC:  c,
+		c:       make(chan byte, cfg.bufferSize),
+	}
+	d.level = d.idleLevel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.wg.Add(1)
+	go d.listenForEvents(ctx)
+	return d, nil
+}
+
+// Bytes returns a read-only channel on which decoded bytes are delivered.
+// The channel is closed when the decoder has shut down.
+func (d *Decoder) Bytes() <-chan byte {
+	return d.c
+}
+
+// Stats returns the decoder counters. It is safe to call from another goroutine.
+func (d *Decoder) Stats() Stats {
+	return Stats{
+		Bytes:           d.bytes.Load(),
+		FramingErrors:   d.framingErrors.Load(),
+		ParityErrors:    d.parityErrors.Load(),
+		BufferOverflows: d.bufferOverflows.Load(),
+	}
+}
+
+// Close stops the decoder and waits for the goroutine to finish.
+// A frame in progress is discarded.
+func (d *Decoder) Close() error {
+	d.cancel()
+	d.wg.Wait()
+	return nil
+}
+
+// idleLevel returns the level of the idle line (logical 1).
+func (d *Decoder) idleLevel() linecode.Level {
+	return d.config.level(1)
+}
+
+// frameDone returns the time after which a frame is complete: the center of the last stop bit.
+func (d *Decoder) frameDone() time.Time {
+	return d.frameStart.Add(time.Duration(2*d.frameBits()-1) * d.bitTime / 2)
+}
+
+// eventHandler processes a single edge event.
+func (d *Decoder) eventHandler(evt linecode.Event) {
+	if d.inFrame && !evt.Time.Before(d.frameDone()) {
+		d.decodeFrame()
+	}
+
+	level := linecode.Low
+	if evt.Edge == linecode.RisingEdge {
+		level = linecode.High
+	}
+
+	switch {
+	case d.inFrame:
+		d.edges = append(d.edges, edge{time: evt.Time, level: level})
+	case d.level == d.idleLevel() && level != d.idleLevel():
+		// start bit
+		d.inFrame = true
+		d.frameStart = evt.Time
+		d.edges = d.edges[:0]
+	}
+	d.level = level
+}
+
+// decodeFrame samples the bits of the current frame at their centers and delivers the byte.
+func (d *Decoder) decodeFrame() {
+	d.inFrame = false
+
+	bits := make([]byte, d.frameBits())
+	level := d.config.level(0) // level after the start bit edge
+	next := 0
+	for i := range bits {
+		center := d.frameStart.Add(time.Duration(2*i+1) * d.bitTime / 2)
+		for ; next < len(d.edges) && !d.edges[next].time.After(center); next++ {
+			level = d.edges[next].level
+		}
+		if level == d.config.level(1) {
+			bits[i] = 1
+		}
+	}
+
+	// start bit must still be 0 at its center (no glitch), stop bits must be 1
+	if bits[0] != 0 {
+		d.framingErrors.Add(1)
+		return
+	}
+	for _, bit := range bits[len(bits)-d.stopBits:] {
+		if bit != 1 {
+			d.framingErrors.Add(1)
+			return
+		}
+	}
+
+	var b byte
+	for i := 0; i < d.dataBits; i++ {
+		b |= bits[1+i] << i
+	}
+	if d.parity != NoParity && bits[1+d.dataBits] != d.parityBit(b) {
+		d.parityErrors.Add(1)
+		return
+	}
+
+	d.bytes.Add(1)
+	select {
+	case d.c <- b:
+	default:
+		d.bufferOverflows.Add(1)
+	}
+}
+
+// listenForEvents listens for events from eventC and processes them asynchronously.
+// If no edge follows within a bit time after the end of a frame, the frame is decoded.
+func (d *Decoder) listenForEvents(ctx context.Context) {
+	defer func() {
+		close(d.c)
+		d.wg.Done()
+	}()
+
+	idle := time.NewTimer(time.Hour)
+	defer idle.Stop()
+
+	for {
+		if d.inFrame {
+			idle.Reset(time.Until(d.frameDone()) + d.bitTime)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-d.eventC:
+			if !ok {
+				// Exit if the buffer channel is closed, a pending frame is complete.
+				if d.inFrame {
+					d.decodeFrame()
+				}
+				return
+			}
+			d.eventHandler(evt)
+		case <-idle.C:
+			// the line stayed quiet; pending events are processed first
+			if d.inFrame && len(d.eventC) == 0 {
+				d.decodeFrame()
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package uart
+
+import (
+	"time"
+
+	"github.com/womat/golib/linecode"
+)
+
+// Encoder transmits UART frames in the background.
+type Encoder struct {
+	config
+	bitTime time.Duration
+	tx      *linecode.Transmitter
+}
+
+// NewEncoder creates a new UART encoder with the given baud rate.
+// The output is set to the idle level immediately.
+func NewEncoder(baud int, setValue linecode.SetValue, opts ...Option) (*Encoder, error) {
+	c, err := newConfig(baud, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Encoder{
+		config:  c,
+		bitTime: time.Second / time.Duration(baud),
+		tx:      linecode.NewTransmitter(setValue, c.level(1), c.bufferSize, c.onError),
+	}, nil
+}
+
+// Send places data into the transmission buffer.
+// It blocks if the buffer is full and returns linecode.ErrTransmitterStopped if Close() was called.
+func (e *Encoder) Send(data []byte) (int, error) {
+	if err := e.tx.Send(e.encode(data, e.bitTime)); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Wait waits until all buffered data has been transmitted.
+func (e *Encoder) Wait() {
+	e.tx.Wait()
+}
+
+// Close gracefully shuts down the encoder.
+// It is safe to call Close multiple times.
+func (e *Encoder) Close() error {
+	return e.tx.Close()
+}
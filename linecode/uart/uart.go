@@ -0,0 +1,182 @@
+// Package uart implements a software UART: an asynchronous NRZ serial line with
+// configurable baud rate, data bits, parity and stop bits.
+//
+// A frame consists of a start bit (0), 5 to 8 data bits (LSB first), an optional
+// parity bit and 1 or 2 stop bits (1). The idle line is High (logical 1); use
+// WithInverted for lines behind an inverting level shifter.
+//
+//	enc, err := uart.NewEncoder(9600, encoder.PinSetValue(pin), uart.WithParity(uart.EvenParity))
+//	...
+//	dec, err := uart.NewDecoder(events, 9600, uart.WithParity(uart.EvenParity))
+//	for b := range dec.Bytes() { ... }
+package uart
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/womat/golib/linecode"
+)
+
+// Parity represents the parity mode of a frame.
+type Parity int
+
+const (
+	NoParity   Parity = iota // NoParity sends no parity bit
+	EvenParity               // EvenParity makes the number of 1 bits (data + parity) even
+	OddParity                // OddParity makes the number of 1 bits (data + parity) odd
+)
+
+// Option configures an Encoder or Decoder.
+type Option func(*config)
+
+// config holds the frame format shared by Encoder and Decoder.
+type config struct {
+	dataBits   int             // Number of data bits (5..8, default 8)
+	parity     Parity          // Parity mode (default NoParity)
+	stopBits   int             // Number of stop bits (1 or 2, default 1)
+	inverted   bool            // Idle line is Low instead of High
+	bufferSize int             // Size of the internal buffer channel (default 1024)
+	onError    func(err error) // Optional error handler callback (Encoder only)
+}
+
+func newConfig(baud int, opts ...Option) (config, error) {
+	c := config{
+		dataBits:   8,
+		parity:     NoParity,
+		stopBits:   1,
+		bufferSize: 1024,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	if baud <= 0 {
+		return c, fmt.Errorf("baud rate must be > 0: %v", baud)
+	}
+	if c.dataBits < 5 || c.dataBits > 8 {
+		return c, fmt.Errorf("data bits must be between 5 and 8: %v", c.dataBits)
+	}
+	if c.stopBits != 1 && c.stopBits != 2 {
+		return c, fmt.Errorf("stop bits must be 1 or 2: %v", c.stopBits)
+	}
+	switch c.parity {
+	case NoParity, EvenParity, OddParity:
+	default:
+		return c, fmt.Errorf("unsupported parity: %v", c.parity)
+	}
+	return c, nil
+}
+
+// WithDataBits sets the number of data bits per frame (5..8, default 8).
+// An invalid value will be rejected with an error.
+func WithDataBits(n int) Option {
+	return func(c *config) {
+		c.dataBits = n
+	}
+}
+
+// WithParity sets the parity mode (default NoParity).
+func WithParity(p Parity) Option {
+	return func(c *config) {
+		c.parity = p
+	}
+}
+
+// WithStopBits sets the number of stop bits (1 or 2, default 1).
+// An invalid value will be rejected with an error.
+func WithStopBits(n int) Option {
+	return func(c *config) {
+		c.stopBits = n
+	}
+}
+
+// WithInverted inverts the line levels: the idle line and logical 1 are Low.
+func WithInverted() Option {
+	return func(c *config) {
+		c.inverted = true
+	}
+}
+
+// WithBufferSize sets the size of the internal buffer channel.
+func WithBufferSize(size int) Option {
+	return func(c *config) {
+		if size > 0 {
+			c.bufferSize = size
+		}
+	}
+}
+
+// WithErrorHandler sets a callback that is called when a GPIO error occurs during transmission.
+// If not set, GPIO errors are silently ignored.
+func WithErrorHandler(fn func(err error)) Option {
+	return func(c *config) {
+		c.onError = fn
+	}
+}
+
+// Encode returns the pulse train of the frames for data at the given baud rate.
+func Encode(data []byte, baud int, opts ...Option) ([]linecode.Pulse, error) {
+	c, err := newConfig(baud, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return c.encode(data, time.Second/time.Duration(baud)), nil
+}
+
+// frameBits returns the number of bits of a frame including start, parity and stop bits.
+func (c config) frameBits() int {
+	n := 1 + c.dataBits + c.stopBits
+	if c.parity != NoParity {
+		n++
+	}
+	return n
+}
+
+// level returns the line level of a logical bit.
+func (c config) level(bit byte) linecode.Level {
+	if (bit == 1) != c.inverted {
+		return linecode.High
+	}
+	return linecode.Low
+}
+
+// parityBit returns the parity bit for the data bits of b.
+func (c config) parityBit(b byte) byte {
+	var ones byte
+	for i := 0; i < c.dataBits; i++ {
+		ones ^= (b >> i) & 1
+	}
+	if c.parity == OddParity {
+		return ones ^ 1
+	}
+	return ones
+}
+
+// encode returns the pulse train of the frames for data; consecutive bits with the
+// same level are merged into a single pulse.
+func (c config) encode(data []byte, bitTime time.Duration) []linecode.Pulse {
+	var pulses []linecode.Pulse
+	add := func(bit byte) {
+		level := c.level(bit)
+		if n := len(pulses); n > 0 && pulses[n-1].Level == level {
+			pulses[n-1].Duration += bitTime
+			return
+		}
+		pulses = append(pulses, linecode.Pulse{Level: level, Duration: bitTime})
+	}
+
+	for _, b := range data {
+		add(0) // start bit
+		for i := 0; i < c.dataBits; i++ {
+			add((b >> i) & 1)
+		}
+		if c.parity != NoParity {
+			add(c.parityBit(b))
+		}
+		for i := 0; i < c.stopBits; i++ {
+			add(1) // stop bit
+		}
+	}
+	return pulses
+}
@@ -0,0 +1,145 @@
+package uart
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/womat/golib/linecode"
+)
+
+// decode feeds the ideal edges of the pulse train to a decoder and returns the received bytes.
+func decode(t *testing.T, pulses []linecode.Pulse, initial linecode.Level, baud int, opts ...Option) ([]byte, Stats) {
+	t.Helper()
+
+	events := linecode.Events(pulses, time.Unix(0, 0), initial)
+	c := make(chan linecode.Event, len(events))
+	for _, evt := range events {
+		c <- evt
+	}
+	close(c)
+
+	d, err := NewDecoder(c, baud, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	for b := range d.Bytes() {
+		got = append(got, b)
+	}
+	return got, d.Stats()
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := []byte{0x00, 0xff, 0x55, 0xaa, 0x0f, 0x80, 0x01}
+
+	tests := []struct {
+		name string
+		opts []Option
+		want []byte
+	}{
+		{name: "8N1", want: data},
+		{name: "8E1", opts: []Option{WithParity(EvenParity)}, want: data},
+		{name: "8O2", opts: []Option{WithParity(OddParity), WithStopBits(2)}, want: data},
+		{name: "7N1", opts: []Option{WithDataBits(7)}, want: []byte{0x00, 0x7f, 0x55, 0x2a, 0x0f, 0x00, 0x01}},
+		{name: "inverted", opts: []Option{WithInverted()}, want: data},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pulses, err := Encode(data, 9600, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, _ := newConfig(9600, tt.opts...)
+
+			got, stats := decode(t, pulses, c.level(1), 9600, tt.opts...)
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got %x, want %x", got, tt.want)
+			}
+			if stats.Bytes != uint64(len(tt.want)) || stats.FramingErrors != 0 || stats.ParityErrors != 0 {
+				t.Errorf("unexpected stats: %+v", stats)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	// parity mismatch: encoded with odd, decoded with even parity
+	pulses, err := Encode([]byte{0x01, 0x03}, 1200, WithParity(OddParity))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, stats := decode(t, pulses, linecode.High, 1200, WithParity(EvenParity))
+	if len(got) != 0 || stats.ParityErrors != 2 {
+		t.Errorf("got %x, stats %+v, want 2 parity errors", got, stats)
+	}
+
+	// 8 data bits received as 7: the MSB falls on the stop bit, a 0 is a framing error
+	pulses, err = Encode([]byte{0x01, 0x80}, 1200, WithStopBits(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, stats = decode(t, pulses, linecode.High, 1200, WithDataBits(7))
+	if !bytes.Equal(got, []byte{0x00}) || stats.FramingErrors != 1 {
+		t.Errorf("got %x, stats %+v, want 00 and 1 framing error", got, stats)
+	}
+}
+
+func TestNewValidatesOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		baud int
+		opts []Option
+	}{
+		{name: "baud", baud: 0},
+		{name: "data bits", baud: 9600, opts: []Option{WithDataBits(9)}},
+		{name: "stop bits", baud: 9600, opts: []Option{WithStopBits(3)}},
+		{name: "parity", baud: 9600, opts: []Option{WithParity(Parity(7))}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Encode([]byte{0}, tt.baud, tt.opts...); err == nil {
+				t.Error("expected error")
+			}
+			if _, err := NewDecoder(nil, tt.baud, tt.opts...); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	var levels []linecode.Level
+	setValue := func(l linecode.Level) error {
+		levels = append(levels, l)
+		return nil
+	}
+
+	e, err := NewEncoder(115200, setValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := e.Send([]byte{0x55}); n != 1 || err != nil {
+		t.Fatalf("Send: got %v, %v", n, err)
+	}
+	e.Wait()
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Send([]byte{0x55}); err != linecode.ErrTransmitterStopped {
+		t.Errorf("Send after Close: got %v, want %v", err, linecode.ErrTransmitterStopped)
+	}
+
+	// idle, start, 10101010 (LSB first), stop, idle
+	want := []linecode.Level{1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 1}
+	if len(levels) != len(want) {
+		t.Fatalf("got levels %v, want %v", levels, want)
+	}
+	for i := range want {
+		if levels[i] != want[i] {
+			t.Fatalf("got levels %v, want %v", levels, want)
+		}
+	}
+}
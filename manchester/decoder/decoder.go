@@ -13,18 +13,31 @@
 // Key Features:
 // - Asynchronous event handling using goroutines to keep the main process responsive.
 // - Clock synchronization phase to determine the bit timing based on incoming event samples.
+// - Configurable sample count, timing tolerance, resync threshold and accepted bit rate range.
 // - Robust bit decoding with tolerance handling to account for signal noise and timing deviations.
+// - Optional PLL-style clock tracking that follows slow drift of the transmitter's bit clock.
+// - Optional input mode for IR receiver modules that demodulate a carrier-modulated signal.
 // - Graceful shutdown mechanism to properly close channels and wait for background tasks to finish.
 //
 // Channels:
 //   - Bits(): Returns a read-only channel on which decoded bits (High/Low/Invalid) are delivered.
 //   - eventC: Receives GPIO events (rising and falling edges).
 //
+// Monitoring:
+//   - Stats(): Returns state, clock timing and counters; each value is read atomically on its own.
+//   - WithLinkEventHandler(): Notifies about clock lock, loss of lock and resynchronization.
+//
 // Lifecycle:
 //
 //	d, err := decoder.New(eventCh, 50, decoder.WithManchesterEncoding(decoder.IEEE))
 //	for bit := range d.Bits() { ... }
 //	d.Close() // stops the decoder and waits for clean shutdown
+//
+// To decode a gpio.Pin directly, use FromPin instead of New:
+//
+//	d, err := decoder.FromPin(pin, 50)
+//
+// To decode several lines in a single goroutine, use NewMux or MuxFromPins.
 package decoder
 
 import (
@@ -35,6 +48,8 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/womat/golib/gpio"
 )
 
 // Edge represents a line state change (RisingEdge or FallingEdge)
@@ -52,6 +67,30 @@ type Event struct {
 // ManchesterEncoding represents the type of Manchester encoding to use.
 type ManchesterEncoding int
 
+// State represents the current phase of the decoder.
+type State int32
+
+// LinkEvent represents a change of the link health reported via WithLinkEventHandler.
+type LinkEvent int
+
+// Stats is a snapshot of the decoder's state and counters.
+type Stats struct {
+	State       State         // Current decoder state
+	Frequency   float64       // Current bit clock in Hz (0 while discovering the clock)
+	HalfBitTime time.Duration // Current half-bit period (0 while discovering the clock)
+	FullBitTime time.Duration // Current full bit period (0 while discovering the clock)
+	Jitter      time.Duration // Smoothed timing error (only updated with clock tracking)
+
+	ValidBits       uint64 // Number of decoded High/Low bits
+	InvalidBits     uint64 // Number of Invalid bits caused by intervals outside the tolerance
+	BufferOverflows uint64 // Number of bits dropped because the Bits() channel was full
+	Resyncs         uint64 // Number of restarts of the clock discovery
+	Locks           uint64 // Number of successful clock discoveries
+	Unlocks         uint64 // Number of lost locks due to too many invalid intervals
+	DroppedEvents   uint64 // Number of edge events dropped by the GPIO pin (FromPin only)
+	Channel         int    // Channel id of the line (Mux only)
+}
+
 type Option func(*Decoder)
 
 const (
@@ -69,23 +108,40 @@ const (
 )
 
 const (
-	discoverClock = iota // Decoder state: clock discovery
-	decodeData           // Decoder state: data decoding
+	DiscoverClock State = iota // Decoder state: clock discovery
+	DecodeData                 // Decoder state: data decoding
+)
+
+const (
+	ClockLocked    LinkEvent = iota // Clock discovery succeeded, data decoding starts
+	ClockLost                       // Too many invalid intervals, the lock has been dropped
+	Resynchronized                  // Clock discovery has been restarted
+)
+
+const (
+	defaultClockEventSamples = 500 // Default number of samples for clock calculation
+	defaultBitTimeTolerance  = 25  // Default percent tolerance for half/full bit timing
+	defaultInvalidThreshold  = 20  // Default max consecutive invalid intervals before resync
 
-	clockEventSamples = 500 // Number of samples for clock calculation
-	bitTimeTolerance  = 25  // Percent tolerance for half/full bit timing
-	invalidThreshold  = 20  // Max consecutive invalid intervals before resync
+	minClockEventSamples = 8  // Minimum number of samples for a meaningful median analysis
+	maxBitTimeTolerance  = 33 // Above 33% the half and full bit windows overlap
 )
 
 // Decoder holds all state and channels for decoding Manchester signals
 type Decoder struct {
-	state int // Current state: clock discovery or data decoding
+	state atomic.Int32 // Current State: clock discovery or data decoding
 
 	clockEventSamples []time.Duration // Samples for clock discovery
 	lastTimestamp     time.Time       // Time of last event
 	receivedHalfBit   int             // Tracks first or second half of bit
 	bufferSize        int             // Size of the output bit buffer (default 1024)
 
+	clockSamples     int    // Number of samples for clock discovery (default 500)
+	tolerance        int    // Percent tolerance for half/full bit timing (default 25)
+	invalidThreshold uint64 // Max consecutive invalid intervals before resync (default 20)
+	minBitRate       int    // Minimum accepted bit rate in Hz (0 = no limit)
+	maxBitRate       int    // Maximum accepted bit rate in Hz (0 = no limit)
+
 	manchesterEncoding ManchesterEncoding // Type of Manchester encoding (e.g., IEEE vs. Thomas)
 	decodingTable      [2]Bit             // Manchester decoding lookup table: [Level][Bit]
 
@@ -95,11 +151,27 @@ type Decoder struct {
 	halfBitTimeTolerance time.Duration // Half-bit period tolerance
 	invalidIntervalCount uint64        // Count of consecutive invalid events
 
+	loopGain        float64      // PLL loop gain for clock tracking (0 disables tracking)
+	halfBitEstimate atomic.Int64 // Current half-bit period in ns, readable from other goroutines
+	fullBitEstimate atomic.Int64 // Current full bit period in ns, readable from other goroutines
+	jitterEstimate  atomic.Int64 // Smoothed absolute timing error in ns, readable from other goroutines
+
+	validBitCount       atomic.Uint64 // Count of decoded High/Low bits
+	invalidBitCount     atomic.Uint64 // Count of Invalid bits
 	bufferOverflowCount atomic.Uint64 // Count of buffer overflows when sending bits
 	resyncCount         atomic.Uint64 // Count of resynchronizations due to invalid intervals
+	lockCount           atomic.Uint64 // Count of successful clock discoveries
+	unlockCount         atomic.Uint64 // Count of lost locks
+
+	onLinkEvent func(LinkEvent, Stats) // Optional link event callback
 
-	eventC <-chan Event // Input channel for GPIO events
-	c      chan Bit     // Output channel for decoded bits
+	demodulated bool          // Input is the active-low output of an IR receiver module
+	burstSkew   time.Duration // Lengthening of carrier bursts by the IR receiver module
+
+	eventC  <-chan Event // Input channel for GPIO events
+	c       chan Bit     // Output channel for decoded bits
+	pin     gpio.Pin     // GPIO pin watched by the decoder (FromPin only)
+	channel int          // Channel id of the line (Mux only)
 
 	wg     sync.WaitGroup
 	cancel context.CancelFunc
@@ -110,17 +182,58 @@ type Decoder struct {
 // If bitClockHz > 0, clock discovery is skipped and the bit periods are calculated directly.
 // Call Close() to stop the decoder and wait for a clean shutdown.
 func New(c <-chan Event, bitClockHz int, opts ...Option) (*Decoder, error) {
+	d, err := newDecoder(bitClockHz, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	d.eventC = c
+	d.start(d.listenForEvents)
+	return d, nil
+}
+
+// newDecoder creates a Decoder with the given options applied and validated, without starting it.
+func newDecoder(bitClockHz int, opts ...Option) (*Decoder, error) {
 	d := &Decoder{
-		eventC:            c,
-		clockEventSamples: make([]time.Duration, 0, clockEventSamples),
-		state:             discoverClock,
-		bufferSize:        1024,
+		bufferSize:       1024,
+		clockSamples:     defaultClockEventSamples,
+		tolerance:        defaultBitTimeTolerance,
+		invalidThreshold: defaultInvalidThreshold,
 	}
 
 	for _, opt := range opts {
 		opt(d)
 	}
 
+	// validate tuning parameters after options are applied
+	if d.clockSamples < minClockEventSamples {
+		return nil, fmt.Errorf("clock event samples must be at least %d: %v", minClockEventSamples, d.clockSamples)
+	}
+	if d.tolerance <= 0 || d.tolerance > maxBitTimeTolerance {
+		return nil, fmt.Errorf("bit time tolerance must be between 1 and %d percent: %v", maxBitTimeTolerance, d.tolerance)
+	}
+	if d.invalidThreshold == 0 {
+		return nil, fmt.Errorf("resync threshold must be greater than 0")
+	}
+	if d.minBitRate < 0 || d.maxBitRate < 0 {
+		return nil, fmt.Errorf("bit rate limits must not be negative: min %v, max %v", d.minBitRate, d.maxBitRate)
+	}
+	if d.maxBitRate > 0 && d.minBitRate > d.maxBitRate {
+		return nil, fmt.Errorf("minimum bit rate %v exceeds maximum bit rate %v", d.minBitRate, d.maxBitRate)
+	}
+	if bitClockHz > 0 && !d.acceptedBitRate(float64(bitClockHz)) {
+		return nil, fmt.Errorf("bit clock %v Hz is outside the accepted bit rate range", bitClockHz)
+	}
+	d.clockEventSamples = make([]time.Duration, 0, d.clockSamples)
+
+	if d.burstSkew < 0 {
+		return nil, fmt.Errorf("burst skew must not be negative: %v", d.burstSkew)
+	}
+
+	if d.loopGain < 0 || d.loopGain > 1 {
+		return nil, fmt.Errorf("clock tracking loop gain must be between 0 and 1: %v", d.loopGain)
+	}
+
 	// validate manchesterEncoding after options are applied
 	switch d.manchesterEncoding {
 	case IEEE, Thomas:
@@ -132,20 +245,20 @@ func New(c <-chan Event, bitClockHz int, opts ...Option) (*Decoder, error) {
 	d.c = make(chan Bit, d.bufferSize)
 	if bitClockHz > 0 {
 		// If a frequency is provided, calculate the expected bit periods and tolerances directly.
-		d.fullBitTime = time.Duration(int64(time.Second) / int64(bitClockHz))
-		d.halfBitTime = d.fullBitTime / 2
-		d.fullBitTimeTolerance = d.fullBitTime * bitTimeTolerance / 100
-		d.halfBitTimeTolerance = d.halfBitTime * bitTimeTolerance / 100
-		d.state = decodeData // Skip clock discovery if frequency is known
+		full := time.Duration(int64(time.Second) / int64(bitClockHz))
+		d.setBitTimes(full/2, full)
+		d.state.Store(int32(DecodeData)) // Skip clock discovery if frequency is known
 	}
 
-	// Start the decoding process in a separate goroutine.
+	return d, nil
+}
 
+// start runs the decoding process in a separate goroutine.
+func (d *Decoder) start(listen func(ctx context.Context)) {
 	ctx, cancel := context.WithCancel(context.Background())
 	d.cancel = cancel
 	d.wg.Add(1)
-	go d.listenForEvents(ctx)
-	return d, nil
+	go listen(ctx)
 }
 
 func WithBufferSize(size int) Option {
@@ -172,6 +285,89 @@ func WithLogger(l *slog.Logger) Option {
 	}
 }
 
+// WithClockSamples sets the number of intervals collected during clock discovery.
+// Fewer samples lock faster on short bursts, more samples give a more accurate clock.
+// Values below 8 will be rejected by New() with an error.
+func WithClockSamples(n int) Option {
+	return func(d *Decoder) {
+		d.clockSamples = n
+	}
+}
+
+// WithTolerance sets the accepted deviation in percent of the half and full bit periods.
+// Values outside 1..33 will be rejected by New() with an error, because above 33%
+// a stretched half bit can no longer be distinguished from a shortened full bit.
+func WithTolerance(percent int) Option {
+	return func(d *Decoder) {
+		d.tolerance = percent
+	}
+}
+
+// WithResyncThreshold sets the number of consecutive invalid intervals after which
+// the decoder drops the clock and starts a new clock discovery.
+// A threshold of 0 will be rejected by New() with an error.
+func WithResyncThreshold(n uint64) Option {
+	return func(d *Decoder) {
+		d.invalidThreshold = n
+	}
+}
+
+// WithMinBitRate sets the lowest accepted bit rate in Hz.
+// During clock discovery intervals longer than a full bit at this rate (e.g. idle gaps
+// between bursts) are ignored, and a discovered clock below this rate is rejected.
+// 0 (default) disables the limit.
+func WithMinBitRate(hz int) Option {
+	return func(d *Decoder) {
+		d.minBitRate = hz
+	}
+}
+
+// WithMaxBitRate sets the highest accepted bit rate in Hz.
+// During clock discovery intervals shorter than a half bit at this rate (e.g. glitches)
+// are ignored, and a discovered clock above this rate is rejected.
+// 0 (default) disables the limit.
+func WithMaxBitRate(hz int) Option {
+	return func(d *Decoder) {
+		d.maxBitRate = hz
+	}
+}
+
+// WithClockTracking enables continuous clock tracking with the given loop gain.
+//
+// After the clock is locked, every valid interval nudges the bit period towards the
+// measured value: period += gain * (measured - period). A small gain (e.g. 0.05) follows
+// slow drift (temperature, supply voltage) while ignoring jitter of single edges; a gain
+// of 1 simply adopts the last measured interval. A gain of 0 (default) disables tracking.
+// A gain outside [0, 1] will be rejected by New() with an error.
+func WithClockTracking(gain float64) Option {
+	return func(d *Decoder) {
+		d.loopGain = gain
+	}
+}
+
+// WithLinkEventHandler sets a callback that is called on clock lock, loss of lock and
+// resynchronization, together with a snapshot of the decoder statistics.
+// The callback runs on the decoding goroutine and must not block.
+func WithLinkEventHandler(fn func(evt LinkEvent, stats Stats)) Option {
+	return func(d *Decoder) {
+		d.onLinkEvent = fn
+	}
+}
+
+// WithDemodulatedInput configures the decoder for the output of an IR receiver module
+// (e.g. TSOP38238) that demodulates the carrier bursts of a modulated transmitter
+// (see encoder.Carrier). Such modules are active-low, so the edges are inverted: a
+// carrier burst is decoded as a High half bit. Receiver modules also lengthen the
+// bursts by a few carrier periods; burstSkew is subtracted from the end of every
+// burst to restore the half-bit timing (0 = no correction, see the module's datasheet).
+// A negative burstSkew will be rejected by New() with an error.
+func WithDemodulatedInput(burstSkew time.Duration) Option {
+	return func(d *Decoder) {
+		d.demodulated = true
+		d.burstSkew = burstSkew
+	}
+}
+
 // Close stops the decoder by cancelling the internal context, waits for the
 // goroutine to finish, and closes the Bits() channel.
 func (d *Decoder) Close() error {
@@ -179,6 +375,11 @@ func (d *Decoder) Close() error {
 	// Close() waits until listenForEvents() has terminated.
 	d.cancel()
 	d.wg.Wait()
+
+	// A decoder created by FromPin also stops watching the pin; the pin itself stays open.
+	if d.pin != nil {
+		return d.pin.StopWatching()
+	}
 	return nil
 }
 
@@ -188,6 +389,28 @@ func (d *Decoder) Bits() <-chan Bit {
 	return d.c
 }
 
+// Stats returns a snapshot of the decoder's state, clock timing and counters.
+//
+// This function is safe to call from an external goroutine. Each value is read
+// atomically; values may stem from consecutive events while the decoder is running.
+func (d *Decoder) Stats() Stats {
+	return Stats{
+		State:           State(d.state.Load()),
+		Frequency:       d.Frequency(),
+		HalfBitTime:     time.Duration(d.halfBitEstimate.Load()),
+		FullBitTime:     time.Duration(d.fullBitEstimate.Load()),
+		Jitter:          d.Jitter(),
+		ValidBits:       d.validBitCount.Load(),
+		InvalidBits:     d.invalidBitCount.Load(),
+		BufferOverflows: d.bufferOverflowCount.Load(),
+		Resyncs:         d.resyncCount.Load(),
+		Locks:           d.lockCount.Load(),
+		Unlocks:         d.unlockCount.Load(),
+		DroppedEvents:   d.droppedEvents(),
+		Channel:         d.channel,
+	}
+}
+
 // Info returns a human-readable summary of the decoder's current state.
 // It includes:
 //   - The current decoder state (discovering clock or decoding data).
@@ -195,30 +418,36 @@ func (d *Decoder) Bits() <-chan Bit {
 //   - The number of buffer overflows encountered while sending decoded bits.
 //   - The number of resynchronizations triggered due to invalid intervals.
 //
-// This function is safe to call from an external goroutine, as atomic counters
-// are used for thread-safe access to buffer overflow and resync counts.
+// This function is safe to call from an external goroutine; use Stats() for
+// machine-readable values.
 func (d *Decoder) Info() string {
-	var state string
-	var frequency float64
-
-	switch s := d.state; s {
-	case discoverClock:
-		state = "discovering clock"
-	case decodeData:
-		state = "decoding data"
-		if t := d.fullBitTime; t > 0 {
-			frequency = 1 / t.Seconds()
-		}
-	default:
-		state = fmt.Sprintf("unknown state %v", s)
-	}
-
-	info := fmt.Sprintf(
+	stats := d.Stats()
+	return fmt.Sprintf(
 		"Decoder state: %v, "+
 			"Frequency: %.2f Hz, "+
 			"Buffer overflow count: %v, "+
-			"Resync count: %v", state, frequency, d.bufferOverflowCount.Load(), d.resyncCount.Load())
-	return info
+			"Resync count: %v", stats.State, stats.Frequency, stats.BufferOverflows, stats.Resyncs)
+}
+
+// Frequency returns the current estimate of the bit clock in Hz.
+// With clock tracking enabled the value follows the transmitter's drift.
+// It returns 0 while the clock has not been discovered yet.
+//
+// This function is safe to call from an external goroutine.
+func (d *Decoder) Frequency() float64 {
+	t := time.Duration(d.fullBitEstimate.Load())
+	if t <= 0 {
+		return 0
+	}
+	return 1 / t.Seconds()
+}
+
+// Jitter returns the smoothed mean absolute deviation of the received intervals
+// from the expected bit timing. It is only updated while clock tracking is enabled.
+//
+// This function is safe to call from an external goroutine.
+func (d *Decoder) Jitter() time.Duration {
+	return time.Duration(d.jitterEstimate.Load())
 }
 
 // eventHandler processes a single GPIO event and decodes it into bits
@@ -231,6 +460,9 @@ func (d *Decoder) eventHandler(event Event) {
 	if event.Edge != RisingEdge && event.Edge != FallingEdge {
 		return
 	}
+	if d.demodulated {
+		event = d.demodulate(event)
+	}
 	if d.lastTimestamp.IsZero() {
 		d.lastTimestamp = event.Time
 		return
@@ -239,33 +471,41 @@ func (d *Decoder) eventHandler(event Event) {
 	delta := event.Time.Sub(d.lastTimestamp)
 	d.lastTimestamp = event.Time
 
-	switch d.state {
-	case discoverClock:
+	switch State(d.state.Load()) {
+	case DiscoverClock:
+		// Ignore intervals that cannot be a half or full bit within the accepted bit rates.
+		if d.minBitRate > 0 && delta > time.Second/time.Duration(d.minBitRate) {
+			return
+		}
+		if d.maxBitRate > 0 && delta < time.Second/time.Duration(2*d.maxBitRate) {
+			return
+		}
+
 		d.clockEventSamples = append(d.clockEventSamples, delta)
 
 		// Once enough samples are gathered, calculate the bit periods.
-		if len(d.clockEventSamples) >= clockEventSamples {
+		if len(d.clockEventSamples) >= d.clockSamples {
 			half, full := calcBitPeriods(d.clockEventSamples)
 
-			if full <= 0 || half <= 0 {
+			if full <= 0 || half <= 0 || !d.acceptedBitRate(1/full.Seconds()) {
 				d.resynchronize()
 				return
 			}
 
-			d.halfBitTime = half
-			d.fullBitTime = full
-			d.halfBitTimeTolerance = d.halfBitTime * bitTimeTolerance / 100
-			d.fullBitTimeTolerance = d.fullBitTime * bitTimeTolerance / 100
+			d.setBitTimes(half, full)
 			d.clockEventSamples = d.clockEventSamples[:0]
 			d.receivedHalfBit = 0
-			d.state = decodeData
+			d.state.Store(int32(DecodeData))
+			d.lockCount.Add(1)
+			d.notify(ClockLocked)
 		}
 
-	case decodeData:
+	case DecodeData:
 		if withinTolerance(delta, d.fullBitTime, d.fullBitTimeTolerance) {
 			// full bit detected >> its' a 1 or 0 depending on the edge
 			d.receivedHalfBit = 0
 			d.invalidIntervalCount = 0
+			d.trackClock(delta)
 			d.sendBit(d.decodingTable[event.Edge])
 			if d.logger != nil {
 				d.logger.Debug("full bit detected", "edge", d.decodingTable[event.Edge], "delta", delta.Microseconds())
@@ -275,6 +515,7 @@ func (d *Decoder) eventHandler(event Event) {
 
 		if withinTolerance(delta, d.halfBitTime, d.halfBitTimeTolerance) {
 			d.invalidIntervalCount = 0
+			d.trackClock(2 * delta)
 			if d.receivedHalfBit == 0 {
 				// first half bit detected >> wait for next half bit
 				d.receivedHalfBit = 1
@@ -296,22 +537,77 @@ func (d *Decoder) eventHandler(event Event) {
 		if d.logger != nil {
 			d.logger.Debug("invalid interval detected, sending invalid bit", "delta", delta.Microseconds())
 		}
-		if d.invalidIntervalCount > invalidThreshold {
+		if d.invalidIntervalCount > d.invalidThreshold {
+			d.unlockCount.Add(1)
+			d.notify(ClockLost)
 			d.resynchronize()
 		}
 
 	default:
 		d.receivedHalfBit = 0
 		d.lastTimestamp = time.Time{}
-		d.state = discoverClock
+		d.state.Store(int32(DiscoverClock))
+	}
+}
+
+// demodulate converts an edge of an active-low IR receiver module into an edge of the
+// transmitted envelope: the edge is inverted and the end of a burst is moved back by burstSkew.
+func (d *Decoder) demodulate(event Event) Event {
+	if event.Edge == RisingEdge {
+		// receiver output goes idle: end of the carrier burst
+		return Event{Time: event.Time.Add(-d.burstSkew), Edge: FallingEdge}
+	}
+	return Event{Time: event.Time, Edge: RisingEdge}
+}
+
+// setBitTimes sets the half and full bit periods and derives the timing tolerances.
+func (d *Decoder) setBitTimes(half, full time.Duration) {
+	d.halfBitTime = half
+	d.fullBitTime = full
+	d.halfBitTimeTolerance = half * time.Duration(d.tolerance) / 100
+	d.fullBitTimeTolerance = full * time.Duration(d.tolerance) / 100
+	d.halfBitEstimate.Store(int64(half))
+	d.fullBitEstimate.Store(int64(full))
+}
+
+// acceptedBitRate reports whether hz lies within the configured minimum and maximum bit rate.
+func (d *Decoder) acceptedBitRate(hz float64) bool {
+	if d.minBitRate > 0 && hz < float64(d.minBitRate) {
+		return false
+	}
+	if d.maxBitRate > 0 && hz > float64(d.maxBitRate) {
+		return false
 	}
+	return true
+}
+
+// trackClock adjusts the bit periods towards a measured full bit period (PLL-style).
+// The phase error is filtered with the loop gain, the jitter estimate is smoothed
+// with a fixed factor of 1/16 (as used for interarrival jitter in RFC 3550).
+func (d *Decoder) trackClock(measured time.Duration) {
+	if d.loopGain == 0 {
+		return
+	}
+
+	phaseError := measured - d.fullBitTime
+	full := d.fullBitTime + time.Duration(d.loopGain*float64(phaseError))
+	if full <= 0 {
+		return
+	}
+	d.setBitTimes(full/2, full)
+
+	if phaseError < 0 {
+		phaseError = -phaseError
+	}
+	jitter := d.jitterEstimate.Load()
+	d.jitterEstimate.Store(jitter + (int64(phaseError)-jitter)/16)
 }
 
 // calcBitPeriods calculates half and full bit periods from event samples using median analysis
 // It uses statistical analysis (sorting and median calculation) to determine the bit timing.
 func calcBitPeriods(samples []time.Duration) (time.Duration, time.Duration) {
-	// Ensure that there are enough samples (at least half of eventSamples)
-	if len(samples) < clockEventSamples/2 {
+	// Ensure that there are enough samples for a meaningful median
+	if len(samples) < minClockEventSamples {
 		return 0, 0
 	}
 
@@ -322,8 +618,10 @@ func calcBitPeriods(samples []time.Duration) (time.Duration, time.Duration) {
 	var fullBitPeriodMedian time.Duration
 
 	// Identify the median half-bit period and the corresponding full-bit period.
-	// Start from sample index 30 to ensure there is enough data for accurate median calculation.
-	for n := 30; n < len(samples); n++ {
+	// Start at 1/16 of the samples to ensure there is enough data for accurate median
+	// calculation, but not before index 2, so the half-bit median is taken from at
+	// least one sample. With the default 500 samples this starts at index 31.
+	for n := max(len(samples)/16, 2); n < len(samples); n++ {
 		halfBitPeriodMedian = median(samples[:n-1])
 
 		// If the sample is 150% of the half-bit period, it is a full-bit period
@@ -366,6 +664,12 @@ func withinTolerance(value, reference, tolerance time.Duration) bool {
 
 // sendBit sends a bit to the output channel with non-blocking behavior
 func (d *Decoder) sendBit(bit Bit) {
+	if bit == Invalid {
+		d.invalidBitCount.Add(1)
+	} else {
+		d.validBitCount.Add(1)
+	}
+
 	select {
 	case d.c <- bit:
 	default:
@@ -377,11 +681,25 @@ func (d *Decoder) sendBit(bit Bit) {
 func (d *Decoder) resynchronize() {
 
 	d.resyncCount.Add(1)
-	d.state = discoverClock
+	d.halfBitEstimate.Store(0)
+	d.fullBitEstimate.Store(0)
+	d.jitterEstimate.Store(0)
+	d.state.Store(int32(DiscoverClock))
 	d.clockEventSamples = d.clockEventSamples[:0] // reset the slice without reallocating (keep capacity)
 	d.invalidIntervalCount = 0
 	d.receivedHalfBit = 0
 	d.lastTimestamp = time.Time{} // reset timestamp to avoid stale delta calculation on next event
+	d.notify(Resynchronized)
+}
+
+// notify calls the optional link event handler with the current statistics.
+func (d *Decoder) notify(evt LinkEvent) {
+	if d.onLinkEvent != nil {
+		d.onLinkEvent(evt, d.Stats())
+	}
+	if d.logger != nil {
+		d.logger.Debug("link event", "event", evt, "info", d.Info())
+	}
 }
 
 // listenForEvents listens for events from eventC and processes them asynchronously
@@ -415,3 +733,27 @@ func decodingTable(code ManchesterEncoding) [2]Bit {
 		return [2]Bit{FallingEdge: High, RisingEdge: Low}
 	}
 }
+
+func (s State) String() string {
+	switch s {
+	case DiscoverClock:
+		return "discovering clock"
+	case DecodeData:
+		return "decoding data"
+	default:
+		return fmt.Sprintf("unknown state %d", int32(s))
+	}
+}
+
+func (e LinkEvent) String() string {
+	switch e {
+	case ClockLocked:
+		return "clock locked"
+	case ClockLost:
+		return "clock lost"
+	case Resynchronized:
+		return "resynchronized"
+	default:
+		return "unknown"
+	}
+}
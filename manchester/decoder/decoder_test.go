@@ -31,3 +31,347 @@ func TestWithinTolerance(t *testing.T) {
 		})
 	}
 }
+
+// manchesterEvents generates the edge events for the given bits as seen by the decoder
+// with IEEE encoding (High: falling edge in the middle of the bit, Low: rising edge).
+// period returns the full bit period for the n-th bit, which allows simulating drift.
+func manchesterEvents(bits []Bit, start time.Time, period func(n int) time.Duration) []Event {
+	var events []Event
+	level := -1
+	t := start
+	for n, bit := range bits {
+		halves := [2]int{0, 1}
+		if bit == High {
+			halves = [2]int{1, 0}
+		}
+		p := period(n)
+		for i, l := range halves {
+			if l != level {
+				edge := FallingEdge
+				if l == 1 {
+					edge = RisingEdge
+				}
+				if level >= 0 {
+					events = append(events, Event{Time: t, Edge: edge})
+				}
+				level = l
+			}
+			if i == 0 {
+				t = t.Add(p / 2)
+			} else {
+				t = t.Add(p - p/2)
+			}
+		}
+	}
+	return events
+}
+
+// decodeEvents feeds all events into a new decoder and returns the decoded bits.
+func decodeEvents(t *testing.T, events []Event, bitClockHz int, opts ...Option) ([]Bit, *Decoder) {
+	t.Helper()
+	c := make(chan Event, len(events))
+	for _, evt := range events {
+		c <- evt
+	}
+	close(c)
+
+	d, err := New(c, bitClockHz, append([]Option{WithBufferSize(len(events) + 1)}, opts...)...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	var bits []Bit
+	for bit := range d.Bits() {
+		bits = append(bits, bit)
+	}
+	_ = d.Close()
+	return bits, d
+}
+
+func TestClockTracking(t *testing.T) {
+	const nBits = 2000
+	bits := make([]Bit, nBits)
+	for i := range bits {
+		bits[i] = Bit(i * 7 % 3 % 2)
+	}
+
+	// the transmitter's bit period drifts linearly from 1000µs to 1400µs (-29% in frequency)
+	drift := func(n int) time.Duration {
+		return time.Millisecond + time.Duration(n)*400*time.Microsecond/nBits
+	}
+	events := manchesterEvents(bits, time.Unix(0, 0), drift)
+
+	invalid := func(bits []Bit) int {
+		var n int
+		for _, bit := range bits {
+			if bit == Invalid {
+				n++
+			}
+		}
+		return n
+	}
+
+	t.Run("without tracking", func(t *testing.T) {
+		got, _ := decodeEvents(t, events, 1000)
+		if invalid(got) == 0 {
+			t.Errorf("expected invalid bits without clock tracking")
+		}
+	})
+
+	t.Run("with tracking", func(t *testing.T) {
+		got, d := decodeEvents(t, events, 1000, WithClockTracking(0.1))
+		if n := invalid(got); n != 0 {
+			t.Errorf("got %d invalid bits, want 0", n)
+		}
+		if len(got) != nBits-1 {
+			t.Fatalf("got %d bits, want %d", len(got), nBits-1)
+		}
+		for i, bit := range got {
+			if bit != bits[i+1] {
+				t.Fatalf("bit %d = %v, want %v", i+1, bit, bits[i+1])
+			}
+		}
+		if f := d.Frequency(); f < 700 || f > 730 {
+			t.Errorf("Frequency() = %.1f Hz, want ~714 Hz", f)
+		}
+		if j := d.Jitter(); j > 20*time.Microsecond {
+			t.Errorf("Jitter() = %v, want < 20µs", j)
+		}
+	})
+
+	t.Run("invalid gain", func(t *testing.T) {
+		if _, err := New(make(chan Event), 1000, WithClockTracking(1.5)); err == nil {
+			t.Errorf("expected error for loop gain > 1")
+		}
+	})
+}
+
+func TestNewValidatesOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		bitClockHz int
+		opts       []Option
+		wantErr    bool
+	}{
+		{"defaults", 0, nil, false},
+		{"minimum clock samples", 0, []Option{WithClockSamples(8)}, false},
+		{"too few clock samples", 0, []Option{WithClockSamples(7)}, true},
+		{"zero tolerance", 0, []Option{WithTolerance(0)}, true},
+		{"maximum tolerance", 0, []Option{WithTolerance(33)}, false},
+		{"overlapping tolerance", 0, []Option{WithTolerance(34)}, true},
+		{"zero resync threshold", 0, []Option{WithResyncThreshold(0)}, true},
+		{"negative min bit rate", 0, []Option{WithMinBitRate(-1)}, true},
+		{"min above max bit rate", 0, []Option{WithMinBitRate(100), WithMaxBitRate(50)}, true},
+		{"bit clock within range", 50, []Option{WithMinBitRate(10), WithMaxBitRate(100)}, false},
+		{"bit clock below range", 5, []Option{WithMinBitRate(10)}, true},
+		{"bit clock above range", 500, []Option{WithMaxBitRate(100)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := make(chan Event)
+			d, err := New(c, tt.bitClockHz, tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if d != nil {
+				_ = d.Close()
+			}
+		})
+	}
+}
+
+func TestClockDiscovery(t *testing.T) {
+	// payload: 0xFF sync byte followed by a mixed pattern
+	var bits []Bit
+	for i := 0; i < 8; i++ {
+		bits = append(bits, High)
+	}
+	for i := 0; i < 120; i++ {
+		bits = append(bits, Bit(i*5%7%2))
+	}
+
+	tests := []struct {
+		name       string
+		bitClockHz int
+		opts       []Option
+	}{
+		{"low bit rate", 2, []Option{WithClockSamples(32)}},
+		{"default bit rate", 50, []Option{WithClockSamples(32)}},
+		{"high bit rate", 20000, []Option{WithClockSamples(32)}},
+		{"limited range", 1000, []Option{WithClockSamples(32), WithMinBitRate(500), WithMaxBitRate(2000)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			period := time.Second / time.Duration(tt.bitClockHz)
+			events := manchesterEvents(bits, time.Unix(0, 0), func(int) time.Duration { return period })
+
+			got, d := decodeEvents(t, events, 0, tt.opts...)
+			if f := d.Frequency(); f < float64(tt.bitClockHz)*0.99 || f > float64(tt.bitClockHz)*1.01 {
+				t.Errorf("Frequency() = %.2f Hz, want %v Hz", f, tt.bitClockHz)
+			}
+
+			// the tail of the payload must be decoded after the clock has been locked
+			const tail = 64
+			if len(got) < tail {
+				t.Fatalf("got %d bits, want at least %d", len(got), tail)
+			}
+			want := bits[len(bits)-tail:]
+			for i, bit := range got[len(got)-tail:] {
+				if bit != want[i] {
+					t.Fatalf("tail bit %d = %v, want %v", i, bit, want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestClockDiscoveryIgnoresIdleGaps(t *testing.T) {
+	// short bursts of 6 zero bits (half bit intervals only) separated by idle gaps of one second;
+	// without a minimum bit rate the gaps would be taken for full bit periods.
+	period := time.Millisecond
+	burst := make([]Bit, 6)
+
+	var events []Event
+	start := time.Unix(0, 0)
+	for i := 0; i < 8; i++ {
+		events = append(events, manchesterEvents(burst, start, func(int) time.Duration { return period })...)
+		start = events[len(events)-1].Time.Add(time.Second)
+	}
+
+	_, d := decodeEvents(t, events, 0, WithClockSamples(32), WithMinBitRate(100))
+	if f := d.Frequency(); f < 990 || f > 1010 {
+		t.Errorf("Frequency() = %.2f Hz, want 1000 Hz", f)
+	}
+}
+
+func TestStatsAndLinkEvents(t *testing.T) {
+	period := time.Millisecond
+	bits := make([]Bit, 64)
+	for i := range bits {
+		bits[i] = Bit(i * 5 % 3 % 2)
+	}
+	events := manchesterEvents(bits, time.Unix(0, 0), func(int) time.Duration { return period })
+
+	// followed by noise: intervals of 3.3 bit periods are neither half nor full bits
+	last := events[len(events)-1]
+	for i := 1; i <= 10; i++ {
+		last = Event{Time: last.Time.Add(3300 * time.Microsecond), Edge: 1 - last.Edge}
+		events = append(events, last)
+	}
+
+	var got []LinkEvent
+	_, d := decodeEvents(t, events, 0,
+		WithClockSamples(16),
+		WithResyncThreshold(5),
+		WithLinkEventHandler(func(evt LinkEvent, stats Stats) {
+			got = append(got, evt)
+			if evt == ClockLocked && stats.State != DecodeData {
+				t.Errorf("state on %v = %v, want %v", evt, stats.State, DecodeData)
+			}
+		}),
+	)
+
+	want := []LinkEvent{ClockLocked, ClockLost, Resynchronized}
+	if len(got) != len(want) {
+		t.Fatalf("link events = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("link events = %v, want %v", got, want)
+		}
+	}
+
+	stats := d.Stats()
+	if stats.State != DiscoverClock {
+		t.Errorf("State = %v, want %v", stats.State, DiscoverClock)
+	}
+	if stats.ValidBits == 0 {
+		t.Errorf("ValidBits = 0, want > 0")
+	}
+	if stats.InvalidBits != 6 {
+		t.Errorf("InvalidBits = %d, want 6", stats.InvalidBits)
+	}
+	if stats.Locks != 1 || stats.Unlocks != 1 || stats.Resyncs != 1 {
+		t.Errorf("Locks/Unlocks/Resyncs = %d/%d/%d, want 1/1/1", stats.Locks, stats.Unlocks, stats.Resyncs)
+	}
+	if stats.FullBitTime != 0 || stats.Frequency != 0 {
+		t.Errorf("clock timing not reset after loss of lock: %+v", stats)
+	}
+}
+
+func TestStatsConcurrentAccess(t *testing.T) {
+	c := make(chan Event)
+	d, err := New(c, 0, WithClockSamples(8))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	go func() {
+		for range d.Bits() {
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = d.Stats()
+			_ = d.Info()
+		}
+	}()
+
+	events := manchesterEvents(make([]Bit, 100), time.Unix(0, 0), func(int) time.Duration { return time.Millisecond })
+	for _, evt := range events {
+		c <- evt
+	}
+	<-done
+	_ = d.Close()
+
+	if s := d.Stats(); s.State != DecodeData || s.Locks != 1 {
+		t.Errorf("Stats() = %+v, want locked decoder", s)
+	}
+}
+
+func TestDemodulatedInput(t *testing.T) {
+	const skew = 200 * time.Microsecond // 40% of a half bit at 1kHz
+
+	var bits []Bit
+	for i := 0; i < 64; i++ {
+		bits = append(bits, Bit((i*7/3)%2))
+	}
+	events := manchesterEvents(bits, time.Unix(0, 0), func(int) time.Duration { return time.Millisecond })
+	want, _ := decodeEvents(t, events, 1000)
+
+	// an IR receiver module is active-low and lengthens every carrier burst
+	received := make([]Event, len(events))
+	for i, evt := range events {
+		received[i] = Event{Time: evt.Time, Edge: FallingEdge}
+		if evt.Edge == FallingEdge {
+			received[i] = Event{Time: evt.Time.Add(skew), Edge: RisingEdge}
+		}
+	}
+
+	got, d := decodeEvents(t, received, 1000, WithDemodulatedInput(skew))
+	if len(got) != len(want) {
+		t.Fatalf("decoded %d bits, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("bit %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+	if n := d.Stats().InvalidBits; n != 0 {
+		t.Errorf("InvalidBits = %d, want 0", n)
+	}
+
+	// without skew correction the distorted half bits are outside the tolerance
+	_, d = decodeEvents(t, received, 1000, WithDemodulatedInput(0))
+	if d.Stats().InvalidBits == 0 {
+		t.Error("expected invalid bits without skew correction")
+	}
+
+	if _, err := New(nil, 1000, WithDemodulatedInput(-time.Microsecond)); err == nil {
+		t.Error("New() with negative burst skew: expected error")
+	}
+}
@@ -0,0 +1,133 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// fuzzDurations converts fuzz input into durations of 1µs..65.536ms.
+func fuzzDurations(data []byte) []time.Duration {
+	durations := make([]time.Duration, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		durations = append(durations, time.Duration(binary.LittleEndian.Uint16(data[i:])+1)*time.Microsecond)
+	}
+	return durations
+}
+
+// idealDurations returns the fuzz input of a clean Manchester signal with the given half bit in µs.
+func idealDurations(halfBit uint16, pattern []byte) []byte {
+	var data []byte
+	for _, p := range pattern {
+		d := halfBit - 1
+		if p == 2 {
+			d = 2*halfBit - 1
+		}
+		data = binary.LittleEndian.AppendUint16(data, d)
+	}
+	return data
+}
+
+func FuzzCalcBitPeriods(f *testing.F) {
+	f.Add(idealDurations(500, []byte{1, 1, 2, 1, 1, 2, 2, 1, 1, 1, 1, 2, 1, 1, 2, 1}))
+	f.Add(idealDurations(10, []byte{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}))
+	f.Add([]byte{0xff, 0xff, 0, 0, 1, 0, 0xff, 0xff, 7, 0, 7, 0, 7, 0, 7, 0, 7, 0})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		samples := fuzzDurations(data)
+		minSample, maxSample := time.Duration(0), time.Duration(0)
+		for i, s := range samples {
+			if i == 0 || s < minSample {
+				minSample = s
+			}
+			if s > maxSample {
+				maxSample = s
+			}
+		}
+
+		half, full := calcBitPeriods(samples)
+		if len(samples) < minClockEventSamples {
+			if half != 0 || full != 0 {
+				t.Fatalf("calcBitPeriods() with %d samples = %v, %v, want 0, 0", len(samples), half, full)
+			}
+			return
+		}
+
+		// the half bit is a median of the samples, the full bit is longer
+		if half < minSample || half > maxSample {
+			t.Fatalf("half bit %v outside the sample range %v..%v", half, minSample, maxSample)
+		}
+		if full < half || full > max(maxSample, 2*half) {
+			t.Fatalf("full bit %v outside %v..%v", full, half, max(maxSample, 2*half))
+		}
+	})
+}
+
+func FuzzEventHandler(f *testing.F) {
+	f.Add(idealDurations(500, []byte{1, 1, 1, 1, 2, 1, 1, 2, 2, 1, 1, 1, 1, 2, 1, 1, 2, 1, 1, 1}), uint16(0), uint8(25))
+	f.Add(idealDurations(500, []byte{1, 1, 2, 2, 2, 1, 1, 1, 1, 2}), uint16(1000), uint8(25))
+	f.Add([]byte{0, 0, 0, 0, 0xff, 0xff, 3, 0, 9, 0}, uint16(1000), uint8(33))
+
+	f.Fuzz(func(t *testing.T, data []byte, bitClockHz uint16, tolerance uint8) {
+		opts := []Option{
+			WithClockSamples(minClockEventSamples),
+			WithTolerance(1 + int(tolerance)%maxBitTimeTolerance),
+			WithResyncThreshold(4),
+			WithClockTracking(0.1),
+		}
+		d, err := newDecoder(int(bitClockHz), opts...)
+		if err != nil {
+			t.Fatalf("newDecoder() error = %v", err)
+		}
+
+		// alternating edges; the lowest bit of each interval flips the edge once more,
+		// so the fuzzer can also produce repeated edges of the same direction
+		t0 := time.Unix(0, 0)
+		edge := RisingEdge
+		events := 0
+		for i, delta := range fuzzDurations(data) {
+			if data[2*i]&1 == 1 {
+				edge = 1 - edge
+			}
+			t0 = t0.Add(delta)
+			d.eventHandler(Event{Time: t0, Edge: edge})
+			edge = 1 - edge
+			events++
+
+			if len(d.c) == cap(d.c) {
+				// keep the output buffer from overflowing
+				for len(d.c) > 0 {
+					<-d.c
+				}
+			}
+		}
+
+		stats := d.Stats()
+		if stats.ValidBits+stats.InvalidBits > uint64(events) {
+			t.Fatalf("%d bits from %d events", stats.ValidBits+stats.InvalidBits, events)
+		}
+		if stats.BufferOverflows != 0 {
+			t.Fatalf("BufferOverflows = %d, want 0", stats.BufferOverflows)
+		}
+		switch stats.State {
+		case DecodeData:
+			if stats.HalfBitTime <= 0 || stats.FullBitTime < stats.HalfBitTime {
+				t.Fatalf("decoding with invalid bit times: %+v", stats)
+			}
+		case DiscoverClock:
+			if stats.FullBitTime != 0 || len(d.clockEventSamples) >= minClockEventSamples {
+				t.Fatalf("discovering the clock with stale state: %+v, %d samples", stats, len(d.clockEventSamples))
+			}
+		default:
+			t.Fatalf("invalid state %v", stats.State)
+		}
+		// with a known bit clock the decoder starts locked without counting a lock
+		locks := stats.Locks
+		if bitClockHz > 0 {
+			locks++
+		}
+		if locks < stats.Unlocks {
+			t.Fatalf("Locks = %d < Unlocks = %d", stats.Locks, stats.Unlocks)
+		}
+	})
+}
@@ -0,0 +1,272 @@
+package decoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/womat/golib/gpio"
+)
+
+// ChannelEvent is an edge event of one line of a Mux, tagged with its channel id
+// (e.g. the GPIO pin number).
+type ChannelEvent struct {
+	Channel int
+	Event
+}
+
+// ChannelBit is a decoded bit of one line of a Mux, tagged with its channel id.
+type ChannelBit struct {
+	Channel int
+	Bit     Bit
+}
+
+// Mux decodes several Manchester lines in a single goroutine.
+//
+// Every channel has its own clock recovery, state and statistics, as if it had its own
+// Decoder. Channels are created with the options passed to NewMux when their first event
+// arrives; the link event handler receives the channel id in Stats.Channel.
+// Decoded bits of all channels are delivered on one channel in the order of the events.
+//
+//	m, err := decoder.MuxFromPins(pins, 50)
+//	...
+//	defer m.Close()
+//	for b := range m.Bits() {
+//		frames[b.Channel] = append(frames[b.Channel], b.Bit)
+//	}
+type Mux struct {
+	bitClockHz int
+	opts       []Option
+
+	mu       sync.RWMutex     // protects channels, which are added by the decoding goroutine
+	channels map[int]*Decoder // per-channel decoding state, the decoders are not started
+
+	eventC <-chan ChannelEvent // Input channel for tagged events (NewMux only)
+	pins   map[int]gpio.Pin    // Watched GPIO pins by channel id (MuxFromPins only)
+	c      chan ChannelBit     // Output channel for decoded bits
+
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+}
+
+// NewMux creates a multiplexed decoder for events tagged with a channel id and starts
+// the decoding goroutine. bitClockHz and opts apply to every channel, see New.
+// Call Close() to stop the decoder and wait for a clean shutdown.
+func NewMux(c <-chan ChannelEvent, bitClockHz int, opts ...Option) (*Mux, error) {
+	m, err := newMux(bitClockHz, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	m.eventC = c
+	m.start(m.listenForEvents)
+	return m, nil
+}
+
+// MuxFromPins creates a multiplexed decoder that watches the given GPIO input pins
+// for rising and falling edges. The channel id of a pin is its number.
+//
+// The decoder owns the watches: Close() stops the decoder and calls StopWatching() on
+// every pin, but does not close the pins. Events dropped by a pin are reported in
+// the DroppedEvents of its channel.
+func MuxFromPins(pins []gpio.Pin, bitClockHz int, opts ...Option) (*Mux, error) {
+	m, err := newMux(bitClockHz, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool, len(pins))
+	for _, pin := range pins {
+		if seen[pin.Number()] {
+			return nil, fmt.Errorf("duplicate GPIO pin %d", pin.Number())
+		}
+		seen[pin.Number()] = true
+	}
+
+	m.pins = make(map[int]gpio.Pin, len(pins))
+	cases := make([]reflect.SelectCase, 0, len(pins))
+	ids := make([]int, 0, len(pins))
+	for _, pin := range pins {
+		events, err := pin.WatchCh(gpio.RisingEdge | gpio.FallingEdge)
+		if err != nil {
+			_ = m.stopWatching() // only the pins watched so far
+			return nil, fmt.Errorf("failed to watch GPIO pin %d: %w", pin.Number(), err)
+		}
+		m.pins[pin.Number()] = pin
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(events)})
+		ids = append(ids, pin.Number())
+	}
+
+	m.start(func(ctx context.Context) {
+		m.listenForPinEvents(ctx, cases, ids)
+	})
+	return m, nil
+}
+
+// newMux validates the options and creates a Mux without channels.
+func newMux(bitClockHz int, opts ...Option) (*Mux, error) {
+	d, err := newDecoder(bitClockHz, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Mux{
+		bitClockHz: bitClockHz,
+		opts:       opts,
+		channels:   make(map[int]*Decoder),
+		c:          make(chan ChannelBit, d.bufferSize),
+	}, nil
+}
+
+// start runs the decoding process in a separate goroutine.
+func (m *Mux) start(listen func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.wg.Add(1)
+	go listen(ctx)
+}
+
+// Close stops the decoder, waits for the goroutine to finish and closes the Bits() channel.
+// A decoder created by MuxFromPins also stops watching the pins.
+func (m *Mux) Close() error {
+	m.cancel()
+	m.wg.Wait()
+	return m.stopWatching()
+}
+
+// Bits returns a read-only channel on which decoded bits of all channels are delivered.
+// The channel is closed when the decoder has shut down.
+func (m *Mux) Bits() <-chan ChannelBit {
+	return m.c
+}
+
+// Channels returns the sorted ids of all channels that have received events.
+//
+// This function is safe to call from an external goroutine.
+func (m *Mux) Channels() []int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]int, 0, len(m.channels))
+	for id := range m.channels {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Stats returns a snapshot of the state, clock timing and counters of a channel.
+// It returns false if the channel has not received any events yet.
+//
+// This function is safe to call from an external goroutine.
+func (m *Mux) Stats(channel int) (Stats, bool) {
+	m.mu.RLock()
+	d, ok := m.channels[channel]
+	m.mu.RUnlock()
+
+	if !ok {
+		return Stats{Channel: channel}, false
+	}
+	return d.Stats(), true
+}
+
+// channel returns the decoding state of a channel and creates it on its first event.
+func (m *Mux) channel(id int) *Decoder {
+	m.mu.RLock()
+	d, ok := m.channels[id]
+	m.mu.RUnlock()
+	if ok {
+		return d
+	}
+
+	// the options have been validated by newMux
+	d, _ = newDecoder(m.bitClockHz, m.opts...)
+	d.channel = id
+	d.pin = m.pins[id]
+	// every event produces at most one bit, which is forwarded to the shared channel
+	d.c = make(chan Bit, 1)
+
+	m.mu.Lock()
+	m.channels[id] = d
+	m.mu.Unlock()
+	return d
+}
+
+// eventHandler decodes an event of a channel and forwards the decoded bit.
+func (m *Mux) eventHandler(evt ChannelEvent) {
+	d := m.channel(evt.Channel)
+	d.eventHandler(evt.Event)
+
+	select {
+	case bit := <-d.c:
+		select {
+		case m.c <- ChannelBit{Channel: evt.Channel, Bit: bit}:
+		default:
+			d.bufferOverflowCount.Add(1)
+		}
+	default:
+	}
+}
+
+// listenForEvents listens for events from eventC and processes them asynchronously
+func (m *Mux) listenForEvents(ctx context.Context) {
+	defer func() {
+		close(m.c)
+		m.wg.Done()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-m.eventC:
+			if !ok {
+				return // Exit if the buffer channel is closed
+			}
+			m.eventHandler(evt)
+		}
+	}
+}
+
+// listenForPinEvents listens for GPIO events of all watched pins in a single goroutine.
+// cases holds the event channels of the pins, ids the corresponding channel ids.
+func (m *Mux) listenForPinEvents(ctx context.Context, cases []reflect.SelectCase, ids []int) {
+	defer func() {
+		close(m.c)
+		m.wg.Done()
+	}()
+
+	// the first case is the cancellation of the decoder
+	cases = append([]reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}}, cases...)
+	ids = append([]int{0}, ids...)
+
+	for len(cases) > 1 {
+		i, v, ok := reflect.Select(cases)
+		if i == 0 {
+			return
+		}
+		if !ok {
+			// the pin stopped watching
+			cases = append(cases[:i], cases[i+1:]...)
+			ids = append(ids[:i], ids[i+1:]...)
+			continue
+		}
+		if e, ok := FromGPIOEvent(v.Interface().(gpio.Event)); ok {
+			m.eventHandler(ChannelEvent{Channel: ids[i], Event: e})
+		}
+	}
+}
+
+// stopWatching stops watching all pins of a decoder created by MuxFromPins.
+func (m *Mux) stopWatching() error {
+	var errs []error
+	for _, pin := range m.pins {
+		if err := pin.StopWatching(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
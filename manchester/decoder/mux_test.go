@@ -0,0 +1,173 @@
+package decoder
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/womat/golib/gpio"
+	"github.com/womat/golib/gpio/rpiemu"
+	"github.com/womat/golib/manchester/encoder"
+)
+
+func TestMux(t *testing.T) {
+	var bits []Bit
+	for i := 0; i < 200; i++ {
+		bits = append(bits, Bit(i*5%7%2))
+	}
+
+	// two lines with different bit rates, interleaved in time
+	rates := map[int]int{3: 1000, 7: 2500}
+	var events []ChannelEvent
+	want := make(map[int][]Bit)
+	for ch, hz := range rates {
+		period := time.Second / time.Duration(hz)
+		line := manchesterEvents(bits, time.Unix(0, 0), func(int) time.Duration { return period })
+		for _, evt := range line {
+			events = append(events, ChannelEvent{Channel: ch, Event: evt})
+		}
+		want[ch], _ = decodeEvents(t, line, 0, WithClockSamples(32))
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+
+	c := make(chan ChannelEvent, len(events))
+	for _, evt := range events {
+		c <- evt
+	}
+	close(c)
+
+	var mu sync.Mutex
+	locked := make(map[int]int)
+	m, err := NewMux(c, 0,
+		WithClockSamples(32),
+		WithBufferSize(len(events)),
+		WithLinkEventHandler(func(evt LinkEvent, stats Stats) {
+			mu.Lock()
+			defer mu.Unlock()
+			if evt == ClockLocked {
+				locked[stats.Channel]++
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewMux() error = %v", err)
+	}
+
+	got := make(map[int][]Bit)
+	for b := range m.Bits() {
+		got[b.Channel] = append(got[b.Channel], b.Bit)
+	}
+	_ = m.Close()
+
+	for ch, hz := range rates {
+		if len(got[ch]) != len(want[ch]) {
+			t.Fatalf("channel %d: decoded %d bits, want %d", ch, len(got[ch]), len(want[ch]))
+		}
+		for i := range want[ch] {
+			if got[ch][i] != want[ch][i] {
+				t.Fatalf("channel %d: bit %d = %v, want %v", ch, i, got[ch][i], want[ch][i])
+			}
+		}
+
+		stats, ok := m.Stats(ch)
+		if !ok {
+			t.Fatalf("Stats(%d): channel not found", ch)
+		}
+		if stats.Channel != ch || stats.Locks != 1 || locked[ch] != 1 {
+			t.Errorf("channel %d: Channel/Locks/locked = %d/%d/%d, want %d/1/1", ch, stats.Channel, stats.Locks, locked[ch], ch)
+		}
+		if f := stats.Frequency; f < float64(hz)*0.99 || f > float64(hz)*1.01 {
+			t.Errorf("channel %d: Frequency = %.2f Hz, want %v Hz", ch, f, hz)
+		}
+	}
+
+	if ids := m.Channels(); len(ids) != 2 || ids[0] != 3 || ids[1] != 7 {
+		t.Errorf("Channels() = %v, want [3 7]", ids)
+	}
+	if _, ok := m.Stats(5); ok {
+		t.Errorf("Stats(5): unexpected channel")
+	}
+
+	if _, err := NewMux(c, 0, WithClockSamples(1)); err == nil {
+		t.Errorf("NewMux() with invalid option: expected error")
+	}
+}
+
+func TestMuxFromPins(t *testing.T) {
+	const bitClockHz = 50
+
+	var pins []gpio.Pin
+	for _, n := range []int{17, 18} {
+		pin, err := rpiemu.NewPin(n, rpiemu.WithMode(gpio.Output))
+		if err != nil {
+			t.Fatalf("NewPin() error = %v", err)
+		}
+		defer pin.Close()
+		pins = append(pins, pin)
+	}
+
+	if _, err := MuxFromPins([]gpio.Pin{pins[0], pins[0]}, bitClockHz); err == nil {
+		t.Errorf("MuxFromPins() with duplicate pins: expected error")
+	}
+
+	// see TestFromPinToPin for the encoding
+	m, err := MuxFromPins(pins, bitClockHz, WithManchesterEncoding(Thomas))
+	if err != nil {
+		t.Fatalf("MuxFromPins() error = %v", err)
+	}
+
+	data := map[int]byte{17: 0x5a, 18: 0xc3}
+	var wg sync.WaitGroup
+	for _, pin := range pins {
+		wg.Add(1)
+		go func(pin gpio.Pin) {
+			defer wg.Done()
+			enc := encoder.ToPin(pin, bitClockHz, encoder.WithSyncBytes(1), encoder.WithPreciseTiming(-1))
+			defer enc.Close()
+			if _, err := enc.Send([]byte{data[pin.Number()]}); err != nil {
+				t.Errorf("Send() error = %v", err)
+			}
+			enc.Wait()
+		}(pin)
+	}
+	wg.Wait()
+
+	time.Sleep(100 * time.Millisecond)
+	if err := m.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	got := make(map[int][]Bit)
+	for b := range m.Bits() {
+		got[b.Channel] = append(got[b.Channel], b.Bit)
+	}
+
+	for ch, b := range data {
+		// start bit, data LSB first, stop bit
+		want := []Bit{Low}
+		for i := 0; i < 8; i++ {
+			want = append(want, Bit(b>>i&1))
+		}
+		want = append(want, High)
+
+		bits := got[ch]
+		if len(bits) < len(want) {
+			t.Fatalf("channel %d: bits = %v, want at least %d bits", ch, bits, len(want))
+		}
+		for i, bit := range bits[len(bits)-len(want):] {
+			if bit != want[i] {
+				t.Fatalf("channel %d: bits = %v, want to end with %v", ch, bits, want)
+			}
+		}
+		if s, _ := m.Stats(ch); s.DroppedEvents != 0 {
+			t.Errorf("channel %d: DroppedEvents = %d, want 0", ch, s.DroppedEvents)
+		}
+	}
+
+	// after Close the pins can be watched again
+	for _, pin := range pins {
+		if _, err := pin.WatchCh(gpio.RisingEdge | gpio.FallingEdge); err != nil {
+			t.Errorf("WatchCh() after Close() error = %v", err)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package decoder
+
+// DecodeEvents decodes a recorded sequence of events synchronously, e.g. from a
+// logic analyzer capture, and returns all decoded bits together with the final
+// statistics. It accepts the same options as New; WithBufferSize is ignored because
+// the output buffer always holds all bits, so no bit is lost to buffer overflows.
+func DecodeEvents(events []Event, bitClockHz int, opts ...Option) ([]Bit, Stats, error) {
+	d, err := newDecoder(bitClockHz, opts...)
+	if err != nil {
+		return nil, Stats{}, err
+	}
+
+	// every event produces at most one bit
+	d.c = make(chan Bit, len(events))
+	for _, evt := range events {
+		d.eventHandler(evt)
+	}
+	close(d.c)
+
+	bits := make([]Bit, 0, len(d.c))
+	for bit := range d.c {
+		bits = append(bits, bit)
+	}
+	return bits, d.Stats(), nil
+}
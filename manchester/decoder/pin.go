@@ -0,0 +1,81 @@
+package decoder
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/womat/golib/gpio"
+)
+
+// FromPin creates a new Decoder that watches the given GPIO input pin for rising and
+// falling edges and decodes them directly, without an intermediate translation goroutine.
+//
+// The decoder owns the watch: Close() stops the decoder and calls pin.StopWatching(),
+// but does not close the pin. Events dropped by the pin are reported in Stats().DroppedEvents.
+//
+//	pin, err := rpi.NewPin(20, rpi.WithMode(gpio.Input), rpi.WithPullup(gpio.PullUp))
+//	...
+//	d, err := decoder.FromPin(pin, 50, decoder.WithManchesterEncoding(decoder.IEEE))
+//	...
+//	defer d.Close()
+//	for bit := range d.Bits() { ... }
+func FromPin(pin gpio.Pin, bitClockHz int, opts ...Option) (*Decoder, error) {
+	d, err := newDecoder(bitClockHz, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := pin.WatchCh(gpio.RisingEdge | gpio.FallingEdge)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch GPIO pin %d: %w", pin.Number(), err)
+	}
+
+	d.pin = pin
+	d.start(func(ctx context.Context) {
+		d.listenForPinEvents(ctx, events)
+	})
+	return d, nil
+}
+
+// FromGPIOEvent translates a gpio.Event into a decoder Event.
+// It returns false if the event is neither a single rising nor a single falling edge.
+func FromGPIOEvent(evt gpio.Event) (Event, bool) {
+	switch evt.Edge {
+	case gpio.RisingEdge:
+		return Event{Time: evt.Time, Edge: RisingEdge}, true
+	case gpio.FallingEdge:
+		return Event{Time: evt.Time, Edge: FallingEdge}, true
+	default:
+		return Event{}, false
+	}
+}
+
+// listenForPinEvents listens for GPIO events of the watched pin and processes them asynchronously
+func (d *Decoder) listenForPinEvents(ctx context.Context, events <-chan gpio.Event) {
+	defer func() {
+		close(d.c)
+		d.wg.Done()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-events:
+			if !ok {
+				return // Exit if the pin stopped watching
+			}
+			if e, ok := FromGPIOEvent(evt); ok {
+				d.eventHandler(e)
+			}
+		}
+	}
+}
+
+// droppedEvents returns the number of events dropped by the watched pin.
+func (d *Decoder) droppedEvents() uint64 {
+	if d.pin == nil {
+		return 0
+	}
+	return d.pin.DroppedEvents()
+}
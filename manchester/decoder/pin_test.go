@@ -0,0 +1,125 @@
+package decoder
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/womat/golib/gpio"
+	"github.com/womat/golib/manchester/encoder"
+)
+
+func TestFromGPIOEvent(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		edge gpio.Edge
+		want Edge
+		ok   bool
+	}{
+		{gpio.RisingEdge, RisingEdge, true},
+		{gpio.FallingEdge, FallingEdge, true},
+		{gpio.RisingEdge | gpio.FallingEdge, 0, false},
+		{0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.edge.String(), func(t *testing.T) {
+			got, ok := FromGPIOEvent(gpio.Event{Time: now, Edge: tt.edge})
+			if ok != tt.ok {
+				t.Fatalf("FromGPIOEvent(%v) ok = %v, want %v", tt.edge, ok, tt.ok)
+			}
+			if ok && (got.Edge != tt.want || !got.Time.Equal(now)) {
+				t.Errorf("FromGPIOEvent(%v) = %+v, want edge %v at %v", tt.edge, got, tt.want, now)
+			}
+		})
+	}
+}
+
+// fakePin is a gpio.Pin that delivers the events pushed by the test to its watcher.
+type fakePin struct {
+	mu     sync.Mutex
+	events chan gpio.Event // nil while the pin is not watched
+}
+
+func (p *fakePin) Close() error                                { return p.StopWatching() }
+func (p *fakePin) SetValue(gpio.Level) error                   { return nil }
+func (p *fakePin) Value() (gpio.Level, error)                  { return gpio.Low, nil }
+func (p *fakePin) Number() int                                 { return 17 }
+func (p *fakePin) Info() string                                { return "fake pin 17" }
+func (p *fakePin) WatchFunc(gpio.Edge, func(gpio.Event)) error { return gpio.ErrAlreadyWatching }
+func (p *fakePin) DroppedEvents() uint64                       { return 0 }
+
+func (p *fakePin) WatchCh(gpio.Edge) (<-chan gpio.Event, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.events != nil {
+		return nil, gpio.ErrAlreadyWatching
+	}
+	p.events = make(chan gpio.Event, 1024)
+	return p.events, nil
+}
+
+func (p *fakePin) StopWatching() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.events != nil {
+		close(p.events)
+		p.events = nil
+	}
+	return nil
+}
+
+// push delivers the edges of a recorded waveform to the watcher of the pin.
+func (p *fakePin) push(transitions []encoder.Transition) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, evt := range transitionEvents(transitions) {
+		edge := gpio.FallingEdge
+		if evt.Edge == RisingEdge {
+			edge = gpio.RisingEdge
+		}
+		p.events <- gpio.Event{Time: evt.Time, Edge: edge}
+	}
+}
+
+func TestFromPin(t *testing.T) {
+	const bitClockHz = 50
+	pin := &fakePin{}
+
+	d, err := FromPin(pin, bitClockHz, WithManchesterEncoding(decoderEncoding(encoder.IEEE)))
+	if err != nil {
+		t.Fatalf("FromPin() error = %v", err)
+	}
+	if _, err := FromPin(pin, bitClockHz); err == nil {
+		t.Errorf("FromPin() on a watched pin: expected error")
+	}
+
+	// The edges of the ideal waveform carry their own timestamps, so the decoder
+	// does not depend on the scheduling of the test.
+	data := []byte{0x5a}
+	pin.push(encoder.Render(bitClockHz, data, time.Unix(0, 0), encoder.WithSyncBytes(1)).Transitions())
+
+	// stopping the watch closes the event channel, the decoder processes all pending
+	// events and closes Bits()
+	_ = pin.StopWatching()
+	var got []Bit
+	for bit := range d.Bits() {
+		got = append(got, bit)
+	}
+	if err := d.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+
+	// The first bits are needed to lock the clock, so only the data byte is checked.
+	if want := framedBits(data, encoder.LSBFirst); !endsWith(got, want) {
+		t.Errorf("bits = %v, want to end with %v", got, want)
+	}
+	if s := d.Stats(); s.DroppedEvents != 0 {
+		t.Errorf("Stats().DroppedEvents = %d, want 0", s.DroppedEvents)
+	}
+
+	// after Close the pin can be watched again
+	if _, err := pin.WatchCh(gpio.RisingEdge | gpio.FallingEdge); err != nil {
+		t.Errorf("WatchCh() after Close() error = %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package decoder
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/womat/golib/manchester/encoder"
+)
+
+// The encoder's IEEE table emits a rising edge in the middle of a 1 bit, which is
+// what the decoder's Thomas table decodes as High (and vice versa).
+func decoderEncoding(enc encoder.ManchesterEncoding) ManchesterEncoding {
+	if enc == encoder.IEEE {
+		return Thomas
+	}
+	return IEEE
+}
+
+// transitionEvents converts the transitions of an encoder.Recorder into edge events;
+// the first transition is the initial level and produces no edge.
+func transitionEvents(transitions []encoder.Transition) []Event {
+	var events []Event
+	for _, tr := range transitions[1:] {
+		edge := FallingEdge
+		if tr.Level == encoder.High {
+			edge = RisingEdge
+		}
+		events = append(events, Event{Time: tr.Time, Edge: edge})
+	}
+	return events
+}
+
+// framedBits returns the bits of data as transmitted by the encoder: start bit, 8 data bits, stop bit.
+func framedBits(data []byte, order encoder.BitOrder) []Bit {
+	var bits []Bit
+	for _, b := range data {
+		bits = append(bits, Low)
+		for i := 0; i < 8; i++ {
+			n := i
+			if order == encoder.MSBFirst {
+				n = 7 - i
+			}
+			bits = append(bits, Bit(b>>n&1))
+		}
+		bits = append(bits, High)
+	}
+	return bits
+}
+
+// endsWith reports whether bits ends with suffix.
+func endsWith(bits, suffix []Bit) bool {
+	if len(bits) < len(suffix) {
+		return false
+	}
+	for i, bit := range bits[len(bits)-len(suffix):] {
+		if bit != suffix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// roundTripCase is a random transmission: payload, bit rate, encoding and bit order.
+type roundTripCase struct {
+	data       []byte
+	bitClockHz int
+	encoding   encoder.ManchesterEncoding
+	order      encoder.BitOrder
+}
+
+func (c roundTripCase) String() string {
+	return fmt.Sprintf("%d Hz, encoding %d, bit order %d, data %x", c.bitClockHz, c.encoding, c.order, c.data)
+}
+
+func newRoundTripCase(r *rand.Rand) roundTripCase {
+	c := roundTripCase{
+		data:       make([]byte, 1+r.IntN(32)),
+		bitClockHz: 10 + r.IntN(50000),
+		encoding:   encoder.ManchesterEncoding(r.IntN(2)),
+		order:      encoder.BitOrder(r.IntN(2)),
+	}
+	for i := range c.data {
+		c.data[i] = byte(r.UintN(256))
+	}
+	return c
+}
+
+// render encodes the payload with the given number of sync bytes into ideal edge events.
+func (c roundTripCase) render(start time.Time, syncBytes int) ([]Event, time.Time) {
+	rec := encoder.Render(c.bitClockHz, c.data, start,
+		encoder.WithManchesterEncoding(c.encoding),
+		encoder.WithBitOrder(c.order),
+		encoder.WithSyncBytes(syncBytes),
+	)
+	return transitionEvents(rec.Transitions()), rec.End()
+}
+
+func (c roundTripCase) halfBit() time.Duration {
+	return time.Second / time.Duration(c.bitClockHz) / 2
+}
+
+// addJitter moves every edge by a random offset of up to ±fraction of a half bit.
+func addJitter(r *rand.Rand, events []Event, halfBit time.Duration, fraction float64) {
+	maxOffset := int64(float64(halfBit) * fraction)
+	for i := range events {
+		events[i].Time = events[i].Time.Add(time.Duration(r.Int64N(2*maxOffset+1) - maxOffset))
+	}
+}
+
+// dropEdges removes n random edges.
+func dropEdges(r *rand.Rand, events []Event, n int) []Event {
+	for ; n > 0 && len(events) > 0; n-- {
+		i := r.IntN(len(events))
+		events = append(events[:i], events[i+1:]...)
+	}
+	return events
+}
+
+// addGlitches inserts n short spikes of 5% of a half bit in the middle of random intervals.
+func addGlitches(r *rand.Rand, events []Event, halfBit time.Duration, n int) []Event {
+	for ; n > 0 && len(events) > 1; n-- {
+		i := 1 + r.IntN(len(events)-1)
+		t := events[i-1].Time.Add(events[i].Time.Sub(events[i-1].Time) / 2)
+		spike := []Event{
+			{Time: t, Edge: events[i].Edge},
+			{Time: t.Add(halfBit / 20), Edge: events[i-1].Edge},
+		}
+		events = append(events[:i], append(spike, events[i:]...)...)
+	}
+	return events
+}
+
+// TestRoundTripProperties checks that every payload rendered by the encoder is decoded
+// exactly, for random bit rates, encodings and bit orders, with and without clock
+// discovery and with edge jitter of up to 10% of a half bit.
+func TestRoundTripProperties(t *testing.T) {
+	for seed := uint64(0); seed < 200; seed++ {
+		r := rand.New(rand.NewPCG(seed, 36))
+		c := newRoundTripCase(r)
+
+		discover := seed%2 == 1
+		bitClockHz, syncBytes := c.bitClockHz, 2
+		opts := []Option{WithManchesterEncoding(decoderEncoding(c.encoding))}
+		if discover {
+			// 4 sync bytes provide 64 half-bit intervals for the discovery
+			bitClockHz, syncBytes = 0, 4
+			opts = append(opts, WithClockSamples(32))
+		}
+
+		events, _ := c.render(time.Unix(0, 0), syncBytes)
+		if seed%4 >= 2 {
+			addJitter(r, events, c.halfBit(), 0.1)
+		}
+
+		bits, stats, err := DecodeEvents(events, bitClockHz, opts...)
+		if err != nil {
+			t.Fatalf("seed %d: DecodeEvents() error = %v", seed, err)
+		}
+		if want := framedBits(c.data, c.order); !endsWith(bits, want) {
+			t.Fatalf("seed %d (%v, discover %v): bits = %v, want to end with %v", seed, c, discover, bits, want)
+		}
+		if stats.InvalidBits != 0 {
+			t.Errorf("seed %d (%v): InvalidBits = %d, want 0", seed, c, stats.InvalidBits)
+		}
+		if discover {
+			if f := stats.Frequency; f < float64(c.bitClockHz)*0.95 || f > float64(c.bitClockHz)*1.05 {
+				t.Errorf("seed %d (%v): Frequency = %.2f Hz, want %v Hz", seed, c, f, c.bitClockHz)
+			}
+		}
+	}
+}
+
+// TestRoundTripRecovery checks that the decoder recovers from dropped edges and glitches:
+// a damaged message followed by an idle gap does not affect the decoding of the next one.
+func TestRoundTripRecovery(t *testing.T) {
+	for seed := uint64(0); seed < 200; seed++ {
+		r := rand.New(rand.NewPCG(seed, 37))
+		damaged := newRoundTripCase(r)
+		clean := damaged
+		clean.data = []byte{byte(r.UintN(256)), byte(r.UintN(256))}
+
+		events, end := damaged.render(time.Unix(0, 0), 2)
+		switch seed % 3 {
+		case 0:
+			events = dropEdges(r, events, 1+r.IntN(3))
+		case 1:
+			events = addGlitches(r, events, damaged.halfBit(), 1+r.IntN(3))
+		default:
+			events = dropEdges(r, events, 1+r.IntN(2))
+			events = addGlitches(r, events, damaged.halfBit(), 1+r.IntN(2))
+		}
+		sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+
+		// an idle gap of 10 bit periods separates the messages
+		next, _ := clean.render(end.Add(20*clean.halfBit()), 2)
+		events = append(events, next...)
+
+		bits, stats, err := DecodeEvents(events, damaged.bitClockHz,
+			WithManchesterEncoding(decoderEncoding(damaged.encoding)))
+		if err != nil {
+			t.Fatalf("seed %d: DecodeEvents() error = %v", seed, err)
+		}
+		if len(bits) > len(events) {
+			t.Errorf("seed %d: %d bits from %d events", seed, len(bits), len(events))
+		}
+		if uint64(len(bits)) != stats.ValidBits+stats.InvalidBits {
+			t.Errorf("seed %d: %d bits, but ValidBits + InvalidBits = %d", seed, len(bits), stats.ValidBits+stats.InvalidBits)
+		}
+		if want := framedBits(clean.data, clean.order); !endsWith(bits, want) {
+			t.Fatalf("seed %d (%v): bits = %v, want to end with %v", seed, clean, bits, want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package encoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SetPWM is a function type that controls a hardware PWM output: it sets the
+// frequency in Hz and the duty cycle (0..1). A duty cycle of 0 turns the output off.
+type SetPWM func(freqHz int, duty float64) error
+
+var ErrCarrierStopped = errors.New("carrier stopped")
+
+// Carrier is a modulation stage between the encoder and the output pin, e.g. to drive
+// an IR LED directly: a High level is emitted as a burst of the carrier frequency
+// (typically 36–40kHz), a Low level turns the carrier off.
+//
+// Pass its SetValue method to the encoder and let the line idle Low, so the LED is
+// switched off between messages:
+//
+//	carrier, err := encoder.NewPWMCarrier(setPWM, 38000, 0.33)
+//	...
+//	defer carrier.Close()
+//	enc := encoder.New(1000, carrier.SetValue, encoder.WithIdleLevel(encoder.Low))
+//
+// The receiver side is an IR receiver module that demodulates the bursts,
+// see decoder.WithDemodulatedInput.
+type Carrier struct {
+	freqHz   int
+	duty     float64
+	period   time.Duration // Carrier period
+	highTime time.Duration // High time within a carrier period
+
+	setPWM   SetPWM   // Hardware PWM output (NewPWMCarrier only)
+	setValue SetValue // Software-modulated output (NewCarrier only)
+
+	mu      sync.Mutex
+	level   Level // Current envelope level
+	lastErr error // Output error of the software modulator, reported by the next SetValue
+	closed  bool  // Close() has been called
+
+	on        atomic.Bool   // Envelope is High, the software modulator emits the carrier
+	wake      chan struct{} // Starts a burst of the software modulator
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewPWMCarrier creates a carrier stage that switches a hardware PWM output
+// with the given frequency and duty cycle (0..1) on and off.
+func NewPWMCarrier(setPWM SetPWM, freqHz int, duty float64) (*Carrier, error) {
+	c, err := newCarrier(freqHz, duty)
+	if err != nil {
+		return nil, err
+	}
+
+	c.setPWM = setPWM
+	if err := setPWM(freqHz, 0); err != nil {
+		return nil, fmt.Errorf("failed to set PWM: %w", err)
+	}
+	return c, nil
+}
+
+// NewCarrier creates a carrier stage that generates the carrier in software by
+// toggling setValue with the given frequency and duty cycle (0..1).
+//
+// The modulator busy-waits for every carrier edge and occupies one CPU core while
+// a burst is transmitted; prefer NewPWMCarrier if a hardware PWM output is available.
+// The end of a burst is delayed by up to one carrier period, so the last carrier
+// cycle is always complete.
+func NewCarrier(setValue SetValue, freqHz int, duty float64) (*Carrier, error) {
+	c, err := newCarrier(freqHz, duty)
+	if err != nil {
+		return nil, err
+	}
+
+	c.setValue = setValue
+	if err := setValue(Low); err != nil {
+		return nil, fmt.Errorf("failed to set GPIO level: %w", err)
+	}
+
+	c.wake = make(chan struct{}, 1)
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.wg.Add(1)
+	go c.modulate()
+	return c, nil
+}
+
+// newCarrier validates the carrier parameters.
+func newCarrier(freqHz int, duty float64) (*Carrier, error) {
+	if freqHz <= 0 {
+		return nil, fmt.Errorf("carrier frequency must be > 0: %v", freqHz)
+	}
+	if duty <= 0 || duty > 1 {
+		return nil, fmt.Errorf("carrier duty cycle must be between 0 and 1: %v", duty)
+	}
+
+	period := time.Second / time.Duration(freqHz)
+	return &Carrier{
+		freqHz:   freqHz,
+		duty:     duty,
+		period:   period,
+		highTime: time.Duration(float64(period) * duty),
+	}, nil
+}
+
+// SetValue sets the envelope level: High starts a carrier burst, Low ends it.
+// It has the signature of SetValue and is meant to be passed to New.
+func (c *Carrier) SetValue(level Level) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrCarrierStopped
+	}
+	if level == c.level {
+		return c.takeError()
+	}
+	c.level = level
+
+	if c.setPWM != nil {
+		duty := 0.0
+		if level == High {
+			duty = c.duty
+		}
+		return c.setPWM(c.freqHz, duty)
+	}
+
+	c.on.Store(level == High)
+	if level == High {
+		select {
+		case c.wake <- struct{}{}:
+		default:
+		}
+	}
+	return c.takeError()
+}
+
+// Close turns the carrier off and stops the software modulator.
+// It is safe to call Close multiple times.
+func (c *Carrier) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.closed = true
+		c.on.Store(false)
+		c.mu.Unlock()
+
+		if c.setPWM != nil {
+			err = c.setPWM(c.freqHz, 0)
+			return
+		}
+
+		// the modulator finishes its current carrier cycle
+		c.cancel()
+		c.wg.Wait()
+		if err = c.setValue(Low); err == nil {
+			c.mu.Lock()
+			err = c.takeError()
+			c.mu.Unlock()
+		}
+	})
+	return err
+}
+
+// takeError returns and clears the last error of the software modulator.
+// The caller must hold c.mu.
+func (c *Carrier) takeError() error {
+	err := c.lastErr
+	c.lastErr = nil
+	return err
+}
+
+// modulate runs in the background and emits carrier bursts while the envelope is High.
+func (c *Carrier) modulate() {
+	defer c.wg.Done()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-c.wake:
+			c.burst()
+		}
+	}
+}
+
+// burst toggles the output with the carrier frequency until the envelope is Low.
+// Every edge is scheduled against an absolute deadline; after an overrun of more than
+// one carrier period (e.g. preemption) the schedule restarts instead of catching up
+// with shortened cycles.
+func (c *Carrier) burst() {
+	cycle := time.Now()
+	for c.on.Load() && c.ctx.Err() == nil {
+		c.set(High)
+		spinUntil(cycle.Add(c.highTime))
+		c.set(Low)
+
+		cycle = cycle.Add(c.period)
+		spinUntil(cycle)
+		if now := time.Now(); now.Sub(cycle) > c.period {
+			cycle = now
+		}
+	}
+}
+
+// set sets the output level of the software modulator and keeps the first error.
+func (c *Carrier) set(level Level) {
+	if err := c.setValue(level); err != nil {
+		c.mu.Lock()
+		if c.lastErr == nil {
+			c.lastErr = fmt.Errorf("failed to set GPIO level: %w", err)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// spinUntil busy-waits until t; carrier periods are too short for timers.
+func spinUntil(t time.Time) {
+	for time.Now().Before(t) {
+	}
+}
@@ -0,0 +1,130 @@
+package encoder
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPWMCarrier(t *testing.T) {
+	var calls []float64
+	setPWM := func(freqHz int, duty float64) error {
+		if freqHz != 38000 {
+			t.Errorf("SetPWM() frequency = %d, want 38000", freqHz)
+		}
+		calls = append(calls, duty)
+		return nil
+	}
+
+	c, err := NewPWMCarrier(setPWM, 38000, 0.25)
+	if err != nil {
+		t.Fatalf("NewPWMCarrier() error = %v", err)
+	}
+	for _, level := range []Level{High, High, Low, High} {
+		if err := c.SetValue(level); err != nil {
+			t.Fatalf("SetValue(%v) error = %v", level, err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := c.SetValue(High); !errors.Is(err, ErrCarrierStopped) {
+		t.Errorf("SetValue() after Close() error = %v, want %v", err, ErrCarrierStopped)
+	}
+
+	// off, burst, off, burst, off on Close; repeated levels do not touch the PWM
+	want := []float64{0, 0.25, 0, 0.25, 0}
+	if len(calls) != len(want) {
+		t.Fatalf("SetPWM() duty cycles = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("SetPWM() duty cycles = %v, want %v", calls, want)
+		}
+	}
+}
+
+func TestSoftwareCarrier(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		level  Level
+		bursts int // rising edges of the carrier
+	)
+	setValue := func(l Level) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if l == High && level == Low {
+			bursts++
+		}
+		level = l
+		return nil
+	}
+
+	// 1kHz, so the busy-waiting modulator is tolerant to scheduler latency
+	c, err := NewCarrier(setValue, 1000, 0.5)
+	if err != nil {
+		t.Fatalf("NewCarrier() error = %v", err)
+	}
+	start := time.Now()
+	if err := c.SetValue(High); err != nil {
+		t.Fatalf("SetValue() error = %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := c.SetValue(Low); err != nil {
+		t.Fatalf("SetValue() error = %v", err)
+	}
+	elapsed := time.Since(start)
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := int(elapsed / time.Millisecond)
+	if bursts < want*2/3 || bursts > want+2 {
+		t.Errorf("carrier cycles in %v = %d, want about %d", elapsed, bursts, want)
+	}
+	if level != Low {
+		t.Errorf("output level after Close() = %v, want Low", level)
+	}
+}
+
+func TestNewCarrierValidates(t *testing.T) {
+	setValue := func(Level) error { return nil }
+	if _, err := NewCarrier(setValue, 0, 0.5); err == nil {
+		t.Error("NewCarrier() with frequency 0: expected error")
+	}
+	if _, err := NewCarrier(setValue, 38000, 1.5); err == nil {
+		t.Error("NewCarrier() with duty cycle 1.5: expected error")
+	}
+}
+
+func TestWithIdleLevel(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		levels []Level
+	)
+	setValue := func(l Level) error {
+		mu.Lock()
+		defer mu.Unlock()
+		levels = append(levels, l)
+		return nil
+	}
+
+	e := New(2000, setValue, WithoutSync(), WithIdleLevel(Low))
+	// IEEE: the stop bit ends with a High half bit
+	if _, err := e.Send([]byte{0x00}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	e.Wait()
+	time.Sleep(5 * time.Millisecond)
+	e.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	// idle, 10 bits of 2 half bits, idle
+	if len(levels) != 22 || levels[0] != Low || levels[20] != High || levels[21] != Low {
+		t.Errorf("levels = %v, want idle Low around the frame", levels)
+	}
+}
@@ -3,6 +3,13 @@
 // non-blocking writes, and can be used with any GPIO implementation
 // that provides a SetValue(Level) error function.
 //
+// By default the half bits are paced by a time.Ticker. For higher bit rates
+// WithPreciseTiming selects a drift-free engine that schedules every transition
+// against an absolute deadline and reports its timing error via TimingStats().
+//
+// To drive an IR LED directly, a Carrier between the encoder and the output pin
+// emits the High half bits as carrier bursts (e.g. 38kHz).
+//
 // Example usage:
 //
 //	func main() {
@@ -44,8 +51,10 @@ type SetValue func(Level) error
 
 // txByte represents a byte to transmit along with a flag indicating whether to add start/stop bits.
 type txByte struct {
-	b            byte // Byte to transmit
-	addStartStop bool // Add start/stop bits
+	b            byte          // Byte to transmit
+	addStartStop bool          // Add start/stop bits
+	msg          *Transmission // Message the byte belongs to (SendContext only)
+	last         bool          // Last byte of msg, completes the transmission
 }
 
 type Level int
@@ -79,12 +88,16 @@ type Encoder struct {
 	bitOrder           BitOrder           // Order of bits: LSBFirst or MSBFirst
 	syncBytes          int                // Number of 0xFF bytes for synchronization before actual data
 	buffer             chan txByte        // Buffered channel for outgoing txBytes
-	halfBitTicker      *time.Ticker       // Ticker for Manchester half-bit transitions
+	halfBitTimer       halfBitTimer       // Timer for Manchester half-bit transitions
+	preciseTiming      bool               // Use the deadline timer instead of the ticker
+	busyWait           time.Duration      // Busy-wait window of the deadline timer
 	setValue           SetValue           // Function to set the GPIO output level
 	bufferSize         int                // Size of the internal buffer channel
 	manchesterEncoding ManchesterEncoding // Type of Manchester encoding (e.g., IEEE vs. Thomas)
 	encodingTable      [2][2]Level        // Manchester encoding lookup table: [bit][half-step]
 	onError            func(err error)    // Optional error handler callback
+	idle               bool               // Set idleLevel while no data is queued
+	idleLevel          Level              // Output level between transmissions (WithIdleLevel)
 
 	cancel    context.CancelFunc
 	ctx       context.Context
@@ -96,6 +109,27 @@ type Encoder struct {
 
 // New creates a new Manchester encoder with the specified bit clock frequency.
 func New(bitClockHz int, setValue SetValue, opts ...Option) *Encoder {
+	e := newEncoder(bitClockHz, setValue, opts...)
+
+	bitPeriod := time.Second / time.Duration(bitClockHz)
+	if e.preciseTiming {
+		e.halfBitTimer = newDeadlineTimer(bitPeriod/2, e.busyWait)
+	} else {
+		e.halfBitTimer = newTickerTimer(bitPeriod / 2)
+	}
+	e.buffer = make(chan txByte, e.bufferSize)
+	if e.idle {
+		e.setBit(e.idleLevel)
+	}
+
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+	e.wg.Add(1)
+	go e.processTxBytes()
+	return e
+}
+
+// newEncoder creates an Encoder with the given options applied, without starting it.
+func newEncoder(bitClockHz int, setValue SetValue, opts ...Option) *Encoder {
 	if bitClockHz <= 0 {
 		panic("bitClockHz must be > 0")
 	}
@@ -112,14 +146,7 @@ func New(bitClockHz int, setValue SetValue, opts ...Option) *Encoder {
 		opt(e)
 	}
 
-	bitPeriod := time.Second / time.Duration(bitClockHz)
-	e.halfBitTicker = time.NewTicker(bitPeriod / 2)
 	e.encodingTable = encodingTable(e.manchesterEncoding)
-	e.buffer = make(chan txByte, e.bufferSize)
-
-	e.ctx, e.cancel = context.WithCancel(context.Background())
-	e.wg.Add(1)
-	go e.processTxBytes()
 	return e
 }
 
@@ -170,6 +197,34 @@ func WithManchesterEncoding(enc ManchesterEncoding) Option {
 	}
 }
 
+// WithPreciseTiming selects the precise timing engine.
+//
+// Instead of a ticker, every half-bit transition is scheduled against an absolute
+// deadline relative to the start of the burst, so scheduling latency does not
+// accumulate. The encoder sleeps until busyWait before the deadline and spins for the
+// remaining time; a larger window improves accuracy at the cost of CPU time.
+// A negative busyWait selects the default window of 1ms, 0 disables busy-waiting.
+func WithPreciseTiming(busyWait time.Duration) Option {
+	return func(e *Encoder) {
+		e.preciseTiming = true
+		e.busyWait = busyWait
+		if busyWait < 0 {
+			e.busyWait = defaultBusyWait
+		}
+	}
+}
+
+// WithIdleLevel sets the output to level when the encoder starts and whenever the
+// transmission buffer runs empty after a transmission. Without this option the output
+// keeps the level of the last half bit. Use Low with a Carrier, so the carrier is off
+// between messages.
+func WithIdleLevel(level Level) Option {
+	return func(e *Encoder) {
+		e.idle = true
+		e.idleLevel = level
+	}
+}
+
 // Close gracefully shuts down the encoder.
 // It is safe to call Close multiple times.
 func (e *Encoder) Close() error {
@@ -187,8 +242,8 @@ func (e *Encoder) Close() error {
 		// Wait for background goroutine to finish
 		e.wg.Wait()
 
-		// Stop ticker after goroutine finished
-		e.halfBitTicker.Stop()
+		// Stop timer after goroutine finished
+		e.halfBitTimer.stop()
 	})
 	return nil
 }
@@ -198,33 +253,84 @@ func (e *Encoder) Wait() {
 	e.wgBytes.Wait() // block until all bytes fully transmitted
 }
 
+// TimingStats returns the measured timing error of the transmitted half-bit transitions.
+// The statistics are only collected with WithPreciseTiming; otherwise all values are zero.
+// It is safe to call from another goroutine.
+func (e *Encoder) TimingStats() TimingStats {
+	return e.halfBitTimer.stats()
+}
+
 // Send places data into the transmission buffer.
 // It blocks if the buffer is full and returns ErrEncoderStopped if Close() was called.
 func (e *Encoder) Send(data []byte) (int, error) {
+	if err := e.enqueue(context.Background(), data, nil); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// SendContext places data into the transmission buffer like Send, but gives up when
+// ctx is done while waiting for buffer space. In this case ctx.Err() is returned and
+// the bytes of the message that have not been transmitted yet are discarded.
+//
+// The returned Transmission completes when this particular message has been fully
+// clocked out, independent of other messages in the queue:
+//
+//	tx, err := enc.SendContext(ctx, request)
+//	if err != nil {
+//	    return err
+//	}
+//	if err := tx.Wait(ctx); err != nil {
+//	    return err
+//	}
+func (e *Encoder) SendContext(ctx context.Context, data []byte) (*Transmission, error) {
+	msg := newTransmission()
+	if err := e.enqueue(ctx, data, msg); err != nil {
+		msg.cancelled.Store(true)
+		return nil, err
+	}
+	return msg, nil
+}
+
+// enqueue places the sync bytes and data into the transmission buffer.
+// The last byte carries msg, so the encoder can complete the transmission.
+func (e *Encoder) enqueue(ctx context.Context, data []byte, msg *Transmission) error {
 	e.writeMutex.Lock()
 	defer e.writeMutex.Unlock()
 
-	// Send sync bytes
-	for i := 0; i < e.syncBytes; i++ {
-		select {
-		case e.buffer <- txByte{b: 0xff, addStartStop: false}:
-			e.wgBytes.Add(1)
-		case <-e.ctx.Done():
-			return 0, ErrEncoderStopped
-		}
+	// Close() cancels the context before it closes the buffer while holding writeMutex,
+	// so the buffer is still open as long as the context is not cancelled.
+	if e.ctx.Err() != nil {
+		return ErrEncoderStopped
+	}
+
+	n := e.syncBytes + len(data)
+	if msg != nil && n == 0 {
+		// nothing to transmit
+		msg.complete(nil)
+		return nil
 	}
 
-	// Send data bytes
-	for _, b := range data {
+	for i := 0; i < n; i++ {
+		tx := txByte{b: 0xff, addStartStop: false, msg: msg, last: i == n-1}
+		if i >= e.syncBytes {
+			tx.b, tx.addStartStop = data[i-e.syncBytes], true
+		}
+
+		// Add before the send, otherwise processTxBytes() may call Done() first and Wait() returns too early.
+		e.wgBytes.Add(1)
 		select {
-		case e.buffer <- txByte{b: b, addStartStop: true}:
-			e.wgBytes.Add(1)
+		case e.buffer <- tx:
 		case <-e.ctx.Done():
-			return 0, ErrEncoderStopped
+			e.wgBytes.Done()
+			return ErrEncoderStopped
+		case <-ctx.Done():
+			e.wgBytes.Done()
+			return ctx.Err()
 		}
 	}
 
-	return len(data), nil
+	return nil
 }
 
 // encodeByte encodes a single byte and transmits it with optional start/stop bits.
@@ -262,10 +368,8 @@ func (e *Encoder) encodeBit(bit byte) {
 	for _, v := range e.encodingTable[bit] {
 		e.setBit(v)
 
-		select {
-		case <-e.ctx.Done():
+		if !e.halfBitTimer.wait(e.ctx) {
 			return
-		case <-e.halfBitTicker.C:
 		}
 	}
 }
@@ -284,12 +388,22 @@ func (e *Encoder) processTxBytes() {
 
 	defer e.wg.Done()
 
+	busy := false // bytes have been transmitted since the line was idle
 	for {
+		if len(e.buffer) == 0 {
+			// the line goes idle until the next Send(); a new burst starts a new schedule
+			e.halfBitTimer.reset()
+			if e.idle && busy {
+				e.setBit(e.idleLevel)
+			}
+			busy = false
+		}
+
 		select {
 		case <-e.ctx.Done():
 			// drain remaining bytes without transmitting them
-			for range e.buffer {
-				e.wgBytes.Done()
+			for tx := range e.buffer {
+				e.completeByte(tx, ErrEncoderStopped)
 			}
 			return
 		case tx, open := <-e.buffer:
@@ -297,12 +411,32 @@ func (e *Encoder) processTxBytes() {
 				return
 			}
 
+			if tx.msg != nil && tx.msg.cancelled.Load() {
+				// skip the remaining bytes of a message cancelled by SendContext
+				e.wgBytes.Done()
+				continue
+			}
+
 			e.encodeByte(tx.b, tx.addStartStop)
-			e.wgBytes.Done() // mark this byte as fully transmitted
+			busy = true
+			if e.ctx.Err() != nil {
+				// Close() interrupted the byte
+				e.completeByte(tx, ErrEncoderStopped)
+				continue
+			}
+			e.completeByte(tx, nil) // mark this byte as fully transmitted
 		}
 	}
 }
 
+// completeByte marks a byte as processed and completes its message after the last byte.
+func (e *Encoder) completeByte(tx txByte, err error) {
+	if tx.last && tx.msg != nil {
+		tx.msg.complete(err)
+	}
+	e.wgBytes.Done()
+}
+
 // encodingTable returns the Manchester encoding lookup table for the given encoding type.
 func encodingTable(code ManchesterEncoding) [2][2]Level {
 	switch code {
@@ -0,0 +1,25 @@
+package encoder
+
+import (
+	"github.com/womat/golib/gpio"
+)
+
+// ToPin creates a new Manchester encoder that drives the given GPIO output pin.
+// Encoder levels map directly to gpio levels (Low → gpio.Low, High → gpio.High).
+//
+// The pin stays owned by the caller: Close() stops the encoder but does not close the pin.
+//
+//	pin, err := rpi.NewPin(21, rpi.WithMode(gpio.Output))
+//	...
+//	enc := encoder.ToPin(pin, 50, encoder.WithSyncBytes(2))
+//	defer enc.Close()
+func ToPin(pin gpio.Pin, bitClockHz int, opts ...Option) *Encoder {
+	return New(bitClockHz, PinSetValue(pin), opts...)
+}
+
+// PinSetValue returns a SetValue function that sets the level of the given GPIO pin.
+func PinSetValue(pin gpio.Pin) SetValue {
+	return func(level Level) error {
+		return pin.SetValue(gpio.Level(level))
+	}
+}
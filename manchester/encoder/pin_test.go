@@ -0,0 +1,53 @@
+package encoder
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/womat/golib/gpio"
+)
+
+// levelPin is a gpio.Pin that records the levels set by the encoder.
+type levelPin struct {
+	gpio.Pin // not implemented, only SetValue is used
+
+	mu     sync.Mutex
+	levels []gpio.Level
+}
+
+func (p *levelPin) SetValue(level gpio.Level) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.levels = append(p.levels, level)
+	return nil
+}
+
+func TestToPin(t *testing.T) {
+	const bitClockHz = 10000
+	data := []byte{0x5a}
+	pin := &levelPin{}
+
+	enc := ToPin(pin, bitClockHz, WithSyncBytes(1))
+	if _, err := enc.Send(data); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	enc.Wait()
+	_ = enc.Close()
+
+	// the pin receives one level per half bit, as the offline rendered waveform
+	rec := NewRecorder(bitClockHz, time.Unix(0, 0))
+	for _, level := range pin.levels {
+		_ = rec.SetValue(Level(level))
+	}
+	got := rec.Transitions()
+	want := Render(bitClockHz, data, time.Unix(0, 0), WithSyncBytes(1)).Transitions()
+	if len(got) != len(want) {
+		t.Fatalf("got %d transitions, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("transition %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
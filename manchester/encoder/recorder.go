@@ -0,0 +1,94 @@
+package encoder
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Transition is a change of the output level at its ideal point in time.
+type Transition struct {
+	Time  time.Time // Time of the level change
+	Level Level     // Level after the change
+}
+
+// Recorder is a SetValue sink that records the encoder output without hardware.
+//
+// Every call to SetValue is one half bit, so the timestamps are derived from the
+// number of recorded half bits instead of the wall clock: the waveform is ideal,
+// independent of scheduling latency. Gaps between messages are not recorded.
+//
+//	rec := encoder.NewRecorder(50, time.Now())
+//	enc := encoder.New(50, rec.SetValue)
+type Recorder struct {
+	mu          sync.Mutex
+	start       time.Time     // Time of the first half bit
+	halfBit     time.Duration // Duration of a half bit
+	halfBits    int           // Number of recorded half bits
+	transitions []Transition  // Recorded level changes
+}
+
+// NewRecorder creates a Recorder for the given bit clock with the first half bit at start.
+func NewRecorder(bitClockHz int, start time.Time) *Recorder {
+	if bitClockHz <= 0 {
+		panic("bitClockHz must be > 0")
+	}
+	return &Recorder{
+		start:   start,
+		halfBit: time.Second / time.Duration(bitClockHz) / 2,
+	}
+}
+
+// SetValue records the level of the next half bit. It implements the SetValue function type.
+func (r *Recorder) SetValue(level Level) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if n := len(r.transitions); n == 0 || r.transitions[n-1].Level != level {
+		t := r.start.Add(time.Duration(r.halfBits) * r.halfBit)
+		r.transitions = append(r.transitions, Transition{Time: t, Level: level})
+	}
+	r.halfBits++
+	return nil
+}
+
+// Transitions returns a copy of the recorded level changes. The first entry
+// is the initial level at the start time.
+func (r *Recorder) Transitions() []Transition {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Transition(nil), r.transitions...)
+}
+
+// End returns the end time of the last recorded half bit.
+func (r *Recorder) End() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.start.Add(time.Duration(r.halfBits) * r.halfBit)
+}
+
+// Render encodes data offline and returns a Recorder with the ideal waveform starting
+// at start. It accepts the same options as New and emits the same sync bytes and
+// start/stop bits, but runs synchronously without pacing in real time.
+func Render(bitClockHz int, data []byte, start time.Time, opts ...Option) *Recorder {
+	rec := NewRecorder(bitClockHz, start)
+	e := newEncoder(bitClockHz, rec.SetValue, opts...)
+	e.halfBitTimer = immediateTimer{}
+	e.ctx = context.Background()
+
+	for i := 0; i < e.syncBytes; i++ {
+		e.encodeByte(0xff, false)
+	}
+	for _, b := range data {
+		e.encodeByte(b, true)
+	}
+	return rec
+}
+
+// immediateTimer does not wait at all; the Recorder derives the timestamps itself.
+type immediateTimer struct{}
+
+func (immediateTimer) wait(context.Context) bool { return true }
+func (immediateTimer) reset()                    {}
+func (immediateTimer) stats() TimingStats        { return TimingStats{} }
+func (immediateTimer) stop()                     {}
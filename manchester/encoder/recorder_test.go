@@ -0,0 +1,38 @@
+package encoder
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecorderMatchesRender(t *testing.T) {
+	start := time.Unix(0, 0)
+	data := []byte("ok")
+
+	rec := NewRecorder(2000, start)
+	e := New(2000, rec.SetValue, WithSyncBytes(1), WithBitOrder(MSBFirst))
+	if _, err := e.Send(data); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	e.Wait()
+	_ = e.Close()
+
+	want := Render(2000, data, start, WithSyncBytes(1), WithBitOrder(MSBFirst))
+	got := rec.Transitions()
+	if len(got) == 0 || len(got) != len(want.Transitions()) {
+		t.Fatalf("got %d transitions, want %d", len(got), len(want.Transitions()))
+	}
+	for i, tr := range want.Transitions() {
+		if got[i] != tr {
+			t.Fatalf("transition %d = %+v, want %+v", i, got[i], tr)
+		}
+	}
+
+	// 8 sync bits and 2 * 10 data bits, each bit lasts 500µs
+	if d := rec.End().Sub(start); d != 28*500*time.Microsecond {
+		t.Errorf("End() - start = %v, want %v", d, 28*500*time.Microsecond)
+	}
+	if got[0].Time != start {
+		t.Errorf("first transition at %v, want %v", got[0].Time, start)
+	}
+}
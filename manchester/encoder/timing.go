@@ -0,0 +1,139 @@
+package encoder
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultBusyWait is the default time before a deadline in which the precise timer spins
+// instead of sleeping. It covers the typical wake-up latency of the Go scheduler and OS timers.
+const defaultBusyWait = time.Millisecond
+
+// TimingStats contains the measured timing error of the half-bit transitions.
+// It is only collected by the precise timing engine (see WithPreciseTiming).
+type TimingStats struct {
+	Transitions uint64        // Number of timed half-bit transitions
+	MeanError   time.Duration // Mean delay of the transitions behind their deadline
+	MaxError    time.Duration // Maximum delay of a transition behind its deadline
+	Overruns    uint64        // Number of transitions delayed by more than a half bit (schedule restarted)
+}
+
+// halfBitTimer waits for the end of the current half bit.
+type halfBitTimer interface {
+	// wait blocks until the next half-bit transition is due.
+	// It returns false if ctx is cancelled while waiting.
+	wait(ctx context.Context) bool
+	// reset marks the line as idle; the next transition starts a new burst.
+	reset()
+	stats() TimingStats
+	stop()
+}
+
+// tickerTimer paces the half bits with a time.Ticker (default engine).
+// Scheduler latency and dropped ticks directly distort the waveform.
+type tickerTimer struct {
+	ticker *time.Ticker
+}
+
+func newTickerTimer(halfBit time.Duration) *tickerTimer {
+	return &tickerTimer{ticker: time.NewTicker(halfBit)}
+}
+
+func (t *tickerTimer) wait(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.ticker.C:
+		return true
+	}
+}
+
+func (t *tickerTimer) reset() {}
+
+func (t *tickerTimer) stats() TimingStats { return TimingStats{} }
+
+func (t *tickerTimer) stop() { t.ticker.Stop() }
+
+// deadlineTimer schedules every transition against an absolute deadline derived from the
+// start of the burst, so latency of a single transition does not accumulate (drift-free).
+// It sleeps until shortly before the deadline and busy-waits for the remaining time.
+type deadlineTimer struct {
+	halfBit  time.Duration
+	busyWait time.Duration
+	last     time.Time // deadline of the previous transition
+
+	mu          sync.Mutex
+	transitions uint64
+	errorSum    time.Duration
+	maxError    time.Duration
+	overruns    uint64
+}
+
+func newDeadlineTimer(halfBit, busyWait time.Duration) *deadlineTimer {
+	return &deadlineTimer{halfBit: halfBit, busyWait: busyWait}
+}
+
+func (t *deadlineTimer) wait(ctx context.Context) bool {
+	now := time.Now()
+
+	// Start a new schedule at the first transition of a burst or if we are more
+	// than a half bit behind the previous deadline, i.e. this deadline has passed.
+	overrun := !t.last.IsZero() && now.Sub(t.last) > t.halfBit
+	if t.last.IsZero() || overrun {
+		t.last = now
+	}
+	deadline := t.last.Add(t.halfBit)
+	t.last = deadline
+
+	if sleep := time.Until(deadline) - t.busyWait; sleep > 0 {
+		timer := time.NewTimer(sleep)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+
+	for time.Now().Before(deadline) {
+		// busy-wait for the final microseconds
+	}
+
+	t.record(time.Since(deadline), overrun)
+	return ctx.Err() == nil
+}
+
+func (t *deadlineTimer) reset() {
+	t.last = time.Time{}
+}
+
+// record updates the timing statistics with the delay of a transition.
+func (t *deadlineTimer) record(delay time.Duration, overrun bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.transitions++
+	t.errorSum += delay
+	t.maxError = max(t.maxError, delay)
+	if overrun {
+		t.overruns++
+	}
+}
+
+func (t *deadlineTimer) stats() TimingStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := TimingStats{
+		Transitions: t.transitions,
+		MaxError:    t.maxError,
+		Overruns:    t.overruns,
+	}
+	if t.transitions > 0 {
+		s.MeanError = t.errorSum / time.Duration(t.transitions)
+	}
+	return s
+}
+
+func (t *deadlineTimer) stop() {}
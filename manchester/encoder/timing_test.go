@@ -0,0 +1,117 @@
+package encoder
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// skipIfLoaded skips a timing test if the runner wakes up a sleeping goroutine more
+// than maxLate late, e.g. on an overloaded CI machine.
+func skipIfLoaded(t *testing.T, maxLate time.Duration) {
+	t.Helper()
+	const sleep = 100 * time.Microsecond
+	for range 20 {
+		start := time.Now()
+		time.Sleep(sleep)
+		if late := time.Since(start) - sleep; late > maxLate {
+			t.Skipf("runner too slow for precise timing: sleep woke up %v late", late)
+		}
+	}
+}
+
+func TestPreciseTiming(t *testing.T) {
+	const bitClockHz = 200
+	halfBit := time.Second / bitClockHz / 2
+
+	// the busy-wait absorbs a late wake-up; more than half a bit later the deadline is missed
+	skipIfLoaded(t, defaultBusyWait+halfBit/2)
+
+	var mu sync.Mutex
+	var times []time.Time
+	setValue := func(Level) error {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		return nil
+	}
+
+	e := New(bitClockHz, setValue, WithoutSync(), WithPreciseTiming(-1))
+	defer e.Close()
+
+	data := []byte("drift-free")
+	if _, err := e.Send(data); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	e.Wait()
+
+	// every bit (8 data bits + start/stop bit) sets two half-bit levels
+	wantTransitions := len(data) * 10 * 2
+	stats := e.TimingStats()
+	if stats.Transitions != uint64(wantTransitions) {
+		t.Errorf("Transitions = %d, want %d", stats.Transitions, wantTransitions)
+	}
+	if stats.MeanError > stats.MaxError {
+		t.Errorf("MeanError %v > MaxError %v", stats.MeanError, stats.MaxError)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(times) != wantTransitions {
+		t.Fatalf("got %d level changes, want %d", len(times), wantTransitions)
+	}
+
+	if stats.Overruns != 0 {
+		t.Errorf("Overruns = %d, want 0", stats.Overruns)
+	}
+
+	// The schedule is absolute, so the total duration must not drift even if single
+	// transitions are late.
+	got := times[len(times)-1].Sub(times[0])
+	want := time.Duration(wantTransitions-1) * halfBit
+	if d := got - want; d < -halfBit/5 || d > halfBit/5 {
+		t.Errorf("burst duration = %v, want %v ± %v", got, want, halfBit/5)
+	}
+}
+
+func TestDeadlineTimerOverrun(t *testing.T) {
+	const halfBit = 20 * time.Millisecond
+
+	tests := []struct {
+		late    time.Duration // delay behind the previous deadline
+		overrun bool
+	}{
+		{0, false},
+		{halfBit / 2, false},
+		{halfBit * 3 / 2, true},
+		{halfBit * 5 / 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.late.String(), func(t *testing.T) {
+			timer := newDeadlineTimer(halfBit, 0)
+			timer.last = time.Now().Add(-tt.late)
+			if !timer.wait(context.Background()) {
+				t.Fatal("wait() = false")
+			}
+			if got := timer.stats().Overruns == 1; got != tt.overrun {
+				t.Errorf("overrun = %v, want %v", got, tt.overrun)
+			}
+		})
+	}
+}
+
+func TestTickerTimingStats(t *testing.T) {
+	e := New(1000, func(Level) error { return nil }, WithoutSync())
+	defer e.Close()
+
+	if _, err := e.Send([]byte{0x55}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	e.Wait()
+
+	if s := e.TimingStats(); s != (TimingStats{}) {
+		t.Errorf("TimingStats() = %+v, want zero value for the ticker engine", s)
+	}
+}
@@ -0,0 +1,53 @@
+package encoder
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Transmission tracks a single message queued with SendContext.
+// It completes when the last byte of the message has been fully clocked out,
+// or when the message has been discarded because the encoder was closed.
+type Transmission struct {
+	done      chan struct{}
+	err       error       // set before done is closed
+	cancelled atomic.Bool // bytes of a cancelled message are skipped by the encoder
+}
+
+func newTransmission() *Transmission {
+	return &Transmission{done: make(chan struct{})}
+}
+
+// Done returns a channel that is closed when the transmission has completed.
+func (t *Transmission) Done() <-chan struct{} {
+	return t.done
+}
+
+// Err returns nil if the message has been transmitted completely, or ErrEncoderStopped
+// if the encoder was closed before. It returns nil while the transmission is pending.
+func (t *Transmission) Err() error {
+	select {
+	case <-t.done:
+		return t.err
+	default:
+		return nil
+	}
+}
+
+// Wait blocks until the message has been transmitted or ctx is done.
+// It returns the transmission error or ctx.Err() on timeout/cancellation;
+// a timeout does not abort the transmission itself.
+func (t *Transmission) Wait(ctx context.Context) error {
+	select {
+	case <-t.done:
+		return t.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// complete marks the transmission as finished with the given error.
+func (t *Transmission) complete(err error) {
+	t.err = err
+	close(t.done)
+}
@@ -0,0 +1,106 @@
+package encoder
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSendContextCompletion(t *testing.T) {
+	var levels atomic.Int64
+	e := New(2000, func(Level) error { levels.Add(1); return nil }, WithoutSync())
+	defer e.Close()
+
+	first, err := e.SendContext(context.Background(), []byte{0x01})
+	if err != nil {
+		t.Fatalf("SendContext() error = %v", err)
+	}
+	second, err := e.SendContext(context.Background(), []byte{0x02, 0x03, 0x04, 0x05})
+	if err != nil {
+		t.Fatalf("SendContext() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := first.Wait(ctx); err != nil {
+		t.Fatalf("first.Wait() error = %v", err)
+	}
+
+	// the first message is complete after its 10 bits, the second one is still on the line
+	if n := levels.Load(); n < 20 || n >= 100 {
+		t.Errorf("levels set after first message = %d, want 20..99", n)
+	}
+	select {
+	case <-second.Done():
+		t.Errorf("second message completed together with the first one")
+	default:
+	}
+
+	if err := second.Wait(ctx); err != nil {
+		t.Fatalf("second.Wait() error = %v", err)
+	}
+	if n := levels.Load(); n != 100 {
+		t.Errorf("levels set after second message = %d, want 100", n)
+	}
+	if err := second.Err(); err != nil {
+		t.Errorf("second.Err() = %v, want nil", err)
+	}
+}
+
+func TestSendContextCancellation(t *testing.T) {
+	e := New(100, func(Level) error { return nil }, WithoutSync(), WithBufferSize(1))
+	defer e.Close()
+
+	// the buffer holds a single byte, so queueing blocks until the timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	tx, err := e.SendContext(ctx, make([]byte, 10))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("SendContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if tx != nil {
+		t.Errorf("SendContext() returned a transmission on error")
+	}
+
+	// the remaining bytes of the cancelled message are skipped
+	done := make(chan struct{})
+	go func() {
+		e.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Wait() did not return after a cancelled message")
+	}
+}
+
+func TestTransmissionAfterClose(t *testing.T) {
+	e := New(10, func(Level) error { return nil }, WithoutSync())
+
+	tx, err := e.SendContext(context.Background(), []byte("stopped"))
+	if err != nil {
+		t.Fatalf("SendContext() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := tx.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := tx.Err(); err != nil {
+		t.Errorf("Err() of a pending transmission = %v, want nil", err)
+	}
+
+	_ = e.Close()
+	<-tx.Done()
+	if err := tx.Err(); !errors.Is(err, ErrEncoderStopped) {
+		t.Errorf("Err() = %v, want %v", err, ErrEncoderStopped)
+	}
+
+	if _, err := e.SendContext(context.Background(), []byte{0}); !errors.Is(err, ErrEncoderStopped) {
+		t.Errorf("SendContext() after Close() error = %v, want %v", err, ErrEncoderStopped)
+	}
+}
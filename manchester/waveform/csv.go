@@ -0,0 +1,82 @@
+package waveform
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/womat/golib/gpio"
+)
+
+// ReadCSV reads samples from CSV data with the time in seconds in the first column
+// and the level in the second column; further columns are ignored.
+//
+// Levels are numbers: values >= threshold are High, e.g. 0.5 for logic exports with
+// 0/1 levels or 1.65 for oscilloscope exports of a 3.3V signal. Header rows and
+// comment rows (starting with ';' or '#') are skipped. The offsets are relative to the
+// first sample, so captures with negative trigger times are supported.
+func ReadCSV(r io.Reader, threshold float64) ([]Sample, error) {
+	var samples []Sample
+	var first float64
+
+	scanner := bufio.NewScanner(r)
+	for line := 0; scanner.Scan(); {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, ";") || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ';' || r == '\t' })
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("csv line %d: expected time and level: %q", line, text)
+		}
+
+		t, err := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64)
+		if err != nil {
+			if len(samples) == 0 {
+				continue // header row
+			}
+			return nil, fmt.Errorf("csv line %d: invalid time: %w", line, err)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d: invalid level: %w", line, err)
+		}
+
+		if len(samples) == 0 {
+			first = t
+		}
+		level := gpio.Low
+		if v >= threshold {
+			level = gpio.High
+		}
+		samples = append(samples, Sample{
+			Offset: time.Duration(math.Round((t - first) * float64(time.Second))),
+			Level:  level,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read csv: %w", err)
+	}
+
+	return Compact(samples), nil
+}
+
+// WriteCSV writes the samples as "time,level" rows with the time in seconds.
+func WriteCSV(w io.Writer, samples []Sample) error {
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintln(bw, "time,level"); err != nil {
+		return err
+	}
+	for _, s := range samples {
+		if _, err := fmt.Fprintf(bw, "%.9f,%d\n", s.Offset.Seconds(), s.Level); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
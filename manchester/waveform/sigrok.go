@@ -0,0 +1,246 @@
+package waveform
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/womat/golib/gpio"
+)
+
+// ReadSigrok reads the samples of a single logic channel from a sigrok session
+// file (.sr, as saved by PulseView or sigrok-cli). If channel is empty, the first
+// channel is used. The session is a zip archive, hence the io.ReaderAt and size.
+func ReadSigrok(r io.ReaderAt, size int64, channel string) ([]Sample, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("sigrok: %w", err)
+	}
+
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	meta, ok := files["metadata"]
+	if !ok {
+		return nil, fmt.Errorf("sigrok: metadata not found")
+	}
+	device, err := readSigrokMetadata(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	captureFile := device["capturefile"]
+	if captureFile == "" {
+		return nil, fmt.Errorf("sigrok: no logic capture file in metadata")
+	}
+	rate, err := parseSampleRate(device["samplerate"])
+	if err != nil {
+		return nil, err
+	}
+	unitSize, err := strconv.Atoi(device["unitsize"])
+	if err != nil || unitSize <= 0 {
+		return nil, fmt.Errorf("sigrok: invalid unitsize %q", device["unitsize"])
+	}
+
+	// probes are numbered from 1, bit n-1 of each sample holds probe n
+	probe := 0
+	for n := 1; ; n++ {
+		name, ok := device["probe"+strconv.Itoa(n)]
+		if !ok {
+			break
+		}
+		if channel == "" || name == channel {
+			probe = n
+			break
+		}
+	}
+	if probe == 0 || probe > unitSize*8 {
+		return nil, fmt.Errorf("sigrok: %w: %q", ErrSignalNotFound, channel)
+	}
+	byteIndex, mask := (probe-1)/8, byte(1)<<((probe-1)%8)
+
+	// the samples are stored in chunks <capturefile>-1, <capturefile>-2, ... or in a single file
+	var chunks []*zip.File
+	for n := 1; ; n++ {
+		f, ok := files[captureFile+"-"+strconv.Itoa(n)]
+		if !ok {
+			break
+		}
+		chunks = append(chunks, f)
+	}
+	if f, ok := files[captureFile]; ok && len(chunks) == 0 {
+		chunks = append(chunks, f)
+	}
+
+	var samples []Sample
+	var n int64
+	unit := make([]byte, unitSize)
+	for _, chunk := range chunks {
+		rc, err := chunk.Open()
+		if err != nil {
+			return nil, fmt.Errorf("sigrok: %w", err)
+		}
+		br := bufio.NewReader(rc)
+		for {
+			if _, err := io.ReadFull(br, unit); err != nil {
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					break
+				}
+				rc.Close()
+				return nil, fmt.Errorf("sigrok: %w", err)
+			}
+			level := gpio.Low
+			if unit[byteIndex]&mask != 0 {
+				level = gpio.High
+			}
+			if len(samples) == 0 || samples[len(samples)-1].Level != level {
+				samples = append(samples, Sample{Offset: sampleOffset(n, rate), Level: level})
+			}
+			n++
+		}
+		rc.Close()
+	}
+
+	return samples, nil
+}
+
+// WriteSigrok writes the samples as a sigrok session file with a single logic
+// channel, sampled at sampleRate Hz. Level changes between two sample points
+// are moved to the next sample point.
+func WriteSigrok(w io.Writer, samples []Sample, sampleRate int64, channel string) error {
+	if sampleRate <= 0 {
+		return fmt.Errorf("sigrok: sample rate must be > 0")
+	}
+	if channel == "" {
+		channel = "D0"
+	}
+
+	archive := zip.NewWriter(w)
+	write := func(name, content string) error {
+		f, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, content)
+		return err
+	}
+
+	if err := write("version", "2"); err != nil {
+		return err
+	}
+	metadata := "[global]\n" +
+		"sigrok version=0.5.2\n\n" +
+		"[device 1]\n" +
+		"capturefile=logic-1\n" +
+		"total probes=1\n" +
+		"samplerate=" + formatSampleRate(sampleRate) + "\n" +
+		"total analog=0\n" +
+		"probe1=" + channel + "\n" +
+		"unitsize=1\n"
+	if err := write("metadata", metadata); err != nil {
+		return err
+	}
+
+	f, err := archive.Create("logic-1-1")
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	var n int64
+	for i, s := range samples {
+		// the level lasts until the next sample, the last level for a single sample point
+		end := n + 1
+		if i+1 < len(samples) {
+			end = sampleIndex(samples[i+1].Offset, sampleRate)
+		}
+		for ; n < end; n++ {
+			if err := bw.WriteByte(byte(s.Level & 1)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// readSigrokMetadata returns the keys of the [device 1] section of the metadata file.
+func readSigrokMetadata(f *zip.File) (map[string]string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("sigrok: %w", err)
+	}
+	defer rc.Close()
+
+	device := map[string]string{}
+	var section string
+	scanner := bufio.NewScanner(rc)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "["):
+			section = strings.Trim(line, "[]")
+		case section == "device 1":
+			if key, value, ok := strings.Cut(line, "="); ok {
+				device[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("sigrok: read metadata: %w", err)
+	}
+	return device, nil
+}
+
+// parseSampleRate parses sample rates such as "1 MHz", "500kHz", "20 Hz" or "1000000".
+func parseSampleRate(s string) (int64, error) {
+	number := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "Hz"))
+	factor := 1.0
+	switch {
+	case strings.HasSuffix(number, "k"):
+		factor, number = 1e3, strings.TrimSuffix(number, "k")
+	case strings.HasSuffix(number, "M"):
+		factor, number = 1e6, strings.TrimSuffix(number, "M")
+	case strings.HasSuffix(number, "G"):
+		factor, number = 1e9, strings.TrimSuffix(number, "G")
+	}
+
+	v, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || v*factor < 1 {
+		return 0, fmt.Errorf("sigrok: invalid samplerate %q", s)
+	}
+	return int64(v * factor), nil
+}
+
+// formatSampleRate formats a sample rate the way sigrok writes it, e.g. "1 MHz".
+func formatSampleRate(hz int64) string {
+	switch {
+	case hz%1_000_000_000 == 0:
+		return fmt.Sprintf("%d GHz", hz/1_000_000_000)
+	case hz%1_000_000 == 0:
+		return fmt.Sprintf("%d MHz", hz/1_000_000)
+	case hz%1_000 == 0:
+		return fmt.Sprintf("%d kHz", hz/1_000)
+	default:
+		return fmt.Sprintf("%d Hz", hz)
+	}
+}
+
+// sampleOffset returns the offset of the n-th sample at the given sample rate.
+func sampleOffset(n, rate int64) time.Duration {
+	return time.Duration(n/rate)*time.Second + time.Duration(n%rate)*time.Second/time.Duration(rate)
+}
+
+// sampleIndex returns the index of the first sample point at or after offset.
+func sampleIndex(offset time.Duration, rate int64) int64 {
+	sec, rem := int64(offset/time.Second), int64(offset%time.Second)
+	return sec*rate + (rem*rate+int64(time.Second)-1)/int64(time.Second)
+}
@@ -0,0 +1,165 @@
+package waveform
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/womat/golib/gpio"
+)
+
+// ErrSignalNotFound is returned if the requested signal does not exist in a capture.
+var ErrSignalNotFound = errors.New("waveform: signal not found")
+
+// ReadVCD reads the samples of a single signal from a Value Change Dump.
+// If signal is empty, the first 1-bit signal is used. Unknown (x) and
+// high-impedance (z) values are ignored.
+func ReadVCD(r io.Reader, signal string) ([]Sample, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	scanner.Split(bufio.ScanWords)
+
+	next := func() (string, bool) {
+		if !scanner.Scan() {
+			return "", false
+		}
+		return scanner.Text(), true
+	}
+
+	// section returns all tokens up to the next $end
+	section := func() []string {
+		var tokens []string
+		for tok, ok := next(); ok && tok != "$end"; tok, ok = next() {
+			tokens = append(tokens, tok)
+		}
+		return tokens
+	}
+
+	timescale := time.Nanosecond
+	var id string
+	var now time.Duration
+	var samples []Sample
+
+	for tok, ok := next(); ok; tok, ok = next() {
+		switch {
+		case tok == "$timescale":
+			ts, err := parseTimescale(strings.Join(section(), ""))
+			if err != nil {
+				return nil, err
+			}
+			timescale = ts
+
+		case tok == "$var":
+			// $var <type> <size> <id> <reference> [bit range] $end
+			v := section()
+			if id == "" && len(v) >= 4 && v[1] == "1" && (signal == "" || v[3] == signal) {
+				id = v[2]
+			}
+
+		case tok == "$dumpvars", tok == "$dumpall", tok == "$dumpon", tok == "$dumpoff", tok == "$end":
+			// value changes inside these sections are processed like all others
+
+		case strings.HasPrefix(tok, "$"):
+			section() // $date, $version, $comment, $scope, $upscope, $enddefinitions
+
+		case strings.HasPrefix(tok, "#"):
+			t, err := strconv.ParseInt(tok[1:], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("vcd: invalid timestamp %q: %w", tok, err)
+			}
+			now = time.Duration(t) * timescale
+
+		case tok[0] == 'b' || tok[0] == 'B' || tok[0] == 'r' || tok[0] == 'R':
+			// vector or real value change: <value> <id>
+			ref, _ := next()
+			if id != "" && ref == id && (tok[0] == 'b' || tok[0] == 'B') {
+				samples = appendVCDValue(samples, now, tok[len(tok)-1])
+			}
+
+		default:
+			// scalar value change: <value><id>
+			if id != "" && tok[1:] == id {
+				samples = appendVCDValue(samples, now, tok[0])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read vcd: %w", err)
+	}
+	if id == "" {
+		return nil, fmt.Errorf("vcd: %w: %q", ErrSignalNotFound, signal)
+	}
+
+	// offsets are relative to the first value of the signal
+	for i := len(samples) - 1; i >= 0; i-- {
+		samples[i].Offset -= samples[0].Offset
+	}
+	return Compact(samples), nil
+}
+
+// appendVCDValue appends a sample for a 0 or 1 value.
+func appendVCDValue(samples []Sample, now time.Duration, value byte) []Sample {
+	switch value {
+	case '0':
+		return append(samples, Sample{Offset: now, Level: gpio.Low})
+	case '1':
+		return append(samples, Sample{Offset: now, Level: gpio.High})
+	default:
+		return samples
+	}
+}
+
+// parseTimescale parses a VCD timescale such as "1ns", "10 us" or "100ps".
+func parseTimescale(s string) (time.Duration, error) {
+	units := []struct {
+		suffix string
+		unit   float64
+	}{
+		{"fs", 1e-6}, {"ps", 1e-3}, {"ns", 1}, {"us", 1e3}, {"ms", 1e6}, {"s", 1e9},
+	}
+
+	for _, u := range units {
+		if number, ok := strings.CutSuffix(s, u.suffix); ok {
+			n, err := strconv.ParseFloat(number, 64)
+			if err != nil {
+				break
+			}
+			ts := time.Duration(n * u.unit)
+			if ts <= 0 {
+				return 0, fmt.Errorf("vcd: timescale %q below 1ns is not supported", s)
+			}
+			return ts, nil
+		}
+	}
+	return 0, fmt.Errorf("vcd: invalid timescale %q", s)
+}
+
+// WriteVCD writes the samples as a Value Change Dump with a single 1-bit signal
+// and a timescale of 1ns.
+func WriteVCD(w io.Writer, samples []Sample, signal string) error {
+	if signal == "" {
+		signal = "manchester"
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "$version github.com/womat/golib/manchester/waveform $end")
+	fmt.Fprintln(bw, "$timescale 1ns $end")
+	fmt.Fprintln(bw, "$scope module top $end")
+	fmt.Fprintf(bw, "$var wire 1 ! %s $end\n", signal)
+	fmt.Fprintln(bw, "$upscope $end")
+	fmt.Fprintln(bw, "$enddefinitions $end")
+
+	for i, s := range samples {
+		fmt.Fprintf(bw, "#%d\n", s.Offset.Nanoseconds())
+		if i == 0 {
+			fmt.Fprintf(bw, "$dumpvars\n%d!\n$end\n", s.Level)
+			continue
+		}
+		fmt.Fprintf(bw, "%d!\n", s.Level)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,85 @@
+// Package waveform converts Manchester signals between the encoder/decoder packages
+// and sample files of logic analyzers and oscilloscopes, so captures can be decoded
+// and encoder output can be rendered without hardware.
+//
+// Supported file formats:
+//   - CSV: one "time,level" row per sample, time in seconds (e.g. oscilloscope exports)
+//   - VCD: Value Change Dump (IEEE 1364), as exported by most logic analyzers
+//   - Sigrok: the .sr session format of sigrok/PulseView
+//
+// A waveform is a slice of Samples, each holding the level of the signal from its
+// offset until the next sample. Readers return compacted waveforms, i.e. consecutive
+// samples always differ in level.
+//
+// Decoding a capture:
+//
+//	f, err := os.Open("capture.vcd")
+//	...
+//	samples, err := waveform.ReadVCD(f, "D0")
+//	...
+//	bits, stats, err := decoder.DecodeEvents(waveform.Events(samples, time.Time{}), 0)
+//
+// Rendering encoder output:
+//
+//	rec := encoder.Render(50, []byte("Hello"), time.Time{})
+//	err := waveform.WriteVCD(f, waveform.FromTransitions(rec.Transitions()), "manchester")
+package waveform
+
+import (
+	"time"
+
+	"github.com/womat/golib/gpio"
+	"github.com/womat/golib/manchester/decoder"
+	"github.com/womat/golib/manchester/encoder"
+)
+
+// Sample is the level of the signal starting at Offset from the beginning of the capture.
+type Sample struct {
+	Offset time.Duration // Offset from the beginning of the capture
+	Level  gpio.Level    // Level of the signal from Offset until the next sample
+}
+
+// Compact removes samples that do not change the level of the signal.
+func Compact(samples []Sample) []Sample {
+	out := make([]Sample, 0, len(samples))
+	for _, s := range samples {
+		if n := len(out); n > 0 && out[n-1].Level == s.Level {
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// FromTransitions converts the transitions recorded by an encoder.Recorder into samples.
+// The offsets are relative to the first transition.
+func FromTransitions(transitions []encoder.Transition) []Sample {
+	samples := make([]Sample, 0, len(transitions))
+	for _, t := range transitions {
+		samples = append(samples, Sample{
+			Offset: t.Time.Sub(transitions[0].Time),
+			Level:  gpio.Level(t.Level),
+		})
+	}
+	return Compact(samples)
+}
+
+// Events converts samples into decoder events with timestamps relative to start.
+// The first sample only defines the initial level; every following level change
+// becomes a rising or falling edge.
+func Events(samples []Sample, start time.Time) []decoder.Event {
+	samples = Compact(samples)
+	if len(samples) == 0 {
+		return nil
+	}
+
+	events := make([]decoder.Event, 0, len(samples)-1)
+	for _, s := range samples[1:] {
+		edge := decoder.FallingEdge
+		if s.Level == gpio.High {
+			edge = decoder.RisingEdge
+		}
+		events = append(events, decoder.Event{Time: start.Add(s.Offset), Edge: edge})
+	}
+	return events
+}
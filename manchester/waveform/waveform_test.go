@@ -0,0 +1,180 @@
+package waveform
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/womat/golib/gpio"
+	"github.com/womat/golib/manchester/decoder"
+	"github.com/womat/golib/manchester/encoder"
+)
+
+func TestRoundTrip(t *testing.T) {
+	const bitClockHz = 1000
+	rec := encoder.Render(bitClockHz, []byte{0x5a}, time.Unix(0, 0), encoder.WithSyncBytes(1))
+	samples := FromTransitions(rec.Transitions())
+
+	formats := []struct {
+		name  string
+		write func(*bytes.Buffer) error
+		read  func(*bytes.Buffer) ([]Sample, error)
+	}{
+		{
+			"csv",
+			func(b *bytes.Buffer) error { return WriteCSV(b, samples) },
+			func(b *bytes.Buffer) ([]Sample, error) { return ReadCSV(b, 0.5) },
+		},
+		{
+			"vcd",
+			func(b *bytes.Buffer) error { return WriteVCD(b, samples, "") },
+			func(b *bytes.Buffer) ([]Sample, error) { return ReadVCD(b, "") },
+		},
+		{
+			"sigrok",
+			func(b *bytes.Buffer) error { return WriteSigrok(b, samples, 1_000_000, "") },
+			func(b *bytes.Buffer) ([]Sample, error) {
+				return ReadSigrok(bytes.NewReader(b.Bytes()), int64(b.Len()), "D0")
+			},
+		},
+	}
+
+	for _, f := range formats {
+		t.Run(f.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := f.write(&b); err != nil {
+				t.Fatalf("write error = %v", err)
+			}
+			got, err := f.read(&b)
+			if err != nil {
+				t.Fatalf("read error = %v", err)
+			}
+			if len(got) != len(samples) {
+				t.Fatalf("got %d samples, want %d", len(got), len(samples))
+			}
+			for i := range got {
+				if got[i] != samples[i] {
+					t.Fatalf("sample %d = %+v, want %+v", i, got[i], samples[i])
+				}
+			}
+
+			// The encoder's IEEE table emits a rising edge in the middle of a 1 bit,
+			// which is what the decoder's Thomas table decodes as High.
+			bits, stats, err := decoder.DecodeEvents(Events(got, time.Unix(0, 0)), bitClockHz,
+				decoder.WithManchesterEncoding(decoder.Thomas))
+			if err != nil {
+				t.Fatalf("DecodeEvents() error = %v", err)
+			}
+			// start bit, 0x5a LSB first, stop bit
+			want := []decoder.Bit{0, 0, 1, 0, 1, 1, 0, 1, 0, 1}
+			if len(bits) < len(want) || stats.InvalidBits != 0 {
+				t.Fatalf("bits = %v, stats = %+v", bits, stats)
+			}
+			for i, bit := range bits[len(bits)-len(want):] {
+				if bit != want[i] {
+					t.Fatalf("bits = %v, want to end with %v", bits, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	in := `; exported by an oscilloscope
+Time [s],CH1 [V]
+-0.0010,0.02
+-0.0005,3.31
+0.0000,3.29
+0.0005,0.10
+`
+	got, err := ReadCSV(strings.NewReader(in), 1.65)
+	if err != nil {
+		t.Fatalf("ReadCSV() error = %v", err)
+	}
+	want := []Sample{
+		{0, gpio.Low},
+		{500 * time.Microsecond, gpio.High},
+		{1500 * time.Microsecond, gpio.Low},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ReadCSV() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("ReadCSV() = %v, want %v", got, want)
+		}
+	}
+
+	if _, err := ReadCSV(strings.NewReader("0,1\nx,0\n"), 0.5); err == nil {
+		t.Errorf("ReadCSV() with invalid time: expected error")
+	}
+}
+
+func TestReadVCD(t *testing.T) {
+	in := `$date today $end
+$timescale 10 us $end
+$scope module logic $end
+$var wire 1 ! clk $end
+$var wire 1 " data $end
+$var wire 4 # bus [3:0] $end
+$upscope $end
+$enddefinitions $end
+#0
+$dumpvars
+0!
+1"
+b0000 #
+$end
+#5
+1!
+b0101 #
+#10
+0!
+0"
+#25
+x"
+1"
+`
+	got, err := ReadVCD(strings.NewReader(in), "data")
+	if err != nil {
+		t.Fatalf("ReadVCD() error = %v", err)
+	}
+	want := []Sample{
+		{0, gpio.High},
+		{100 * time.Microsecond, gpio.Low},
+		{250 * time.Microsecond, gpio.High},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ReadVCD() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("ReadVCD() = %v, want %v", got, want)
+		}
+	}
+
+	if _, err := ReadVCD(strings.NewReader(in), "missing"); !errors.Is(err, ErrSignalNotFound) {
+		t.Errorf("ReadVCD() error = %v, want %v", err, ErrSignalNotFound)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	start := time.Unix(100, 0)
+	samples := []Sample{{0, gpio.Low}, {time.Millisecond, gpio.High}, {2 * time.Millisecond, gpio.High}, {3 * time.Millisecond, gpio.Low}}
+
+	got := Events(samples, start)
+	want := []decoder.Event{
+		{Time: start.Add(time.Millisecond), Edge: decoder.RisingEdge},
+		{Time: start.Add(3 * time.Millisecond), Edge: decoder.FallingEdge},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Events() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) || got[i].Edge != want[i].Edge {
+			t.Fatalf("Events() = %v, want %v", got, want)
+		}
+	}
+}
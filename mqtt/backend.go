@@ -0,0 +1,83 @@
+package mqtt
+
+import (
+	"time"
+)
+
+// token is the pending result of an asynchronous client operation.
+// mqttlib.Token implements it.
+type token interface {
+	Done() <-chan struct{}
+	Error() error
+}
+
+// backend is the protocol specific MQTT client of a Handler.
+//
+// A backend reports events to its Handler with handleConnect, handleConnectionLost and route.
+type backend interface {
+	// connect starts the initial connect. Unless WithWaitForConnection is set, the
+	// token only completes after the connection is established.
+	connect() token
+	publish(msg Message) token
+	// subscribe subscribes topic filters with their QoS.
+	subscribe(filters map[string]byte) token
+	unsubscribe(filters ...string) token
+	// isConnected reports whether the client is connected or reconnecting automatically.
+	isConnected() bool
+	// isConnectionOpen reports whether the connection is currently established.
+	isConnectionOpen() bool
+	disconnect(quiesce time.Duration)
+}
+
+// doneToken is a token that completes when its operation returns.
+type doneToken struct {
+	done chan struct{}
+	err  error
+}
+
+// newDoneToken runs fn in a new goroutine and returns a token for its result.
+func newDoneToken(fn func() error) *doneToken {
+	t := &doneToken{done: make(chan struct{})}
+	go func() {
+		t.err = fn()
+		close(t.done)
+	}()
+	return t
+}
+
+// completedToken returns a token that has already completed with err.
+func completedToken(err error) *doneToken {
+	t := &doneToken{done: make(chan struct{}), err: err}
+	close(t.done)
+	return t
+}
+
+func (t *doneToken) Done() <-chan struct{} { return t.done }
+
+func (t *doneToken) Error() error {
+	<-t.done
+	return t.err
+}
+
+// handleConnect is called by the backend after every successful (re)connect.
+func (m *Handler) handleConnect(b backend) {
+	go func() {
+		m.publishBirth(b)
+		// a new session has no subscriptions
+		m.resubscribe(b)
+		if m.queue != nil {
+			m.queue.wake()
+		}
+	}()
+	if m.onConnected != nil {
+		m.onConnected()
+	}
+}
+
+// handleConnectionLost is called by the backend when an established connection is lost.
+func (m *Handler) handleConnectionLost(err error) {
+	m.setLastError(err)
+	if m.onConnectionLost != nil {
+		m.onConnectionLost(err)
+	}
+}
@@ -0,0 +1,119 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"time"
+
+	mqttlib "github.com/eclipse/paho.mqtt.golang"
+)
+
+// suback311Failure is the SUBACK return code of a refused subscription in MQTT 3.1.1.
+const suback311Failure = 0x80
+
+// v3Backend is the MQTT 3.1.1 client based on paho.mqtt.golang.
+type v3Backend struct {
+	client mqttlib.Client
+}
+
+// newV3Backend creates the MQTT 3.1.1 client of a Handler.
+func newV3Backend(h *Handler, broker string, tlsConfig *tls.Config) *v3Backend {
+	b := &v3Backend{}
+
+	mqttOpts := mqttlib.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(h.clientID).
+		SetAutoReconnect(true).
+		SetConnectRetry(!h.waitForConnection).
+		SetConnectRetryInterval(h.retryInterval).
+		SetConnectTimeout(h.connectTimeout).
+		SetCleanSession(h.cleanSession).
+		SetConnectionLostHandler(func(_ mqttlib.Client, err error) {
+			h.handleConnectionLost(err)
+		}).
+		SetOnConnectHandler(func(mqttlib.Client) {
+			h.handleConnect(b)
+		}).
+		SetConnectionNotificationHandler(func(_ mqttlib.Client, n mqttlib.ConnectionNotification) {
+			// failed (re)connect attempts, including the retries of the initial connect
+			switch n := n.(type) {
+			case mqttlib.ConnectionNotificationBrokerFailed:
+				h.setLastError(n.Reason)
+			case mqttlib.ConnectionNotificationFailed:
+				h.setLastError(n.Reason)
+			}
+		}).
+		SetDefaultPublishHandler(func(_ mqttlib.Client, msg mqttlib.Message) {
+			h.route(Message{
+				Topic:    msg.Topic(),
+				Payload:  msg.Payload(),
+				Qos:      msg.Qos(),
+				Retained: msg.Retained(),
+			})
+		})
+
+	if tlsConfig != nil {
+		mqttOpts.SetTLSConfig(tlsConfig)
+	}
+	if h.credentials != nil {
+		mqttOpts.SetCredentialsProvider(h.credentials)
+	}
+	if h.will != nil {
+		mqttOpts.SetBinaryWill(h.will.Topic, h.will.Payload, h.will.Qos, h.will.Retained)
+	}
+	if h.keepAlive > 0 {
+		mqttOpts.SetKeepAlive(h.keepAlive)
+	}
+	if h.maxReconnectInterval > 0 {
+		mqttOpts.SetMaxReconnectInterval(h.maxReconnectInterval)
+	}
+
+	b.client = mqttlib.NewClient(mqttOpts)
+	return b
+}
+
+func (b *v3Backend) connect() token {
+	return b.client.Connect()
+}
+
+func (b *v3Backend) publish(msg Message) token {
+	return b.client.Publish(msg.Topic, msg.Qos, msg.Retained, msg.Payload)
+}
+
+// subscribe reports the SUBACK return code 0x80 of a refused filter as ReasonCodeError;
+// the token of paho.mqtt.golang completes without error.
+func (b *v3Backend) subscribe(filters map[string]byte) token {
+	t := b.client.SubscribeMultiple(filters, nil)
+	return newDoneToken(func() error {
+		<-t.Done()
+		if err := t.Error(); err != nil {
+			return err
+		}
+		st, ok := t.(*mqttlib.SubscribeToken)
+		if !ok {
+			return nil
+		}
+		for _, code := range st.Result() {
+			if code == suback311Failure {
+				return &ReasonCodeError{Code: code}
+			}
+		}
+		return nil
+	})
+}
+
+func (b *v3Backend) unsubscribe(filters ...string) token {
+	return b.client.Unsubscribe(filters...)
+}
+
+// isConnected is also true while paho reconnects or retries the initial connect.
+func (b *v3Backend) isConnected() bool {
+	return b.client.IsConnected()
+}
+
+func (b *v3Backend) isConnectionOpen() bool {
+	return b.client.IsConnectionOpen()
+}
+
+func (b *v3Backend) disconnect(quiesce time.Duration) {
+	b.client.Disconnect(uint(quiesce.Milliseconds()))
+}
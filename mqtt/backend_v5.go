@@ -0,0 +1,401 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+const (
+	// defaultKeepAlive is the keepalive interval of the MQTT 5 client, as paho.mqtt.golang uses for MQTT 3.1.1.
+	defaultKeepAlive = 30 * time.Second
+
+	// defaultMaxReconnectInterval is the upper limit of the reconnect backoff, as paho.mqtt.golang uses for MQTT 3.1.1.
+	defaultMaxReconnectInterval = 10 * time.Minute
+)
+
+// v5Backend is the MQTT 5 client based on paho.golang/autopaho.
+type v5Backend struct {
+	h      *Handler
+	cfg    autopaho.ClientConfig
+	cm     atomic.Pointer[autopaho.ConnectionManager] // set by connect or the first connectionUp
+	cancel context.CancelFunc
+
+	open      atomic.Bool  // the connection is established
+	closed    atomic.Bool  // disconnect has been called
+	lastErr   atomic.Value // last client error, passed to handleConnectionLost
+	connected chan error   // receives the result of the initial connect (buffered)
+
+	aliasMu      sync.Mutex
+	aliasMaximum uint16            // topic aliases allowed by the broker, 0 if disabled
+	aliases      map[string]uint16 // established topic aliases of the current connection
+	pending      map[string]uint16 // topic aliases being established
+	nextAlias    uint16            // last topic alias assigned on the current connection
+}
+
+// newV5Backend creates the MQTT 5 client of a Handler.
+func newV5Backend(h *Handler, broker string, tlsConfig *tls.Config) (*v5Backend, error) {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mqtt broker url: %w", err)
+	}
+
+	b := &v5Backend{h: h, connected: make(chan error, 1)}
+	keepAlive := h.keepAlive
+	if keepAlive == 0 {
+		keepAlive = defaultKeepAlive
+	}
+
+	b.cfg = autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{u},
+		TlsCfg:                        tlsConfig,
+		KeepAlive:                     uint16(min(keepAlive.Seconds(), math.MaxUint16)),
+		CleanStartOnInitialConnection: h.cleanSession,
+		ReconnectBackoff:              b.backoff,
+		ConnectTimeout:                h.connectTimeout,
+		OnConnectionUp:                b.connectionUp,
+		OnConnectionDown:              b.connectionDown,
+		OnConnectError:                b.connectError,
+		ClientConfig: paho.ClientConfig{
+			ClientID:      h.clientID,
+			PacketTimeout: h.publishTimeout,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				func(pr paho.PublishReceived) (bool, error) {
+					h.route(fromPahoPublish(pr.Packet))
+					return true, nil
+				},
+			},
+			OnClientError: func(err error) {
+				b.lastErr.Store(err)
+			},
+			OnServerDisconnect: func(d *paho.Disconnect) {
+				err := &ReasonCodeError{Code: d.ReasonCode}
+				if d.Properties != nil {
+					err.Reason = d.Properties.ReasonString
+				}
+				b.lastErr.Store(error(err))
+			},
+		},
+	}
+	if !h.cleanSession {
+		b.cfg.SessionExpiryInterval = math.MaxUint32 // the session does not expire
+	}
+	if h.will != nil {
+		b.cfg.WillMessage = &paho.WillMessage{Topic: h.will.Topic, Payload: h.will.Payload, QoS: h.will.Qos, Retain: h.will.Retained}
+		b.cfg.WillProperties = toPahoProperties(*h.will).willProperties()
+	}
+	if h.credentials != nil {
+		b.cfg.ConnectPacketBuilder = func(cp *paho.Connect, _ *url.URL) (*paho.Connect, error) {
+			username, password := h.credentials()
+			cp.Username, cp.UsernameFlag = username, username != ""
+			cp.Password, cp.PasswordFlag = []byte(password), password != ""
+			return cp, nil
+		}
+	}
+	return b, nil
+}
+
+// backoff returns the delay before a connect attempt: the first attempt is immediate,
+// then the retry interval doubles up to the max reconnect interval.
+func (b *v5Backend) backoff(attempt int) time.Duration {
+	if attempt == 0 {
+		return 0
+	}
+	maxInterval := b.h.maxReconnectInterval
+	if maxInterval == 0 {
+		maxInterval = defaultMaxReconnectInterval
+	}
+	d := b.h.retryInterval
+	for i := 1; i < attempt && d < maxInterval; i++ {
+		d *= 2
+	}
+	return min(d, maxInterval)
+}
+
+func (b *v5Backend) connectionUp(cm *autopaho.ConnectionManager, connack *paho.Connack) {
+	b.cm.CompareAndSwap(nil, cm) // the callback may run before NewConnection returns
+	b.aliasMu.Lock()
+	b.aliasMaximum = 0
+	if b.h.topicAliases && connack.Properties != nil && connack.Properties.TopicAliasMaximum != nil {
+		b.aliasMaximum = *connack.Properties.TopicAliasMaximum
+	}
+	b.aliases = make(map[string]uint16)
+	b.pending = make(map[string]uint16)
+	b.nextAlias = 0
+	b.aliasMu.Unlock()
+
+	b.open.Store(true)
+	select {
+	case b.connected <- nil:
+	default:
+	}
+	b.h.handleConnect(b)
+}
+
+func (b *v5Backend) connectionDown() bool {
+	b.open.Store(false)
+	if b.closed.Load() {
+		return false
+	}
+	err, _ := b.lastErr.Load().(error)
+	if err == nil {
+		err = errors.New("connection lost")
+	}
+	b.h.handleConnectionLost(err)
+	return true
+}
+
+func (b *v5Backend) connectError(err error) {
+	var connackErr *autopaho.ConnackError
+	if errors.As(err, &connackErr) {
+		err = &ReasonCodeError{Code: connackErr.ReasonCode, Reason: connackErr.Reason}
+	}
+	b.h.setLastError(err)
+	if b.h.waitForConnection {
+		select {
+		case b.connected <- err:
+		default:
+		}
+	}
+}
+
+func (b *v5Backend) connect() token {
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+	cm, err := autopaho.NewConnection(ctx, b.cfg)
+	if err != nil {
+		return completedToken(err)
+	}
+	b.cm.CompareAndSwap(nil, cm)
+	return newDoneToken(func() error {
+		select {
+		case err := <-b.connected:
+			return err
+		case <-ctx.Done():
+			return errors.New("mqtt client disconnected")
+		}
+	})
+}
+
+func (b *v5Backend) publish(msg Message) token {
+	cm := b.cm.Load()
+	if cm == nil {
+		return completedToken(ErrClientNotInitialized)
+	}
+	p := &paho.Publish{
+		Topic:      msg.Topic,
+		Payload:    msg.Payload,
+		QoS:        msg.Qos,
+		Retain:     msg.Retained,
+		Properties: toPahoProperties(msg).publishProperties(),
+	}
+	alias, established := b.topicAlias(p)
+
+	return newDoneToken(func() error {
+		resp, err := cm.Publish(context.Background(), p)
+		if alias != 0 && !established {
+			b.establishAlias(msg.Topic, alias, err == nil)
+		}
+		if resp != nil && resp.ReasonCode >= 0x80 {
+			rerr := &ReasonCodeError{Code: resp.ReasonCode}
+			if resp.Properties != nil {
+				rerr.Reason = resp.Properties.ReasonString
+			}
+			return rerr
+		}
+		return err
+	})
+}
+
+// topicAlias sets the topic alias of a QoS 0 message if WithTopicAliases is set.
+// An alias is only used without the topic once the message that established it has been sent.
+// QoS 1 and 2 messages keep the topic, because they may be resent on a new connection.
+func (b *v5Backend) topicAlias(p *paho.Publish) (alias uint16, established bool) {
+	if p.QoS != 0 {
+		return 0, false
+	}
+
+	b.aliasMu.Lock()
+	defer b.aliasMu.Unlock()
+
+	if alias, ok := b.aliases[p.Topic]; ok {
+		p.Properties.TopicAlias = &alias
+		p.Topic = ""
+		return alias, true
+	}
+	if _, ok := b.pending[p.Topic]; ok || b.nextAlias >= b.aliasMaximum {
+		return 0, false
+	}
+	b.nextAlias++
+	alias = b.nextAlias
+	b.pending[p.Topic] = alias
+	p.Properties.TopicAlias = &alias
+	return alias, false
+}
+
+// establishAlias records the result of a message that set a new topic alias.
+func (b *v5Backend) establishAlias(topic string, alias uint16, ok bool) {
+	b.aliasMu.Lock()
+	defer b.aliasMu.Unlock()
+
+	if b.pending[topic] != alias {
+		return // reconnected in the meantime
+	}
+	delete(b.pending, topic)
+	if ok {
+		b.aliases[topic] = alias
+	}
+}
+
+func (b *v5Backend) subscribe(filters map[string]byte) token {
+	cm := b.cm.Load()
+	if cm == nil {
+		return completedToken(ErrClientNotInitialized)
+	}
+	s := &paho.Subscribe{}
+	for filter, qos := range filters {
+		s.Subscriptions = append(s.Subscriptions, paho.SubscribeOptions{Topic: filter, QoS: qos})
+	}
+	return newDoneToken(func() error {
+		suback, err := cm.Subscribe(context.Background(), s)
+		if errors.Is(err, autopaho.ConnectionDownError) {
+			return nil // subscribed by resubscribe() when the connection is established
+		}
+		// paho returns a plain error together with the SUBACK of a refused single filter
+		if suback != nil {
+			if err := subackError(suback.Reasons, suback.Properties); err != nil {
+				return err
+			}
+		}
+		return err
+	})
+}
+
+func (b *v5Backend) unsubscribe(filters ...string) token {
+	cm := b.cm.Load()
+	if cm == nil {
+		return completedToken(ErrClientNotInitialized)
+	}
+	return newDoneToken(func() error {
+		_, err := cm.Unsubscribe(context.Background(), &paho.Unsubscribe{Topics: filters})
+		if errors.Is(err, autopaho.ConnectionDownError) {
+			return nil // the next connection is subscribed without the removed filters
+		}
+		return err
+	})
+}
+
+// isConnected is true until disconnect, because autopaho reconnects automatically.
+// It is false after an initial connect that failed with WithWaitForConnection.
+func (b *v5Backend) isConnected() bool {
+	return b.cm.Load() != nil && !b.closed.Load()
+}
+
+func (b *v5Backend) isConnectionOpen() bool {
+	return b.open.Load()
+}
+
+func (b *v5Backend) disconnect(quiesce time.Duration) {
+	cm := b.cm.Load()
+	if b.closed.Swap(true) || cm == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), max(quiesce, time.Millisecond))
+	defer cancel()
+	_ = cm.Disconnect(ctx)
+	b.cancel()
+	b.open.Store(false)
+}
+
+// subackError returns a ReasonCodeError for the first failed subscription.
+func subackError(reasons []byte, props *paho.SubackProperties) error {
+	for _, code := range reasons {
+		if code >= 0x80 {
+			err := &ReasonCodeError{Code: code}
+			if props != nil {
+				err.Reason = props.ReasonString
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// pahoProperties are the MQTT 5 properties of a Message in paho.golang types.
+type pahoProperties struct {
+	responseTopic   string
+	correlationData []byte
+	contentType     string
+	messageExpiry   *uint32
+	user            paho.UserProperties
+}
+
+func toPahoProperties(msg Message) pahoProperties {
+	p := pahoProperties{
+		responseTopic:   msg.ResponseTopic,
+		correlationData: msg.CorrelationData,
+		contentType:     msg.ContentType,
+	}
+	if msg.MessageExpiry > 0 {
+		expiry := uint32(min(math.Ceil(msg.MessageExpiry.Seconds()), math.MaxUint32))
+		p.messageExpiry = &expiry
+	}
+	for key, value := range msg.UserProperties {
+		p.user = append(p.user, paho.UserProperty{Key: key, Value: value})
+	}
+	return p
+}
+
+func (p pahoProperties) publishProperties() *paho.PublishProperties {
+	return &paho.PublishProperties{
+		ResponseTopic:   p.responseTopic,
+		CorrelationData: p.correlationData,
+		ContentType:     p.contentType,
+		MessageExpiry:   p.messageExpiry,
+		User:            p.user,
+	}
+}
+
+func (p pahoProperties) willProperties() *paho.WillProperties {
+	return &paho.WillProperties{
+		ResponseTopic:   p.responseTopic,
+		CorrelationData: p.correlationData,
+		ContentType:     p.contentType,
+		MessageExpiry:   p.messageExpiry,
+		User:            p.user,
+	}
+}
+
+// fromPahoPublish converts a received message.
+func fromPahoPublish(p *paho.Publish) Message {
+	msg := Message{
+		Topic:    p.Topic,
+		Payload:  p.Payload,
+		Qos:      p.QoS,
+		Retained: p.Retain,
+	}
+	if props := p.Properties; props != nil {
+		msg.ResponseTopic = props.ResponseTopic
+		msg.CorrelationData = props.CorrelationData
+		msg.ContentType = props.ContentType
+		if props.MessageExpiry != nil {
+			msg.MessageExpiry = time.Duration(*props.MessageExpiry) * time.Second
+		}
+		if len(props.User) > 0 {
+			msg.UserProperties = make(map[string]string, len(props.User))
+			for _, u := range props.User {
+				msg.UserProperties[u.Key] = u.Value
+			}
+		}
+	}
+	return msg
+}
@@ -0,0 +1,150 @@
+package mqtt
+
+import (
+	"fmt"
+	"time"
+)
+
+// State is the connection state of a Handler.
+type State int
+
+const (
+	StateDisconnected State = iota // StateDisconnected means no client or no (re-)connect in progress
+	StateConnecting                // StateConnecting means the client is trying to (re-)connect
+	StateConnected                 // StateConnected means the connection to the broker is open
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// ConnectionState contains the connection state and the last connection error.
+type ConnectionState struct {
+	State     State
+	LastError error // last failed connect or connection loss, nil if none occurred yet
+}
+
+// WithConnectTimeout sets the maximum duration to wait for a connect (default 5s).
+// It limits how long New blocks and every single connection attempt.
+func WithConnectTimeout(d time.Duration) Option {
+	return func(h *Handler) {
+		h.connectTimeout = d
+	}
+}
+
+// WithRetryInterval sets the wait time between the attempts of the initial
+// connect in the background (default 2s).
+func WithRetryInterval(d time.Duration) Option {
+	return func(h *Handler) {
+		h.retryInterval = d
+	}
+}
+
+// WithPublishTimeout sets the maximum duration to wait for the broker to acknowledge
+// a published message (default 5s).
+func WithPublishTimeout(d time.Duration) Option {
+	return func(h *Handler) {
+		h.publishTimeout = d
+	}
+}
+
+// WithQuiesce sets the duration Disconnect waits for pending work to complete (default 250ms).
+func WithQuiesce(d time.Duration) Option {
+	return func(h *Handler) {
+		h.quiesce = d
+	}
+}
+
+// WithKeepAlive sets the interval of the keepalive pings (default 30s).
+// The broker closes the connection after 1.5 intervals without traffic.
+func WithKeepAlive(d time.Duration) Option {
+	return func(h *Handler) {
+		h.keepAlive = d
+	}
+}
+
+// WithMaxReconnectInterval sets the upper limit of the exponential backoff between
+// reconnect attempts after a connection loss (default 10m).
+func WithMaxReconnectInterval(d time.Duration) Option {
+	return func(h *Handler) {
+		h.maxReconnectInterval = d
+	}
+}
+
+// WithCleanSession sets whether the broker discards the session when the client
+// disconnects (default true). Without a clean session the broker keeps the
+// subscriptions and queues QoS 1 and 2 messages while the client is offline;
+// this requires a stable client id.
+func WithCleanSession(clean bool) Option {
+	return func(h *Handler) {
+		h.cleanSession = clean
+	}
+}
+
+// WithWaitForConnection makes New return an error if the initial connect fails or
+// does not complete within the connect timeout, instead of retrying in the background.
+// Once connected, a lost connection is still re-established automatically.
+func WithWaitForConnection() Option {
+	return func(h *Handler) {
+		h.waitForConnection = true
+	}
+}
+
+// ConnectionState returns the current connection state and the last connection error.
+func (m *Handler) ConnectionState() ConnectionState {
+	m.mu.Lock()
+	client := m.client
+	s := ConnectionState{LastError: m.lastErr}
+	m.mu.Unlock()
+
+	switch {
+	case client == nil:
+		s.State = StateDisconnected
+	case client.isConnectionOpen():
+		s.State = StateConnected
+	case client.isConnected():
+		// paho reports reconnects and connect retries as connected
+		s.State = StateConnecting
+	default:
+		s.State = StateDisconnected
+	}
+	return s
+}
+
+// setLastError records a connection error for ConnectionState.
+func (m *Handler) setLastError(err error) {
+	m.mu.Lock()
+	m.lastErr = err
+	m.mu.Unlock()
+}
+
+// validateTimeouts checks the durations set by the options.
+func (m *Handler) validateTimeouts() error {
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+		min   time.Duration
+	}{
+		{"connect timeout", m.connectTimeout, 1},
+		{"retry interval", m.retryInterval, 1},
+		{"publish timeout", m.publishTimeout, 1},
+		{"quiesce", m.quiesce, 0},
+		{"keepalive", m.keepAlive, 0},
+		{"max reconnect interval", m.maxReconnectInterval, 0},
+	} {
+		if d.value < d.min {
+			return fmt.Errorf("invalid mqtt %s: %v", d.name, d.value)
+		}
+	}
+	return nil
+}
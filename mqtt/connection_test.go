@@ -0,0 +1,133 @@
+package mqtt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/womat/golib/mqtt/mqtttest"
+)
+
+func TestWaitForConnection(t *testing.T) {
+	b := newTestBroker(t, mqtttest.WithAuthentication(func(username, password string) bool {
+		return username == "user" && password == "secret"
+	}))
+
+	if _, err := New(b.URL(), "device", WithWaitForConnection(), WithCredentials("user", "wrong")); err == nil {
+		t.Errorf("New() with wrong password: expected error")
+	}
+
+	closed := newTestBroker(t)
+	url := closed.URL()
+	_ = closed.Close()
+	if _, err := New(url, "device", WithWaitForConnection(), WithConnectTimeout(time.Second)); err == nil {
+		t.Errorf("New() without broker: expected error")
+	}
+
+	h, err := New(b.URL(), "device", WithWaitForConnection(), WithCredentials("user", "secret"),
+		WithMaxReconnectInterval(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if s := h.ConnectionState(); s.State != StateConnected || s.LastError != nil {
+		t.Errorf("ConnectionState() = %+v, want connected without error", s)
+	}
+
+	// a lost connection is re-established after a successful initial connect
+	b.DisconnectClient("device")
+	waitFor(t, "connection lost", func() bool { return h.ConnectionState().LastError != nil })
+	waitFor(t, "reconnect", func() bool { return h.ConnectionState().State == StateConnected })
+
+	h.Disconnect()
+	if s := h.ConnectionState(); s.State != StateDisconnected {
+		t.Errorf("ConnectionState() after Disconnect() = %v, want %v", s.State, StateDisconnected)
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	b := newTestBroker(t)
+	addr := b.Addr()
+	_ = b.Close()
+
+	start := time.Now()
+	h, err := New("tcp://"+addr, "device", WithConnectTimeout(200*time.Millisecond), WithRetryInterval(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("New() took %v, want about 200ms", d)
+	}
+	if s := h.ConnectionState(); s.State != StateConnecting || !errors.Is(s.LastError, ErrConnectTimeout) {
+		t.Errorf("ConnectionState() = %+v, want connecting with %v", s, ErrConnectTimeout)
+	}
+
+	// the initial connect is retried in the background
+	newTestBroker(t, mqtttest.WithAddress(addr))
+	waitFor(t, "connect", func() bool { return h.ConnectionState().State == StateConnected })
+}
+
+func TestConnectionStateLastError(t *testing.T) {
+	// without WithWaitForConnection the failed attempts are retried in the background
+	b := newTestBroker(t, mqtttest.WithAuthentication(func(username, password string) bool {
+		return username == "user" && password == "secret"
+	}))
+	h, err := New(b.URL(), "device", WithCredentials("user", "wrong"),
+		WithConnectTimeout(200*time.Millisecond), WithRetryInterval(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	s := h.ConnectionState()
+	if s.State != StateConnecting || !errors.Is(s.LastError, packets.ErrorRefusedBadUsernameOrPassword) {
+		t.Errorf("ConnectionState() with wrong password = %+v, want connecting with %v", s, packets.ErrorRefusedBadUsernameOrPassword)
+	}
+
+	closed := newTestBroker(t)
+	url := closed.URL()
+	_ = closed.Close()
+	h, err = New(url, "device", WithConnectTimeout(200*time.Millisecond), WithRetryInterval(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	waitFor(t, "failed connect", func() bool {
+		s := h.ConnectionState()
+		return s.LastError != nil && !errors.Is(s.LastError, ErrConnectTimeout)
+	})
+	if s := h.ConnectionState(); !errors.Is(s.LastError, packets.ErrorNetworkError) {
+		t.Errorf("ConnectionState() without broker = %+v, want %v", s, packets.ErrorNetworkError)
+	}
+}
+
+func TestTimeoutOptionErrors(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"connect timeout":        WithConnectTimeout(0),
+		"retry interval":         WithRetryInterval(-time.Second),
+		"publish timeout":        WithPublishTimeout(0),
+		"quiesce":                WithQuiesce(-time.Millisecond),
+		"keepalive":              WithKeepAlive(-time.Second),
+		"max reconnect interval": WithMaxReconnectInterval(-time.Second),
+	} {
+		if _, err := New("tcp://127.0.0.1:1", "device", opt); err == nil {
+			t.Errorf("New() with invalid %s: expected error", name)
+		}
+	}
+}
+
+func TestStateString(t *testing.T) {
+	for s, want := range map[State]string{
+		StateDisconnected: "disconnected",
+		StateConnecting:   "connecting",
+		StateConnected:    "connected",
+		State(7):          "State(7)",
+	} {
+		if got := s.String(); got != want {
+			t.Errorf("State(%d).String() = %q, want %q", int(s), got, want)
+		}
+	}
+}
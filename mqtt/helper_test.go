@@ -0,0 +1,30 @@
+package mqtt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/womat/golib/mqtt/mqtttest"
+)
+
+// newTestBroker starts an in-process broker that is closed at the end of the test.
+func newTestBroker(t *testing.T, opts ...mqtttest.Option) *mqtttest.Broker {
+	t.Helper()
+	b, err := mqtttest.New(opts...)
+	if err != nil {
+		t.Fatalf("mqtttest.New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+	return b
+}
+
+// waitFor polls cond for up to 5 seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timeout waiting for %s", what)
+}
@@ -0,0 +1,427 @@
+// Package homeassistant publishes Home Assistant MQTT discovery configurations
+// on top of mqtt.Handler.
+//
+// Every entity is announced with a retained config message on
+// "<discovery prefix>/<component>/<node id>/<object id>/config", so Home Assistant
+// creates it automatically and groups all entities of a Publisher into one device.
+// State topics default to "<node id>/<object id>/state" and command topics to
+// "<node id>/<object id>/set". The configs are published again whenever Home
+// Assistant announces that it is online.
+//
+//	h, err := mqtt.New(broker, "boiler", mqtt.WithStatusTopic("boiler"))
+//	...
+//	ha := homeassistant.New(h, "boiler", homeassistant.Device{Name: "Boiler"},
+//		homeassistant.WithAvailabilityTopic("boiler/status"))
+//	err = ha.AddSensor(homeassistant.Sensor{ID: "temperature", Name: "Temperature",
+//		Unit: "°C", DeviceClass: "temperature", StateClass: "measurement"})
+//	...
+//	err = ha.PublishState("temperature", "62.5")
+//	err = ha.AddSwitch(homeassistant.Switch{ID: "pump", Name: "Pump"}, func(on bool) error {
+//		return pump.Set(on)
+//	})
+package homeassistant
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sync"
+
+	"github.com/womat/golib/mqtt"
+)
+
+const (
+	// DefaultDiscoveryPrefix is the discovery prefix of a default Home Assistant installation.
+	DefaultDiscoveryPrefix = "homeassistant"
+
+	// Default payloads of binary sensors and switches.
+	PayloadOn  = "ON"
+	PayloadOff = "OFF"
+
+	// PayloadPress is the default command payload of buttons.
+	PayloadPress = "PRESS"
+)
+
+var (
+	ErrInvalidID     = errors.New("home assistant id must only contain [a-zA-Z0-9_-]")
+	ErrDuplicateID   = errors.New("home assistant entity id already exists")
+	ErrUnknownEntity = errors.New("home assistant entity not found")
+)
+
+// validID matches the node and object ids allowed in discovery topics.
+var validID = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Device describes the device the entities belong to.
+// If Identifiers is empty, the node id is used.
+type Device struct {
+	Identifiers   []string `json:"identifiers,omitempty"`
+	Name          string   `json:"name,omitempty"`
+	Manufacturer  string   `json:"manufacturer,omitempty"`
+	Model         string   `json:"model,omitempty"`
+	SWVersion     string   `json:"sw_version,omitempty"`
+	HWVersion     string   `json:"hw_version,omitempty"`
+	SerialNumber  string   `json:"serial_number,omitempty"`
+	SuggestedArea string   `json:"suggested_area,omitempty"`
+}
+
+// Sensor is a read-only entity with a value, e.g. a temperature.
+type Sensor struct {
+	ID            string // Object id, unique within the node
+	Name          string // Entity name, e.g. "Temperature"
+	StateTopic    string // Default "<node id>/<id>/state"
+	Unit          string // Unit of measurement, e.g. "°C"
+	DeviceClass   string // e.g. "temperature", "power", "energy"
+	StateClass    string // e.g. "measurement", "total_increasing"
+	ValueTemplate string // Template to extract the value, e.g. "{{ value_json.temp }}"
+	Icon          string // e.g. "mdi:water-boiler"
+}
+
+// BinarySensor is a read-only entity with the states on and off, e.g. a door contact.
+type BinarySensor struct {
+	ID          string
+	Name        string
+	StateTopic  string // Default "<node id>/<id>/state"
+	DeviceClass string // e.g. "door", "motion", "problem"
+	PayloadOn   string // Default PayloadOn
+	PayloadOff  string // Default PayloadOff
+	Icon        string
+}
+
+// Switch is an entity that can be turned on and off by Home Assistant.
+type Switch struct {
+	ID           string
+	Name         string
+	StateTopic   string // Default "<node id>/<id>/state"
+	CommandTopic string // Default "<node id>/<id>/set"
+	DeviceClass  string // "outlet" or "switch"
+	PayloadOn    string // Default PayloadOn
+	PayloadOff   string // Default PayloadOff
+	Icon         string
+}
+
+// Button is an entity that triggers an action in the device.
+type Button struct {
+	ID           string
+	Name         string
+	CommandTopic string // Default "<node id>/<id>/set"
+	DeviceClass  string // e.g. "restart", "update"
+	PayloadPress string // Default PayloadPress
+	Icon         string
+}
+
+// config is the discovery payload of an entity.
+type config struct {
+	Name                string  `json:"name,omitempty"`
+	UniqueID            string  `json:"unique_id"`
+	ObjectID            string  `json:"object_id"`
+	StateTopic          string  `json:"state_topic,omitempty"`
+	CommandTopic        string  `json:"command_topic,omitempty"`
+	Unit                string  `json:"unit_of_measurement,omitempty"`
+	DeviceClass         string  `json:"device_class,omitempty"`
+	StateClass          string  `json:"state_class,omitempty"`
+	ValueTemplate       string  `json:"value_template,omitempty"`
+	Icon                string  `json:"icon,omitempty"`
+	PayloadOn           string  `json:"payload_on,omitempty"`
+	PayloadOff          string  `json:"payload_off,omitempty"`
+	PayloadPress        string  `json:"payload_press,omitempty"`
+	AvailabilityTopic   string  `json:"availability_topic,omitempty"`
+	PayloadAvailable    string  `json:"payload_available,omitempty"`
+	PayloadNotAvailable string  `json:"payload_not_available,omitempty"`
+	Device              *Device `json:"device"`
+}
+
+// entity is an announced entity.
+type entity struct {
+	id        string
+	component string
+	config    config
+}
+
+// Publisher announces the entities of one device.
+type Publisher struct {
+	h            *mqtt.Handler
+	nodeID       string
+	device       Device
+	prefix       string
+	availability string
+	qos          byte
+
+	mu       sync.Mutex
+	entities map[string]*entity // by object id
+	order    []string           // object ids in the order they were added
+	watching bool               // subscribed to the Home Assistant status topic
+}
+
+// Option configures a Publisher.
+type Option func(*Publisher)
+
+// WithDiscoveryPrefix sets the discovery prefix (default DefaultDiscoveryPrefix).
+func WithDiscoveryPrefix(prefix string) Option {
+	return func(p *Publisher) {
+		p.prefix = prefix
+	}
+}
+
+// WithAvailabilityTopic sets the topic with the payloads mqtt.StatusOnline and
+// mqtt.StatusOffline, e.g. "<prefix>/status" of mqtt.WithStatusTopic(prefix).
+// Home Assistant shows all entities as unavailable while the device is offline.
+func WithAvailabilityTopic(topic string) Option {
+	return func(p *Publisher) {
+		p.availability = topic
+	}
+}
+
+// WithQos sets the QoS level of configs, states and command subscriptions (default 1).
+func WithQos(qos byte) Option {
+	return func(p *Publisher) {
+		p.qos = qos
+	}
+}
+
+// New creates a Publisher for the device with the given node id, which must only
+// contain the characters [a-zA-Z0-9_-]; this is checked by the Add methods.
+func New(h *mqtt.Handler, nodeID string, device Device, opts ...Option) *Publisher {
+	p := &Publisher{
+		h:        h,
+		nodeID:   nodeID,
+		device:   device,
+		prefix:   DefaultDiscoveryPrefix,
+		qos:      1,
+		entities: make(map[string]*entity),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if len(p.device.Identifiers) == 0 {
+		p.device.Identifiers = []string{nodeID}
+	}
+	return p
+}
+
+// AddSensor announces a sensor.
+func (p *Publisher) AddSensor(s Sensor) error {
+	return p.add("sensor", s.ID, config{
+		Name:          s.Name,
+		StateTopic:    p.orDefault(s.StateTopic, s.ID, "state"),
+		Unit:          s.Unit,
+		DeviceClass:   s.DeviceClass,
+		StateClass:    s.StateClass,
+		ValueTemplate: s.ValueTemplate,
+		Icon:          s.Icon,
+	}, nil)
+}
+
+// AddBinarySensor announces a binary sensor.
+func (p *Publisher) AddBinarySensor(s BinarySensor) error {
+	return p.add("binary_sensor", s.ID, config{
+		Name:        s.Name,
+		StateTopic:  p.orDefault(s.StateTopic, s.ID, "state"),
+		DeviceClass: s.DeviceClass,
+		PayloadOn:   cmp.Or(s.PayloadOn, PayloadOn),
+		PayloadOff:  cmp.Or(s.PayloadOff, PayloadOff),
+		Icon:        s.Icon,
+	}, nil)
+}
+
+// AddSwitch announces a switch and calls fn for every command. If fn returns nil,
+// the new state is published to the state topic; otherwise the state is not changed.
+func (p *Publisher) AddSwitch(s Switch, fn func(on bool) error) error {
+	if fn == nil {
+		return errors.New("home assistant switch callback must not be nil")
+	}
+	c := config{
+		Name:         s.Name,
+		StateTopic:   p.orDefault(s.StateTopic, s.ID, "state"),
+		CommandTopic: p.orDefault(s.CommandTopic, s.ID, "set"),
+		DeviceClass:  s.DeviceClass,
+		PayloadOn:    cmp.Or(s.PayloadOn, PayloadOn),
+		PayloadOff:   cmp.Or(s.PayloadOff, PayloadOff),
+		Icon:         s.Icon,
+	}
+	return p.add("switch", s.ID, c, func(msg mqtt.Message) {
+		var on bool
+		switch string(msg.Payload) {
+		case c.PayloadOn:
+			on = true
+		case c.PayloadOff:
+		default:
+			return
+		}
+		// handlers must not block, see mqtt.Handler.Subscribe
+		go func() {
+			if fn(on) != nil {
+				return
+			}
+			state := c.PayloadOff
+			if on {
+				state = c.PayloadOn
+			}
+			_ = p.PublishState(s.ID, state)
+		}()
+	})
+}
+
+// AddButton announces a button and calls fn whenever it is pressed.
+func (p *Publisher) AddButton(b Button, fn func()) error {
+	if fn == nil {
+		return errors.New("home assistant button callback must not be nil")
+	}
+	c := config{
+		Name:         b.Name,
+		CommandTopic: p.orDefault(b.CommandTopic, b.ID, "set"),
+		DeviceClass:  b.DeviceClass,
+		PayloadPress: cmp.Or(b.PayloadPress, PayloadPress),
+		Icon:         b.Icon,
+	}
+	return p.add("button", b.ID, c, func(msg mqtt.Message) {
+		if string(msg.Payload) == c.PayloadPress {
+			go fn()
+		}
+	})
+}
+
+// PublishState publishes the state of an entity as retained message to its state topic.
+func (p *Publisher) PublishState(id, payload string) error {
+	p.mu.Lock()
+	e, ok := p.entities[id]
+	p.mu.Unlock()
+	if !ok || e.config.StateTopic == "" {
+		return fmt.Errorf("%w: %s", ErrUnknownEntity, id)
+	}
+	return p.h.Publish(mqtt.Message{Topic: e.config.StateTopic, Payload: []byte(payload), Qos: p.qos, Retained: true})
+}
+
+// Remove deletes an entity from Home Assistant by publishing an empty config.
+// Command subscriptions of switches and buttons are removed, too.
+func (p *Publisher) Remove(id string) error {
+	p.mu.Lock()
+	e, ok := p.entities[id]
+	if ok {
+		p.unregister(id)
+	}
+	p.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownEntity, id)
+	}
+
+	if e.config.CommandTopic != "" {
+		if err := p.h.Unsubscribe(e.config.CommandTopic); err != nil {
+			return err
+		}
+	}
+	return p.h.Publish(mqtt.Message{Topic: p.configTopic(e.component, id), Qos: p.qos, Retained: true})
+}
+
+// Republish publishes the configs of all entities again. It is called automatically
+// when Home Assistant publishes its birth message "online" to "<discovery prefix>/status".
+func (p *Publisher) Republish() error {
+	p.mu.Lock()
+	entities := make([]*entity, 0, len(p.order))
+	for _, id := range p.order {
+		entities = append(entities, p.entities[id])
+	}
+	p.mu.Unlock()
+
+	var errs []error
+	for _, e := range entities {
+		errs = append(errs, p.publishConfig(e))
+	}
+	return errors.Join(errs...)
+}
+
+// add validates and announces an entity. If command is not nil, it is subscribed to
+// the command topic before the config is published. If a subscription fails, the
+// entity is removed again.
+func (p *Publisher) add(component, id string, c config, command func(mqtt.Message)) error {
+	if !validID.MatchString(p.nodeID) {
+		return fmt.Errorf("%w: node id %q", ErrInvalidID, p.nodeID)
+	}
+	if !validID.MatchString(id) {
+		return fmt.Errorf("%w: %q", ErrInvalidID, id)
+	}
+
+	c.UniqueID = p.nodeID + "_" + id
+	c.ObjectID = c.UniqueID
+	c.Device = &p.device
+	if p.availability != "" {
+		c.AvailabilityTopic = p.availability
+		c.PayloadAvailable = mqtt.StatusOnline
+		c.PayloadNotAvailable = mqtt.StatusOffline
+	}
+	e := &entity{id: id, component: component, config: c}
+
+	p.mu.Lock()
+	if _, ok := p.entities[id]; ok {
+		p.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrDuplicateID, id)
+	}
+	p.entities[id] = e
+	p.order = append(p.order, id)
+	watch := !p.watching
+	p.watching = true
+	p.mu.Unlock()
+
+	if watch {
+		if err := p.watchHomeAssistant(); err != nil {
+			p.mu.Lock()
+			p.unregister(id)
+			p.watching = false
+			p.mu.Unlock()
+			return err
+		}
+	}
+	if command != nil {
+		if err := p.h.Subscribe(c.CommandTopic, p.qos, command); err != nil {
+			p.mu.Lock()
+			p.unregister(id)
+			p.mu.Unlock()
+			return err
+		}
+	}
+	return p.publishConfig(e)
+}
+
+// unregister removes an entity from p.entities and p.order; p.mu must be held.
+func (p *Publisher) unregister(id string) {
+	delete(p.entities, id)
+	p.order = slices.DeleteFunc(p.order, func(o string) bool { return o == id })
+}
+
+// watchHomeAssistant republishes the configs whenever Home Assistant (re)starts.
+func (p *Publisher) watchHomeAssistant() error {
+	return p.h.Subscribe(p.prefix+"/status", p.qos, func(msg mqtt.Message) {
+		if string(msg.Payload) == mqtt.StatusOnline {
+			go func() { _ = p.Republish() }()
+		}
+	})
+}
+
+// publishConfig publishes the retained discovery config of an entity.
+func (p *Publisher) publishConfig(e *entity) error {
+	payload, err := json.Marshal(e.config)
+	if err != nil {
+		return fmt.Errorf("encode json: %w", err)
+	}
+	return p.h.Publish(mqtt.Message{
+		Topic:    p.configTopic(e.component, e.id),
+		Payload:  payload,
+		Qos:      p.qos,
+		Retained: true,
+	})
+}
+
+// configTopic returns the discovery topic of an entity.
+func (p *Publisher) configTopic(component, id string) string {
+	return p.prefix + "/" + component + "/" + p.nodeID + "/" + id + "/config"
+}
+
+// orDefault returns topic or the default topic "<node id>/<id>/<suffix>".
+func (p *Publisher) orDefault(topic, id, suffix string) string {
+	if topic != "" {
+		return topic
+	}
+	return p.nodeID + "/" + id + "/" + suffix
+}
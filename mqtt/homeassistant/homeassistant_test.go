@@ -0,0 +1,224 @@
+package homeassistant
+
+import (
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/womat/golib/mqtt"
+	"github.com/womat/golib/mqtt/mqtttest"
+)
+
+func newTestBroker(t *testing.T, opts ...mqtttest.Option) *mqtttest.Broker {
+	t.Helper()
+	b, err := mqtttest.New(opts...)
+	if err != nil {
+		t.Fatalf("mqtttest.New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+	return b
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timeout waiting for %s", what)
+}
+
+// retainedJSON decodes the retained payload of a topic.
+func retainedJSON(t *testing.T, b *mqtttest.Broker, topic string) map[string]any {
+	t.Helper()
+	payload, ok := b.Retained(topic)
+	if !ok {
+		t.Fatalf("no retained message on %s", topic)
+	}
+	var v map[string]any
+	if err := json.Unmarshal(payload, &v); err != nil {
+		t.Fatalf("retained message on %s: %v", topic, err)
+	}
+	return v
+}
+
+func TestPublisher(t *testing.T) {
+	var configs atomic.Int32
+	b := newTestBroker(t, mqtttest.WithOnPublish(func(topic string, _ []byte) {
+		if topic == "homeassistant/sensor/boiler/temperature/config" {
+			configs.Add(1)
+		}
+	}))
+
+	h, err := mqtt.New(b.URL(), "boiler", mqtt.WithStatusTopic("boiler"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	ha := New(h, "boiler", Device{Name: "Boiler", Manufacturer: "womat"}, WithAvailabilityTopic("boiler/status"))
+	if err := ha.AddSensor(Sensor{ID: "temperature", Name: "Temperature", Unit: "°C", DeviceClass: "temperature", StateClass: "measurement"}); err != nil {
+		t.Fatalf("AddSensor() error = %v", err)
+	}
+	if err := ha.AddBinarySensor(BinarySensor{ID: "error", Name: "Error", DeviceClass: "problem"}); err != nil {
+		t.Fatalf("AddBinarySensor() error = %v", err)
+	}
+
+	c := retainedJSON(t, b, "homeassistant/sensor/boiler/temperature/config")
+	for key, want := range map[string]string{
+		"name":                "Temperature",
+		"unique_id":           "boiler_temperature",
+		"state_topic":         "boiler/temperature/state",
+		"unit_of_measurement": "°C",
+		"device_class":        "temperature",
+		"state_class":         "measurement",
+		"availability_topic":  "boiler/status",
+		"payload_available":   mqtt.StatusOnline,
+	} {
+		if c[key] != want {
+			t.Errorf("config[%q] = %v, want %q", key, c[key], want)
+		}
+	}
+	device, _ := c["device"].(map[string]any)
+	if ids, _ := device["identifiers"].([]any); device["name"] != "Boiler" || len(ids) != 1 || ids[0] != "boiler" {
+		t.Errorf("config[device] = %v", c["device"])
+	}
+	if c := retainedJSON(t, b, "homeassistant/binary_sensor/boiler/error/config"); c["payload_on"] != PayloadOn {
+		t.Errorf("binary sensor payload_on = %v, want %q", c["payload_on"], PayloadOn)
+	}
+
+	if err := ha.PublishState("temperature", "62.5"); err != nil {
+		t.Fatalf("PublishState() error = %v", err)
+	}
+	if payload, _ := b.Retained("boiler/temperature/state"); string(payload) != "62.5" {
+		t.Errorf("state = %q, want 62.5", payload)
+	}
+	if err := ha.PublishState("unknown", "1"); !errors.Is(err, ErrUnknownEntity) {
+		t.Errorf("PublishState() of unknown entity error = %v, want %v", err, ErrUnknownEntity)
+	}
+
+	// Home Assistant announces a restart with its birth message
+	if err := h.Publish(mqtt.Message{Topic: "homeassistant/status", Payload: []byte("online")}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	waitFor(t, "republished config", func() bool { return configs.Load() == 2 })
+
+	if err := ha.Remove("temperature"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, ok := b.Retained("homeassistant/sensor/boiler/temperature/config"); ok {
+		t.Errorf("config still retained after Remove()")
+	}
+}
+
+func TestSwitchAndButton(t *testing.T) {
+	b := newTestBroker(t)
+
+	h, err := mqtt.New(b.URL(), "boiler")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	ha := New(h, "boiler", Device{Name: "Boiler"})
+	var pump atomic.Bool
+	if err := ha.AddSwitch(Switch{ID: "pump", Name: "Pump"}, func(on bool) error {
+		pump.Store(on)
+		return nil
+	}); err != nil {
+		t.Fatalf("AddSwitch() error = %v", err)
+	}
+	var presses atomic.Int32
+	if err := ha.AddButton(Button{ID: "restart", DeviceClass: "restart"}, func() { presses.Add(1) }); err != nil {
+		t.Fatalf("AddButton() error = %v", err)
+	}
+
+	if c := retainedJSON(t, b, "homeassistant/switch/boiler/pump/config"); c["command_topic"] != "boiler/pump/set" {
+		t.Errorf("switch command_topic = %v, want boiler/pump/set", c["command_topic"])
+	}
+
+	if err := h.Publish(mqtt.Message{Topic: "boiler/pump/set", Payload: []byte(PayloadOn), Qos: 1}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	waitFor(t, "switch state", func() bool {
+		payload, _ := b.Retained("boiler/pump/state")
+		return string(payload) == PayloadOn
+	})
+	if !pump.Load() {
+		t.Errorf("switch callback not called with on")
+	}
+
+	if err := h.Publish(mqtt.Message{Topic: "boiler/restart/set", Payload: []byte(PayloadPress), Qos: 1}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	waitFor(t, "button press", func() bool { return presses.Load() == 1 })
+}
+
+func TestPublisherErrors(t *testing.T) {
+	b := newTestBroker(t)
+
+	h, err := mqtt.New(b.URL(), "boiler")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	ha := New(h, "boiler", Device{})
+	if err := ha.AddSensor(Sensor{ID: "a/b"}); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("AddSensor() with invalid id error = %v, want %v", err, ErrInvalidID)
+	}
+	if err := ha.AddSensor(Sensor{ID: "a"}); err != nil {
+		t.Fatalf("AddSensor() error = %v", err)
+	}
+	if err := ha.AddBinarySensor(BinarySensor{ID: "a"}); !errors.Is(err, ErrDuplicateID) {
+		t.Errorf("AddBinarySensor() with duplicate id error = %v, want %v", err, ErrDuplicateID)
+	}
+	if err := New(h, "boiler 1", Device{}).AddSensor(Sensor{ID: "a"}); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("AddSensor() with invalid node id error = %v, want %v", err, ErrInvalidID)
+	}
+	if err := ha.AddSwitch(Switch{ID: "s"}, nil); err == nil {
+		t.Errorf("AddSwitch() without callback: expected error")
+	}
+	if err := ha.Remove("unknown"); !errors.Is(err, ErrUnknownEntity) {
+		t.Errorf("Remove() of unknown entity error = %v, want %v", err, ErrUnknownEntity)
+	}
+}
+
+func TestAddRollback(t *testing.T) {
+	b := newTestBroker(t)
+
+	h, err := mqtt.New(b.URL(), "boiler")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	// the status topic "homeassistant/#/status" is no valid topic filter
+	ha := New(h, "boiler", Device{}, WithDiscoveryPrefix("homeassistant/#"))
+	if err := ha.AddSensor(Sensor{ID: "a"}); !errors.Is(err, mqtt.ErrInvalidTopicFilter) {
+		t.Errorf("AddSensor() error = %v, want %v", err, mqtt.ErrInvalidTopicFilter)
+	}
+	if len(ha.entities) != 0 || len(ha.order) != 0 || ha.watching {
+		t.Errorf("after failed AddSensor(): entities = %v, order = %v, watching = %v", ha.entities, ha.order, ha.watching)
+	}
+
+	ha = New(h, "boiler", Device{})
+	if err := ha.AddSwitch(Switch{ID: "pump", CommandTopic: "boiler/#/set"}, func(bool) error { return nil }); !errors.Is(err, mqtt.ErrInvalidTopicFilter) {
+		t.Errorf("AddSwitch() error = %v, want %v", err, mqtt.ErrInvalidTopicFilter)
+	}
+	if err := ha.AddButton(Button{ID: "restart", CommandTopic: "boiler/+restart"}, func() {}); !errors.Is(err, mqtt.ErrInvalidTopicFilter) {
+		t.Errorf("AddButton() error = %v, want %v", err, mqtt.ErrInvalidTopicFilter)
+	}
+	if _, ok := b.Retained("homeassistant/switch/boiler/pump/config"); ok {
+		t.Errorf("config of failed AddSwitch() retained")
+	}
+	if err := ha.AddSwitch(Switch{ID: "pump"}, func(bool) error { return nil }); err != nil {
+		t.Errorf("AddSwitch() after failed AddSwitch() error = %v", err)
+	}
+	if got := ha.order; len(got) != 1 || got[0] != "pump" {
+		t.Errorf("order = %v, want [pump]", got)
+	}
+}
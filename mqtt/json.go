@@ -0,0 +1,56 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// PublishOption sets a property of a message published by PublishJSON.
+type PublishOption func(*Message)
+
+// WithQos sets the QoS level of the message (default 0).
+func WithQos(qos byte) PublishOption {
+	return func(msg *Message) {
+		msg.Qos = qos
+	}
+}
+
+// WithRetained marks the message as retained.
+func WithRetained() PublishOption {
+	return func(msg *Message) {
+		msg.Retained = true
+	}
+}
+
+// PublishJSON publishes v as JSON to topic with p, e.g. a Handler.
+func PublishJSON[T any](p Publisher, topic string, v T, opts ...PublishOption) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode json: %w", err)
+	}
+
+	msg := Message{Topic: topic, Payload: payload}
+	for _, opt := range opts {
+		opt(&msg)
+	}
+	return p.Publish(msg)
+}
+
+// SubscribeJSON subscribes to topicFilter with s, e.g. a Handler, and decodes every payload
+// as JSON into T. If a payload cannot be decoded, handler is called with the zero
+// value of T and the decode error, e.g. to log invalid messages.
+func SubscribeJSON[T any](s Subscriber, topicFilter string, qos byte, handler func(topic string, v T, err error)) error {
+	if handler == nil {
+		return errors.New("mqtt subscribe handler must not be nil")
+	}
+	return s.Subscribe(topicFilter, qos, func(msg Message) {
+		var v T
+		if err := json.Unmarshal(msg.Payload, &v); err != nil {
+			var zero T
+			handler(msg.Topic, zero, fmt.Errorf("decode json: %w", err))
+			return
+		}
+		handler(msg.Topic, v, nil)
+	})
+}
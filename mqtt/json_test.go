@@ -0,0 +1,65 @@
+package mqtt
+
+import (
+	"sync"
+	"testing"
+)
+
+type reading struct {
+	Sensor string  `json:"sensor"`
+	Value  float64 `json:"value"`
+}
+
+func TestJSON(t *testing.T) {
+	b := newTestBroker(t)
+
+	h, err := New(b.URL(), "device")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	type result struct {
+		topic string
+		v     reading
+		err   error
+	}
+	var mu sync.Mutex
+	var got []result
+	results := func() []result {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]result(nil), got...)
+	}
+	if err := SubscribeJSON(h, "sensors/#", 1, func(topic string, v reading, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, result{topic, v, err})
+	}); err != nil {
+		t.Fatalf("SubscribeJSON() error = %v", err)
+	}
+
+	want := reading{Sensor: "temp", Value: 22.5}
+	if err := PublishJSON(h, "sensors/temp", want, WithQos(1), WithRetained()); err != nil {
+		t.Fatalf("PublishJSON() error = %v", err)
+	}
+	if err := h.Publish(Message{Topic: "sensors/broken", Payload: []byte("{"), Qos: 1}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	waitFor(t, "messages", func() bool { return len(results()) == 2 })
+
+	r := results()
+	if r[0].topic != "sensors/temp" || r[0].v != want || r[0].err != nil {
+		t.Errorf("message 0 = %+v, want %+v on sensors/temp", r[0], want)
+	}
+	if r[1].topic != "sensors/broken" || r[1].v != (reading{}) || r[1].err == nil {
+		t.Errorf("message 1 = %+v, want decode error", r[1])
+	}
+	if payload, ok := b.Retained("sensors/temp"); !ok || string(payload) != `{"sensor":"temp","value":22.5}` {
+		t.Errorf("retained payload = %s", payload)
+	}
+
+	if err := PublishJSON(h, "sensors/invalid", func() {}); err == nil {
+		t.Errorf("PublishJSON() with a func: expected error")
+	}
+}
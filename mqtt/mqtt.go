@@ -1,13 +1,24 @@
 // Package mqtt provides a thread-safe MQTT client handler for Go.
 //
-// This package wraps the Eclipse Paho MQTT library to provide a simple, safe interface
+// This package wraps the Eclipse Paho MQTT libraries to provide a simple, safe interface
 // for connecting to a broker, publishing messages, and handling reconnections.
+// MQTT 3.1.1 (default) and MQTT 5 are supported, see WithProtocolVersion.
 //
 // Features:
 //   - Thread-safe Handler for a single MQTT client
 //   - Automatic reconnect and retry on connection loss
-//   - Synchronous publish with timeout support
-//   - Optional callbacks for connection and disconnection events
+//   - Synchronous publish with timeout and context support, asynchronous and batch publish
+//   - Subscriptions with wildcard routing, renewed automatically after a reconnect
+//   - Typed JSON helpers PublishJSON and SubscribeJSON
+//   - keyvalue.Record as JSON document or flattened to one topic per key
+//   - Request/response calls with Call and Serve
+//   - Publisher, Subscriber and Connection interfaces with logging, rate limiting,
+//     deduplicating, throttling (deadband) and fan-out publisher decorators
+//   - Username/password authentication, TLS with custom CAs and client certificates
+//   - Last will, birth message and a retained online/offline status topic
+//   - Optional bounded offline queue for Publish, in memory or on disk
+//   - Configurable timeouts, keepalive, clean session and reconnect backoff
+//   - Optional callbacks for connection and disconnection events, and ConnectionState()
 //   - Safe initialization and shutdown of the client
 //
 // Example usage:
@@ -34,46 +45,90 @@
 //	if err := handler.Publish(msg); err != nil {
 //	    log.Println("Publish failed:", err)
 //	}
+//
+//	err = handler.Subscribe("commands/+/set", 1, func(msg mqtt.Message) {
+//	    log.Println("command:", msg.Topic, string(msg.Payload))
+//	})
 package mqtt
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
-
-	mqttlib "github.com/eclipse/paho.mqtt.golang"
 )
 
 const (
-	// connectTimeout defines the maximum duration to wait for the initial broker connection.
+	// defaultConnectTimeout defines the maximum duration to wait for the initial broker connection.
 	// After this timeout, the handler will retry connecting in the background.
-	connectTimeout = 5 * time.Second
+	defaultConnectTimeout = 5 * time.Second
 
-	// retryInterval defines the wait time between automatic reconnect attempts
-	// when the connection to the broker is lost.
-	retryInterval = 2 * time.Second
+	// defaultRetryInterval defines the wait time between attempts of the initial connect.
+	defaultRetryInterval = 2 * time.Second
 
-	// publishTimeout defines the maximum duration to wait for a Publish() token to complete.
+	// defaultPublishTimeout defines the maximum duration to wait for a Publish() token to complete.
 	// If the token is not done within this time, Publish() returns an error.
-	publishTimeout = 5 * time.Second
+	defaultPublishTimeout = 5 * time.Second
 
-	// quiesce is the duration in milliseconds to wait during Disconnect()
+	// subscribeTimeout defines the maximum duration to wait for the broker to acknowledge
+	// a Subscribe() or Unsubscribe().
+	subscribeTimeout = 5 * time.Second
+
+	// defaultQuiesce is the duration to wait during Disconnect()
 	// for any pending work to complete.
-	quiesce = 250
+	defaultQuiesce = 250 * time.Millisecond
 )
 
 var (
 	ErrClientNotInitialized = errors.New("mqtt client not initialized")
 	ErrTopicEmpty           = errors.New("mqtt topic must not be empty")
 	ErrTimeout              = errors.New("publish timeout")
+	ErrSubscribeTimeout     = errors.New("subscribe timeout")
+	ErrConnectTimeout       = errors.New("connect timeout")
+	ErrNotConnected         = errors.New("mqtt client not connected")
 )
 
 // Handler manages a thread-safe MQTT client connection.
 type Handler struct {
 	mu               sync.Mutex
-	client           mqttlib.Client
+	client           backend
 	onConnected      func()
 	onConnectionLost func(err error)
+	lastErr          error           // last connection error, see ConnectionState
+	subscriptions    []*subscription // handlers registered with Subscribe, renewed on reconnect
+
+	credentials func() (username, password string) // optional broker credentials
+	tlsConfig   *tls.Config                        // optional TLS configuration
+	caFile      string                             // optional PEM file with CA certificates
+	certFile    string                             // optional PEM file with the client certificate
+	keyFile     string                             // optional PEM file with the client key
+
+	will  *Message // optional Last Will and Testament
+	birth *Message // optional message published after every connect
+	death *Message // optional message published before Disconnect (WithStatusTopic)
+
+	queueSize int           // size of the offline queue, 0 disables it
+	queueDir  string        // optional directory of the persistent offline queue
+	queue     *offlineQueue // queued messages waiting for a connection
+
+	connectTimeout       time.Duration // wait time for the initial connect
+	retryInterval        time.Duration // wait time between attempts of the initial connect
+	publishTimeout       time.Duration // wait time for a publish acknowledgement
+	quiesce              time.Duration // wait time for pending work during Disconnect
+	keepAlive            time.Duration // keepalive interval, 0 uses the paho default
+	maxReconnectInterval time.Duration // upper limit of the reconnect backoff, 0 uses the paho default
+	cleanSession         bool          // start every connection with a clean session
+	waitForConnection    bool          // New fails if the initial connect fails
+
+	clientID     string                  // client identifier, used for the RPC reply topic
+	protocol     ProtocolVersion         // MQTT protocol version, see WithProtocolVersion
+	topicAliases bool                    // use MQTT 5 topic aliases for QoS 0 messages
+	properties   bool                    // the protocol transports the MQTT 5 properties of a Message
+	rpcMu        sync.Mutex              // serializes the subscription of the RPC reply topic
+	rpc          map[string]chan Message // pending Call() requests by correlation id, nil until subscribed
+	replies      *subscription           // subscription of the RPC reply topic, removed by Unsubscribe
 }
 
 // Message contains the properties of the mqtt message
@@ -82,6 +137,13 @@ type Message struct {
 	Payload  []byte
 	Qos      byte
 	Retained bool
+
+	// MQTT 5 properties; the MQTT 3.1.1 client neither sends nor receives them.
+	ResponseTopic   string            // topic for the response to a request
+	CorrelationData []byte            // identifies the request a response belongs to
+	UserProperties  map[string]string // application defined key/value pairs
+	ContentType     string            // MIME type of the payload, e.g. "application/json"
+	MessageExpiry   time.Duration     // the broker discards the message if it is not delivered in time, 0 = never
 }
 
 // Option configures a Handler.
@@ -91,53 +153,88 @@ type Option func(*Handler)
 //
 // It sets up the client with automatic reconnect and retry on connection loss.
 // The initial connection is attempted synchronously with a timeout. If it fails
-// or times out, the Handler is still returned and will retry in the background.
+// or times out, the Handler is still returned and will retry in the background,
+// unless WithWaitForConnection is set.
 //
 // Optional callbacks for connection events can be provided via opts.
 //
 // Parameters:
 //   - broker:		the MQTT broker URL (e.g., "tcp://localhost:1883")
 //   - clientID: 	a unique client identifier
-//   - opts: 		optional functional options, e.g. WithOnConnected, WithOnConnectionLost
+//   - opts: 		optional functional options, e.g. WithOnConnected, WithCredentials, WithCAFile
 //
 // Returns:
 //   - *Handler: the initialized MQTT Handler, ready to use
-//   - error:    only returned if the client cannot be created
+//   - error:    returned if the client cannot be created, e.g. a certificate file cannot be loaded,
+//     or with WithWaitForConnection if the initial connect fails
 func New(broker, clientID string, opts ...Option) (*Handler, error) {
-	h := &Handler{}
+	h := &Handler{
+		connectTimeout: defaultConnectTimeout,
+		retryInterval:  defaultRetryInterval,
+		publishTimeout: defaultPublishTimeout,
+		quiesce:        defaultQuiesce,
+		cleanSession:   true,
+		clientID:       clientID,
+		protocol:       MQTT311,
+	}
 
 	for _, opt := range opts {
 		opt(h)
 	}
 
-	mqttOpts := mqttlib.NewClientOptions().
-		AddBroker(broker).
-		SetClientID(clientID).
-		SetAutoReconnect(true).
-		SetConnectRetry(true).
-		SetConnectRetryInterval(retryInterval).
-		SetConnectionLostHandler(func(_ mqttlib.Client, err error) {
-			if h.onConnectionLost != nil {
-				h.onConnectionLost(err)
-			}
-		}).
-		SetOnConnectHandler(func(_ mqttlib.Client) {
-			if h.onConnected != nil {
-				h.onConnected()
-			}
-		})
+	tlsConfig, err := h.buildTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := h.validateStatusMessages(); err != nil {
+		return nil, err
+	}
+	if err := h.validateTimeouts(); err != nil {
+		return nil, err
+	}
+	if h.queueSize != 0 || h.queueDir != "" {
+		if h.queue, err = newOfflineQueue(h.queueSize, h.queueDir, h.publishTimeout); err != nil {
+			return nil, err
+		}
+	}
 
-	client := mqttlib.NewClient(mqttOpts)
-	h.client = client
+	var client backend
+	switch h.protocol {
+	case MQTT311:
+		client = newV3Backend(h, broker, tlsConfig)
+	case MQTT5:
+		if client, err = newV5Backend(h, broker, tlsConfig); err != nil {
+			return nil, err
+		}
+		h.properties = true
+	default:
+		return nil, fmt.Errorf("unsupported mqtt protocol version: %v", h.protocol)
+	}
 
-	token := client.Connect()
-	if !token.WaitTimeout(connectTimeout) {
-		return h, nil // Paho retries in the background, so we return the handler even if the initial connect times out
+	if err := waitToken(client.connect(), h.connectTimeout, ErrConnectTimeout); err != nil {
+		if last := h.ConnectionState().LastError; errors.Is(err, ErrConnectTimeout) && last != nil {
+			err = fmt.Errorf("%w: %w", err, last) // the reason of the failed attempts
+		}
+		h.setLastError(err)
+		if h.waitForConnection {
+			client.disconnect(0)
+			return nil, fmt.Errorf("failed to connect to mqtt broker %s: %w", broker, err)
+		}
+		// the client retries in the background, so we return the handler even if the initial connect fails or times out
 	}
 
-	// Initially connect (non-blocking retries are handled by Paho)
-	if err := token.Error(); err != nil {
-		return h, nil // Paho retries in the background, so we return the handler even if the initial connect fails
+	h.mu.Lock()
+	h.client = client
+	h.mu.Unlock()
+
+	if h.queue != nil {
+		h.queue.run(func() backend {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			return h.client
+		})
+		// flush messages persisted by a previous Handler
+		h.queue.wake()
 	}
 
 	return h, nil
@@ -163,7 +260,9 @@ func WithOnConnectionLost(fn func(err error)) Option {
 // actually disconnecting, so that concurrent Publish or Connect calls
 // will see the client as uninitialized.
 //
-// The disconnect uses a quiesce period to allow pending work to complete.
+// The disconnect uses a quiesce period (see WithQuiesce) to allow pending work to complete.
+// With WithStatusTopic the offline status is published first.
+// Messages in a persistent offline queue are kept for the next Handler.
 // If no client is initialized, this method does nothing.
 func (m *Handler) Disconnect() {
 	m.mu.Lock()
@@ -172,35 +271,34 @@ func (m *Handler) Disconnect() {
 	m.mu.Unlock()
 
 	if client != nil {
-		client.Disconnect(quiesce)
+		if m.queue != nil {
+			m.queue.stop()
+		}
+		m.publishDeath(client)
+		client.disconnect(m.quiesce)
 	}
 }
 
 // Publish sends a message to the MQTT broker synchronously.
-// It waits up to publishTimeout for the broker to acknowledge the message.
+// It waits up to the publish timeout (see WithPublishTimeout) for the broker to acknowledge the message.
+//
+// With WithOfflineQueue or WithPersistentQueue the message is queued instead if the
+// client is not connected, the queue is not empty yet or the publish fails.
 func (m *Handler) Publish(msg Message) error {
-	if msg.Topic == "" {
-		return ErrTopicEmpty
-	}
-
-	m.mu.Lock()
-	client := m.client
-	m.mu.Unlock()
-
-	if client == nil {
-		return ErrClientNotInitialized
-	}
+	return m.PublishContext(context.Background(), msg)
+}
 
-	token := client.Publish(msg.Topic, msg.Qos, msg.Retained, msg.Payload)
+// waitToken waits up to timeout for a token and returns its error or timeoutErr.
+func waitToken(t token, timeout time.Duration, timeoutErr error) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 
-	if !token.WaitTimeout(publishTimeout) {
-		return ErrTimeout
+	select {
+	case <-t.Done():
+		return t.Error()
+	case <-timer.C:
+		return timeoutErr
 	}
-	if err := token.Error(); err != nil {
-		return err
-	}
-
-	return nil
 }
 
 // IsConnected reports whether the MQTT client is currently connected.
@@ -213,5 +311,5 @@ func (m *Handler) IsConnected() bool {
 	if client == nil {
 		return false
 	}
-	return client.IsConnected()
+	return client.isConnected()
 }
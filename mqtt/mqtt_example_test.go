@@ -3,11 +3,19 @@ package mqtt
 import (
 	"log/slog"
 	"testing"
+	"time"
+
+	"github.com/womat/golib/mqtt/mqtttest"
 )
 
 func Test_Example(t *testing.T) {
+	b, err := mqtttest.New()
+	if err != nil {
+		t.Fatalf("Failed to start MQTT broker: %v", err)
+	}
+	defer b.Close()
 
-	broker := "tcp://mysmarthome:1883"
+	broker := b.URL()
 
 	m, err := New(broker, "clientID",
 		WithOnConnected(func() {
@@ -22,6 +30,11 @@ func Test_Example(t *testing.T) {
 
 	defer m.Disconnect()
 
+	received := make(chan Message, 1)
+	if err = m.Subscribe("test/#", 1, func(msg Message) { received <- msg }); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
 	msg := Message{
 		Topic:   "test/temperature",
 		Payload: []byte("22.5"),
@@ -31,4 +44,13 @@ func Test_Example(t *testing.T) {
 	if err = m.Publish(msg); err != nil {
 		t.Errorf("Failed to publish MQTT message: %v", err)
 	}
+
+	select {
+	case got := <-received:
+		if got.Topic != msg.Topic || string(got.Payload) != string(msg.Payload) {
+			t.Errorf("Received %+v, want %+v", got, msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Timeout waiting for MQTT message")
+	}
 }
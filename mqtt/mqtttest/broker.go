@@ -0,0 +1,460 @@
+// Package mqtttest provides a minimal in-process MQTT 3.1.1 and MQTT 5 broker for tests.
+//
+// The broker listens on a random localhost port and supports QoS 0 and 1 (QoS 2
+// publishes are acknowledged and delivered with QoS 1), retained messages, wildcard
+// and shared subscriptions, last will messages, username/password authentication, topic
+// authorization and TLS.
+// MQTT 5 clients may use topic aliases; the properties of their messages are forwarded
+// to MQTT 5 subscribers. Sessions are not persisted: every connection starts with a
+// clean session.
+//
+//	b, err := mqtttest.New()
+//	...
+//	defer b.Close()
+//	h, err := mqtt.New(b.URL(), "client")
+//
+// Messages can be published by the broker itself with Publish and observed with WithOnPublish.
+package mqtttest
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	packets5 "github.com/eclipse/paho.golang/packets"
+)
+
+// topicAliasMaximum is the number of topic aliases an MQTT 5 client may use.
+const topicAliasMaximum = 10
+
+// Broker is a minimal in-process MQTT broker.
+type Broker struct {
+	address      string
+	tlsConfig    *tls.Config
+	authenticate func(username, password string) bool
+	authorize    func(clientID, topic string, subscribe bool) bool
+	onPublish    func(topic string, payload []byte)
+
+	ln       net.Listener
+	mu       sync.Mutex
+	conns    map[string]*conn    // connected clients by client id
+	retained map[string]*message // retained messages by topic
+	aliased  int                 // number of messages received with a topic alias only
+	wg       sync.WaitGroup
+}
+
+// message is a published message, independent of the protocol version.
+type message struct {
+	topic   string
+	payload []byte
+	qos     byte
+	retain  bool
+	props   *packets5.Properties // MQTT 5 properties, nil from MQTT 3.1.1 clients
+}
+
+// Option configures a Broker.
+type Option func(*Broker)
+
+// WithAddress sets the listen address (default "127.0.0.1:0", a random port),
+// e.g. to restart a broker on the address of a closed one.
+func WithAddress(address string) Option {
+	return func(b *Broker) {
+		b.address = address
+	}
+}
+
+// WithTLS enables TLS with the given server configuration. Set ClientAuth and ClientCAs
+// to require client certificates.
+func WithTLS(cfg *tls.Config) Option {
+	return func(b *Broker) {
+		b.tlsConfig = cfg
+	}
+}
+
+// WithAuthentication sets a function that checks the username and password of a client.
+// Without this option every client is accepted.
+func WithAuthentication(fn func(username, password string) bool) Option {
+	return func(b *Broker) {
+		b.authenticate = fn
+	}
+}
+
+// WithAuthorization sets a function that checks whether a client may publish to a topic,
+// or subscribe to a topic filter if subscribe is set. A refused message is acknowledged,
+// with reason code 0x87 "not authorized" for MQTT 5 clients, but not delivered. A refused
+// subscription is answered with the SUBACK return code 0x80 (MQTT 3.1.1) or 0x87 (MQTT 5).
+// Without this option everything is allowed.
+func WithAuthorization(fn func(clientID, topic string, subscribe bool) bool) Option {
+	return func(b *Broker) {
+		b.authorize = fn
+	}
+}
+
+// WithOnPublish sets a function that is called for every message published to the broker,
+// in the order of arrival.
+func WithOnPublish(fn func(topic string, payload []byte)) Option {
+	return func(b *Broker) {
+		b.onPublish = fn
+	}
+}
+
+// New starts a broker.
+func New(opts ...Option) (*Broker, error) {
+	b := &Broker{
+		address:  "127.0.0.1:0",
+		conns:    make(map[string]*conn),
+		retained: make(map[string]*message),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	ln, err := net.Listen("tcp", b.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+	if b.tlsConfig != nil {
+		ln = tls.NewListener(ln, b.tlsConfig)
+	}
+	b.ln = ln
+
+	b.wg.Add(1)
+	go b.accept()
+	return b, nil
+}
+
+// URL returns the broker URL for mqtt.New, e.g. "tcp://127.0.0.1:35121" or "ssl://..." with TLS.
+func (b *Broker) URL() string {
+	scheme := "tcp"
+	if b.tlsConfig != nil {
+		scheme = "ssl"
+	}
+	return scheme + "://" + b.Addr()
+}
+
+// Addr returns the listen address of the broker.
+func (b *Broker) Addr() string {
+	return b.ln.Addr().String()
+}
+
+// Retained returns the retained payload of a topic.
+func (b *Broker) Retained(topic string) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	msg, ok := b.retained[topic]
+	if !ok {
+		return nil, false
+	}
+	return msg.payload, true
+}
+
+// Publish delivers a message to all matching subscribers as if a client had published it,
+// e.g. to test the message handlers of an application without a second client.
+// A retained message with an empty payload deletes the retained message of the topic.
+func (b *Broker) Publish(topic string, payload []byte, qos byte, retained bool) {
+	b.publish(&message{topic: topic, payload: payload, qos: qos, retain: retained})
+}
+
+// AliasedMessages returns the number of MQTT 5 messages received with a topic alias
+// instead of the topic.
+func (b *Broker) AliasedMessages() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.aliased
+}
+
+// DisconnectClients closes all client connections without a DISCONNECT packet,
+// like a network failure; the last will messages of the clients are published.
+func (b *Broker) DisconnectClients() {
+	b.mu.Lock()
+	conns := make([]*conn, 0, len(b.conns))
+	for _, c := range b.conns {
+		conns = append(conns, c)
+	}
+	b.mu.Unlock()
+
+	for _, c := range conns {
+		_ = c.Close()
+	}
+}
+
+// DisconnectClient closes the connection of a client like DisconnectClients.
+// It reports false if the client is not connected.
+func (b *Broker) DisconnectClient(clientID string) bool {
+	b.mu.Lock()
+	c, ok := b.conns[clientID]
+	b.mu.Unlock()
+
+	if ok {
+		_ = c.Close()
+	}
+	return ok
+}
+
+// Close stops the broker and closes all client connections.
+func (b *Broker) Close() error {
+	err := b.ln.Close()
+	b.DisconnectClients()
+	b.wg.Wait()
+	return err
+}
+
+// accept accepts client connections until the listener is closed.
+func (b *Broker) accept() {
+	defer b.wg.Done()
+
+	for {
+		nc, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			b.serve(&conn{Conn: nc, r: bufio.NewReader(nc), subscriptions: make(map[string]byte)})
+		}()
+	}
+}
+
+// conn is a client connection.
+type conn struct {
+	net.Conn
+	r             *bufio.Reader
+	version       byte // protocol level of the CONNECT packet: 4 = 3.1.1, 5 = 5
+	writeMu       sync.Mutex
+	id            string
+	subscriptions map[string]byte // topic filter → QoS, protected by Broker.mu
+	will          *message
+	messageID     uint16            // protected by Broker.mu
+	aliases       map[uint16]string // topic aliases of the client (MQTT 5)
+}
+
+// write sends a packet to the client.
+func (c *conn) write(p io.WriterTo) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := p.WriteTo(c.Conn)
+	return err
+}
+
+// serve handles a client connection with the protocol version of its CONNECT packet.
+func (b *Broker) serve(c *conn) {
+	defer c.Close()
+
+	version, err := protocolVersion(c.r)
+	if err != nil {
+		return
+	}
+	c.version = version
+	if version == 5 {
+		b.serveV5(c)
+	} else {
+		b.serveV3(c)
+	}
+}
+
+// protocolVersion peeks at the protocol level of the CONNECT packet.
+func protocolVersion(r *bufio.Reader) (byte, error) {
+	header, err := r.Peek(2)
+	if err != nil {
+		return 0, err
+	}
+	if header[0]>>4 != packets5.CONNECT {
+		return 0, fmt.Errorf("expected CONNECT, got packet type %d", header[0]>>4)
+	}
+
+	// fixed header: type, remaining length (1-4 bytes); variable header: protocol name, level
+	n := 1
+	for {
+		b, err := r.Peek(n + 1)
+		if err != nil {
+			return 0, err
+		}
+		n++
+		if b[n-1]&0x80 == 0 || n == 5 {
+			break
+		}
+	}
+	b, err := r.Peek(n + 2)
+	if err != nil {
+		return 0, err
+	}
+	nameLen := int(b[n])<<8 | int(b[n+1])
+	b, err = r.Peek(n + 2 + nameLen + 1)
+	if err != nil {
+		return 0, err
+	}
+	return b[n+2+nameLen], nil
+}
+
+// register registers an authenticated client; an existing connection with the
+// same client id is taken over.
+func (b *Broker) register(c *conn) {
+	b.mu.Lock()
+	old := b.conns[c.id]
+	b.conns[c.id] = c
+	b.mu.Unlock()
+	if old != nil {
+		_ = old.Close()
+	}
+}
+
+// unregister removes a closed connection and publishes its will unless it disconnected cleanly.
+func (b *Broker) unregister(c *conn, clean bool) {
+	b.mu.Lock()
+	if b.conns[c.id] == c {
+		delete(b.conns, c.id)
+	}
+	b.mu.Unlock()
+	if !clean && c.will != nil {
+		b.publish(c.will)
+	}
+}
+
+// authorized reports whether a client may publish to a topic or subscribe to a topic filter.
+func (b *Broker) authorized(c *conn, topic string, subscribe bool) bool {
+	return b.authorize == nil || b.authorize(c.id, topic, subscribe)
+}
+
+// subscribe registers the topic filters of a client and returns the granted QoS
+// levels, or the failure return code of refused filters, and the matching retained messages.
+func (b *Broker) subscribe(c *conn, filters []string, qos []byte) ([]byte, []*message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var granted []byte
+	var retained []*message
+	for i, filter := range filters {
+		if !b.authorized(c, filter, true) {
+			code := byte(0x80)
+			if c.version == 5 {
+				code = packets5.SubackNotauthorized
+			}
+			granted = append(granted, code)
+			continue
+		}
+		q := min(qos[i], 1)
+		c.subscriptions[filter] = q
+		granted = append(granted, q)
+
+		for topic, msg := range b.retained {
+			if matchTopic(filter, topic) {
+				retained = append(retained, &message{topic: topic, payload: msg.payload, qos: q, retain: true, props: msg.props})
+			}
+		}
+	}
+	return granted, retained
+}
+
+// unsubscribe removes topic filters of a client.
+func (b *Broker) unsubscribe(c *conn, filters []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, filter := range filters {
+		delete(c.subscriptions, filter)
+	}
+}
+
+// publish stores retained messages and delivers a message to all matching subscribers.
+// Of all clients with a shared subscription of the same group, only one receives the message.
+func (b *Broker) publish(msg *message) {
+	if b.onPublish != nil {
+		b.onPublish(msg.topic, msg.payload)
+	}
+
+	b.mu.Lock()
+	if msg.retain {
+		if len(msg.payload) == 0 {
+			delete(b.retained, msg.topic)
+		} else {
+			b.retained[msg.topic] = msg
+		}
+	}
+
+	type target struct {
+		c   *conn
+		qos byte
+	}
+	var targets []target
+	groups := make(map[string]bool) // shared subscriptions that already have a receiver
+	for _, c := range b.conns {
+		matched, qos := false, byte(0)
+		for filter, q := range c.subscriptions {
+			group, f := sharedFilter(filter)
+			if !matchTopic(f, msg.topic) || (group != "" && groups[group+"/"+f]) {
+				continue
+			}
+			if group != "" {
+				groups[group+"/"+f] = true
+			}
+			matched, qos = true, max(qos, q)
+		}
+		if matched {
+			targets = append(targets, target{c: c, qos: min(qos, msg.qos, 1)})
+		}
+	}
+	b.mu.Unlock()
+
+	for _, t := range targets {
+		b.deliver(t.c, &message{topic: msg.topic, payload: msg.payload, qos: t.qos, props: msg.props})
+	}
+}
+
+// deliver sends a message to a client; acknowledgements are not awaited.
+func (b *Broker) deliver(c *conn, msg *message) {
+	var id uint16
+	if msg.qos > 0 {
+		b.mu.Lock()
+		c.messageID++
+		if c.messageID == 0 {
+			c.messageID = 1
+		}
+		id = c.messageID
+		b.mu.Unlock()
+	}
+
+	if c.version == 5 {
+		_ = c.write(publishV5(msg, id))
+	} else {
+		_ = c.write(publishV3(msg, id))
+	}
+}
+
+// sharedFilter splits a shared subscription "$share/<group>/<filter>";
+// the group is empty for other filters.
+func sharedFilter(filter string) (group, f string) {
+	rest, ok := strings.CutPrefix(filter, "$share/")
+	if !ok {
+		return "", filter
+	}
+	group, f, _ = strings.Cut(rest, "/")
+	return group, f
+}
+
+// matchTopic reports whether topic matches the topic filter.
+func matchTopic(filter, topic string) bool {
+	if _, f := sharedFilter(filter); f != filter {
+		filter = f
+	}
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		switch {
+		case level == "#":
+			return true
+		case i >= len(topicLevels):
+			return false
+		case level != "+" && level != topicLevels[i]:
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
@@ -0,0 +1,340 @@
+package mqtttest_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/womat/golib/mqtt"
+	"github.com/womat/golib/mqtt/mqtttest"
+)
+
+var versions = []mqtt.ProtocolVersion{mqtt.MQTT311, mqtt.MQTT5}
+
+func newBroker(t *testing.T, opts ...mqtttest.Option) *mqtttest.Broker {
+	t.Helper()
+	b, err := mqtttest.New(opts...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+	return b
+}
+
+func connect(t *testing.T, url, clientID string, opts ...mqtt.Option) *mqtt.Handler {
+	t.Helper()
+	h, err := mqtt.New(url, clientID, append(opts, mqtt.WithWaitForConnection(), mqtt.WithConnectTimeout(time.Second))...)
+	if err != nil {
+		t.Fatalf("mqtt.New(%s) error = %v", clientID, err)
+	}
+	t.Cleanup(h.Disconnect)
+	return h
+}
+
+// inbox collects the messages received by a subscription.
+type inbox struct {
+	mu   sync.Mutex
+	msgs []mqtt.Message
+}
+
+func (i *inbox) handle(msg mqtt.Message) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.msgs = append(i.msgs, msg)
+}
+
+func (i *inbox) get() []mqtt.Message {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]mqtt.Message(nil), i.msgs...)
+}
+
+// wait waits for n messages.
+func (i *inbox) wait(t *testing.T, n int) []mqtt.Message {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if msgs := i.get(); len(msgs) >= n {
+			return msgs
+		}
+	}
+	t.Fatalf("timeout waiting for %d messages, got %d", n, len(i.get()))
+	return nil
+}
+
+// subscribe registers an inbox for topicFilter.
+func subscribe(t *testing.T, h *mqtt.Handler, topicFilter string, qos byte) *inbox {
+	t.Helper()
+	var in inbox
+	if err := h.Subscribe(topicFilter, qos, in.handle); err != nil {
+		t.Fatalf("Subscribe(%s) error = %v", topicFilter, err)
+	}
+	return &in
+}
+
+func TestQos(t *testing.T) {
+	for _, v := range versions {
+		t.Run(v.String(), func(t *testing.T) {
+			b := newBroker(t)
+			h := connect(t, b.URL(), "client", mqtt.WithProtocolVersion(v), mqtt.WithPublishTimeout(time.Second))
+			qos0 := subscribe(t, h, "qos0/#", 0)
+			qos1 := subscribe(t, h, "qos1/#", 1)
+
+			// Publish of QoS 1 and 2 returns after the acknowledgement of the broker
+			for qos := range byte(3) {
+				for _, prefix := range []string{"qos0/", "qos1/"} {
+					if err := h.Publish(mqtt.Message{Topic: prefix + "x", Payload: []byte{'0' + qos}, Qos: qos}); err != nil {
+						t.Fatalf("Publish() with qos %d error = %v", qos, err)
+					}
+				}
+			}
+
+			// the delivered QoS is the minimum of the published and subscribed QoS, at most 1
+			for _, tt := range []struct {
+				in   *inbox
+				want []byte
+			}{{qos0, []byte{0, 0, 0}}, {qos1, []byte{0, 1, 1}}} {
+				msgs := tt.in.wait(t, 3)
+				for i, msg := range msgs {
+					if msg.Qos != tt.want[i] {
+						t.Errorf("%s %s delivered with qos %d, want %d", msg.Topic, msg.Payload, msg.Qos, tt.want[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRetained(t *testing.T) {
+	for _, v := range versions {
+		t.Run(v.String(), func(t *testing.T) {
+			b := newBroker(t)
+			h := connect(t, b.URL(), "client", mqtt.WithProtocolVersion(v))
+
+			if err := h.Publish(mqtt.Message{Topic: "state/a", Payload: []byte("on"), Qos: 1, Retained: true}); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+			b.Publish("state/b", []byte("off"), 1, true)
+			if payload, ok := b.Retained("state/a"); !ok || string(payload) != "on" {
+				t.Errorf("Retained(state/a) = %q, %v, want on", payload, ok)
+			}
+
+			// a new subscription receives the retained messages with the retained flag
+			in := subscribe(t, h, "state/+", 1)
+			msgs := in.wait(t, 2)
+			for _, msg := range msgs {
+				if !msg.Retained {
+					t.Errorf("retained message %s delivered without retained flag", msg.Topic)
+				}
+			}
+
+			// a retained message with an empty payload deletes the retained message
+			if err := h.Publish(mqtt.Message{Topic: "state/a", Qos: 1, Retained: true}); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+			b.Publish("state/b", nil, 1, true)
+			in.wait(t, 4)
+			for _, topic := range []string{"state/a", "state/b"} {
+				if _, ok := b.Retained(topic); ok {
+					t.Errorf("Retained(%s) after delete: still retained", topic)
+				}
+			}
+			late := subscribe(t, h, "state/#", 1)
+			time.Sleep(50 * time.Millisecond)
+			if n := len(late.get()); n != 0 {
+				t.Errorf("new subscription received %d deleted retained messages", n)
+			}
+		})
+	}
+}
+
+func TestWildcards(t *testing.T) {
+	b := newBroker(t)
+	h := connect(t, b.URL(), "client")
+	plus := subscribe(t, h, "home/+/temperature", 1)
+	hash := subscribe(t, h, "home/#", 1)
+	all := subscribe(t, h, "#", 1)
+
+	for _, topic := range []string{"home/kitchen/temperature", "home/kitchen/humidity", "home", "$SYS/uptime"} {
+		b.Publish(topic, []byte(topic), 1, false)
+	}
+	b.Publish("end", nil, 1, false)
+	all.wait(t, 4)
+
+	for _, tt := range []struct {
+		name string
+		in   *inbox
+		want []string
+	}{
+		{"home/+/temperature", plus, []string{"home/kitchen/temperature"}},
+		{"home/#", hash, []string{"home/kitchen/temperature", "home/kitchen/humidity", "home"}},
+		{"#", all, []string{"home/kitchen/temperature", "home/kitchen/humidity", "home", "end"}},
+	} {
+		var got []string
+		for _, msg := range tt.in.get() {
+			got = append(got, msg.Topic)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s received %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s received %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestSharedSubscription(t *testing.T) {
+	b := newBroker(t)
+	var inboxes []*inbox
+	for _, id := range []string{"worker1", "worker2"} {
+		inboxes = append(inboxes, subscribe(t, connect(t, b.URL(), id), "$share/workers/jobs", 1))
+	}
+
+	for range 10 {
+		b.Publish("jobs", []byte("job"), 1, false)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := len(inboxes[0].get()) + len(inboxes[1].get()); n != 10 {
+		t.Errorf("the group received %d messages, want 10", n)
+	}
+}
+
+func TestLastWill(t *testing.T) {
+	for _, v := range versions {
+		t.Run(v.String(), func(t *testing.T) {
+			b := newBroker(t)
+			observer := subscribe(t, connect(t, b.URL(), "observer"), "devices/+/status", 1)
+			will := mqtt.WithWill(mqtt.Message{Topic: "devices/lost/status", Payload: []byte("offline"), Qos: 1, Retained: true})
+
+			// a clean disconnect does not publish the will
+			h := connect(t, b.URL(), "clean", mqtt.WithProtocolVersion(v), will)
+			h.Disconnect()
+
+			// a lost connection publishes it
+			connect(t, b.URL(), "lost", mqtt.WithProtocolVersion(v), will)
+			if !b.DisconnectClient("lost") {
+				t.Fatal("DisconnectClient() = false, want true")
+			}
+			observer.wait(t, 1)
+			time.Sleep(50 * time.Millisecond)
+			if msgs := observer.get(); len(msgs) != 1 || string(msgs[0].Payload) != "offline" {
+				t.Errorf("received %v, want one will message", msgs)
+			}
+			if payload, _ := b.Retained("devices/lost/status"); string(payload) != "offline" {
+				t.Errorf("retained will = %q, want offline", payload)
+			}
+		})
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	b := newBroker(t, mqtttest.WithAuthentication(func(username, password string) bool {
+		return username == "user" && password == "secret"
+	}))
+	for _, v := range versions {
+		t.Run(v.String(), func(t *testing.T) {
+			connect(t, b.URL(), "valid", mqtt.WithProtocolVersion(v), mqtt.WithCredentials("user", "secret"))
+			_, err := mqtt.New(b.URL(), "invalid", mqtt.WithProtocolVersion(v), mqtt.WithCredentials("user", "wrong"),
+				mqtt.WithWaitForConnection(), mqtt.WithConnectTimeout(time.Second))
+			if err == nil {
+				t.Error("mqtt.New() with wrong password: expected error")
+			}
+		})
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	b := newBroker(t, mqtttest.WithAuthorization(func(clientID, topic string, subscribe bool) bool {
+		return clientID == "admin" || (!subscribe && topic != "admin/cmd") || (subscribe && topic == "public/#")
+	}))
+	for _, v := range versions {
+		t.Run(v.String(), func(t *testing.T) {
+			admin := subscribe(t, connect(t, b.URL(), "admin", mqtt.WithProtocolVersion(v)), "#", 1)
+			h := connect(t, b.URL(), "user", mqtt.WithProtocolVersion(v))
+
+			var rerr *mqtt.ReasonCodeError
+			if err := h.Subscribe("admin/#", 1, func(mqtt.Message) {}); !errors.As(err, &rerr) {
+				t.Errorf("Subscribe() of a refused filter error = %v, want ReasonCodeError", err)
+			}
+			subscribe(t, h, "public/#", 1)
+
+			err := h.Publish(mqtt.Message{Topic: "admin/cmd", Payload: []byte("denied"), Qos: 1})
+			if v == mqtt.MQTT5 && !errors.As(err, &rerr) {
+				t.Errorf("Publish() to a refused topic error = %v, want ReasonCodeError", err)
+			}
+			if v == mqtt.MQTT311 && err != nil {
+				t.Errorf("Publish() to a refused topic error = %v, want nil", err)
+			}
+			if err := h.Publish(mqtt.Message{Topic: "public/news", Payload: []byte("allowed"), Qos: 1}); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+			admin.wait(t, 1)
+			time.Sleep(50 * time.Millisecond)
+			if msgs := admin.get(); len(msgs) != 1 || msgs[0].Topic != "public/news" {
+				t.Errorf("delivered %v, want only public/news", msgs)
+			}
+		})
+	}
+}
+
+func TestTLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "broker"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	b := newBroker(t, mqtttest.WithTLS(&tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}))
+	if url := b.URL(); url[:6] != "ssl://" {
+		t.Errorf("URL() = %s, want ssl://", url)
+	}
+
+	for _, v := range versions {
+		t.Run(v.String(), func(t *testing.T) {
+			h := connect(t, b.URL(), "client", mqtt.WithProtocolVersion(v), mqtt.WithTLSConfig(&tls.Config{RootCAs: pool}))
+			in := subscribe(t, h, "secure", 1)
+			if err := h.Publish(mqtt.Message{Topic: "secure", Payload: []byte("tls"), Qos: 1}); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+			if msgs := in.wait(t, 1); string(msgs[0].Payload) != "tls" {
+				t.Errorf("received %q, want tls", msgs[0].Payload)
+			}
+
+			// a plain TCP client cannot connect
+			_, err := mqtt.New("tcp://"+b.Addr(), "plain", mqtt.WithProtocolVersion(v),
+				mqtt.WithWaitForConnection(), mqtt.WithConnectTimeout(time.Second))
+			if err == nil {
+				t.Error("mqtt.New() without TLS: expected error")
+			}
+		})
+	}
+}
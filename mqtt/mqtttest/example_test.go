@@ -0,0 +1,42 @@
+package mqtttest_test
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/womat/golib/mqtt"
+	"github.com/womat/golib/mqtt/mqtttest"
+)
+
+func Example() {
+	b, err := mqtttest.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer b.Close()
+
+	h, err := mqtt.New(b.URL(), "client", mqtt.WithWaitForConnection())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer h.Disconnect()
+
+	received := make(chan mqtt.Message, 1)
+	if err := h.Subscribe("commands/+/set", 1, func(msg mqtt.Message) { received <- msg }); err != nil {
+		log.Fatal(err)
+	}
+
+	b.Publish("commands/heater/set", []byte("on"), 1, false)
+	msg := <-received
+	fmt.Println(msg.Topic, string(msg.Payload))
+
+	if err := h.Publish(mqtt.Message{Topic: "state/heater", Payload: []byte("on"), Qos: 1, Retained: true}); err != nil {
+		log.Fatal(err)
+	}
+	payload, _ := b.Retained("state/heater")
+	fmt.Println(string(payload))
+
+	// Output:
+	// commands/heater/set on
+	// on
+}
@@ -0,0 +1,113 @@
+package mqtttest
+
+import (
+	"io"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// v3Packet adapts an MQTT 3.1.1 packet to io.WriterTo.
+type v3Packet struct {
+	packets.ControlPacket
+}
+
+func (p v3Packet) WriteTo(w io.Writer) (int64, error) {
+	return 0, p.Write(w)
+}
+
+// serveV3 handles the packets of an MQTT 3.1.1 connection until it is closed.
+func (b *Broker) serveV3(c *conn) {
+	p, err := packets.ReadPacket(c.r)
+	if err != nil {
+		return
+	}
+	connect, ok := p.(*packets.ConnectPacket)
+	if !ok || !b.connectV3(c, connect) {
+		return
+	}
+
+	clean := false
+	defer func() { b.unregister(c, clean) }()
+
+	for {
+		p, err := packets.ReadPacket(c.r)
+		if err != nil {
+			return
+		}
+
+		switch p := p.(type) {
+		case *packets.PublishPacket:
+			switch p.Qos {
+			case 1:
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				_ = c.write(v3Packet{ack})
+			case 2:
+				rec := packets.NewControlPacket(packets.Pubrec).(*packets.PubrecPacket)
+				rec.MessageID = p.MessageID
+				_ = c.write(v3Packet{rec})
+			}
+			if b.authorized(c, p.TopicName, false) {
+				b.publish(&message{topic: p.TopicName, payload: p.Payload, qos: p.Qos, retain: p.Retain})
+			}
+
+		case *packets.PubrelPacket:
+			comp := packets.NewControlPacket(packets.Pubcomp).(*packets.PubcompPacket)
+			comp.MessageID = p.MessageID
+			_ = c.write(v3Packet{comp})
+
+		case *packets.SubscribePacket:
+			granted, retained := b.subscribe(c, p.Topics, p.Qoss)
+			ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			ack.MessageID = p.MessageID
+			ack.ReturnCodes = granted
+			_ = c.write(v3Packet{ack})
+			for _, msg := range retained {
+				b.deliver(c, msg)
+			}
+
+		case *packets.UnsubscribePacket:
+			b.unsubscribe(c, p.Topics)
+			ack := packets.NewControlPacket(packets.Unsuback).(*packets.UnsubackPacket)
+			ack.MessageID = p.MessageID
+			_ = c.write(v3Packet{ack})
+
+		case *packets.PingreqPacket:
+			_ = c.write(v3Packet{packets.NewControlPacket(packets.Pingresp)})
+
+		case *packets.DisconnectPacket:
+			clean = true
+			return
+		}
+	}
+}
+
+// connectV3 authenticates and registers an MQTT 3.1.1 client.
+func (b *Broker) connectV3(c *conn, p *packets.ConnectPacket) bool {
+	ack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+	ack.ReturnCode = p.Validate()
+	if ack.ReturnCode == packets.Accepted && b.authenticate != nil && !b.authenticate(p.Username, string(p.Password)) {
+		ack.ReturnCode = packets.ErrRefusedBadUsernameOrPassword
+	}
+	if err := c.write(v3Packet{ack}); err != nil || ack.ReturnCode != packets.Accepted {
+		return false
+	}
+
+	c.id = p.ClientIdentifier
+	if p.WillFlag {
+		c.will = &message{topic: p.WillTopic, payload: p.WillMessage, qos: p.WillQos, retain: p.WillRetain}
+	}
+	b.register(c)
+	return true
+}
+
+// publishV3 builds the MQTT 3.1.1 packet of a delivered message.
+func publishV3(msg *message, id uint16) io.WriterTo {
+	p := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	p.TopicName = msg.topic
+	p.Payload = msg.payload
+	p.Qos = msg.qos
+	p.Retain = msg.retain
+	p.MessageID = id
+	return v3Packet{p}
+}
@@ -0,0 +1,143 @@
+package mqtttest
+
+import (
+	"io"
+
+	packets5 "github.com/eclipse/paho.golang/packets"
+)
+
+// serveV5 handles the packets of an MQTT 5 connection until it is closed.
+func (b *Broker) serveV5(c *conn) {
+	p, err := packets5.ReadPacket(c.r)
+	if err != nil {
+		return
+	}
+	connect, ok := p.Content.(*packets5.Connect)
+	if !ok || !b.connectV5(c, connect) {
+		return
+	}
+
+	clean := false
+	defer func() { b.unregister(c, clean) }()
+
+	for {
+		p, err := packets5.ReadPacket(c.r)
+		if err != nil {
+			return
+		}
+
+		switch p := p.Content.(type) {
+		case *packets5.Publish:
+			msg, ok := b.resolveAlias(c, p)
+			if !ok {
+				b.disconnectV5(c, packets5.DisconnectTopicAliasInvalid)
+				return
+			}
+			var reason byte
+			if !b.authorized(c, msg.topic, false) {
+				reason = packets5.PubackNotAuthorized
+			}
+			switch p.QoS {
+			case 1:
+				_ = c.write(&packets5.Puback{PacketID: p.PacketID, ReasonCode: reason, Properties: &packets5.Properties{}})
+			case 2:
+				_ = c.write(&packets5.Pubrec{PacketID: p.PacketID, ReasonCode: reason, Properties: &packets5.Properties{}})
+			}
+			if reason == 0 {
+				b.publish(msg)
+			}
+
+		case *packets5.Pubrel:
+			_ = c.write(&packets5.Pubcomp{PacketID: p.PacketID, Properties: &packets5.Properties{}})
+
+		case *packets5.Subscribe:
+			filters := make([]string, len(p.Subscriptions))
+			qos := make([]byte, len(p.Subscriptions))
+			for i, s := range p.Subscriptions {
+				filters[i], qos[i] = s.Topic, s.QoS
+			}
+			granted, retained := b.subscribe(c, filters, qos)
+			_ = c.write(&packets5.Suback{PacketID: p.PacketID, Reasons: granted, Properties: &packets5.Properties{}})
+			for _, msg := range retained {
+				b.deliver(c, msg)
+			}
+
+		case *packets5.Unsubscribe:
+			b.unsubscribe(c, p.Topics)
+			_ = c.write(&packets5.Unsuback{PacketID: p.PacketID, Reasons: make([]byte, len(p.Topics)), Properties: &packets5.Properties{}})
+
+		case *packets5.Pingreq:
+			_ = c.write(&packets5.Pingresp{})
+
+		case *packets5.Disconnect:
+			// reason code 0x04 "disconnect with will message" requests the will
+			clean = p.ReasonCode != packets5.DisconnectDisconnectWithWillMessage
+			return
+		}
+	}
+}
+
+// connectV5 authenticates and registers an MQTT 5 client.
+func (b *Broker) connectV5(c *conn, p *packets5.Connect) bool {
+	aliasMaximum := uint16(topicAliasMaximum)
+	ack := &packets5.Connack{Properties: &packets5.Properties{TopicAliasMaximum: &aliasMaximum}}
+	if b.authenticate != nil && !b.authenticate(p.Username, string(p.Password)) {
+		ack.ReasonCode = packets5.ConnackBadUsernameOrPassword
+	}
+	if err := c.write(ack); err != nil || ack.ReasonCode != packets5.ConnackSuccess {
+		return false
+	}
+
+	c.id = p.ClientID
+	c.aliases = make(map[uint16]string)
+	if p.WillFlag {
+		c.will = &message{topic: p.WillTopic, payload: p.WillMessage, qos: p.WillQOS, retain: p.WillRetain, props: p.WillProperties}
+	}
+	b.register(c)
+	return true
+}
+
+// resolveAlias converts a received message and resolves or registers its topic alias.
+func (b *Broker) resolveAlias(c *conn, p *packets5.Publish) (*message, bool) {
+	msg := &message{topic: p.Topic, payload: p.Payload, qos: p.QoS, retain: p.Retain, props: p.Properties}
+	if p.Properties == nil || p.Properties.TopicAlias == nil {
+		return msg, p.Topic != ""
+	}
+
+	alias := *p.Properties.TopicAlias
+	if alias == 0 || alias > topicAliasMaximum {
+		return nil, false
+	}
+	if msg.topic == "" {
+		topic, ok := c.aliases[alias]
+		if !ok {
+			return nil, false
+		}
+		msg.topic = topic
+		b.mu.Lock()
+		b.aliased++
+		b.mu.Unlock()
+	} else {
+		c.aliases[alias] = msg.topic
+	}
+
+	// the alias is only valid on this connection
+	props := *p.Properties
+	props.TopicAlias = nil
+	msg.props = &props
+	return msg, true
+}
+
+// disconnectV5 sends a DISCONNECT with a reason code to the client.
+func (b *Broker) disconnectV5(c *conn, reason byte) {
+	_ = c.write(&packets5.Disconnect{ReasonCode: reason, Properties: &packets5.Properties{}})
+}
+
+// publishV5 builds the MQTT 5 packet of a delivered message.
+func publishV5(msg *message, id uint16) io.WriterTo {
+	props := msg.props
+	if props == nil {
+		props = &packets5.Properties{}
+	}
+	return &packets5.Publish{Topic: msg.topic, Payload: msg.payload, QoS: msg.qos, Retain: msg.retain, PacketID: id, Properties: props}
+}
@@ -0,0 +1,61 @@
+package mqtt
+
+import "fmt"
+
+// ProtocolVersion is the MQTT protocol version of a Handler.
+type ProtocolVersion byte
+
+const (
+	MQTT311 ProtocolVersion = 4 // MQTT311 is MQTT 3.1.1, the default
+	MQTT5   ProtocolVersion = 5 // MQTT5 is MQTT 5.0
+)
+
+// String returns the version number, e.g. "3.1.1".
+func (v ProtocolVersion) String() string {
+	switch v {
+	case MQTT311:
+		return "3.1.1"
+	case MQTT5:
+		return "5"
+	default:
+		return fmt.Sprintf("ProtocolVersion(%d)", byte(v))
+	}
+}
+
+// ReasonCodeError is an MQTT 5 reason code >= 0x80 returned by the broker, e.g. for
+// a refused connect (CONNACK), a rejected publish (PUBACK) or subscription (SUBACK),
+// or a disconnect by the server. With MQTT 3.1.1 a refused subscription is reported
+// with the SUBACK return code 0x80.
+type ReasonCodeError struct {
+	Code   byte   // Reason code, e.g. 0x87 "not authorized"
+	Reason string // Optional reason string of the broker
+}
+
+func (e *ReasonCodeError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("mqtt reason code 0x%02x: %s", e.Code, e.Reason)
+	}
+	return fmt.Sprintf("mqtt reason code 0x%02x", e.Code)
+}
+
+// WithProtocolVersion selects the MQTT protocol version (default MQTT311).
+//
+// MQTT 5 transports the properties of a Message (response topic, correlation data,
+// content type, message expiry and user properties), reports broker errors as
+// ReasonCodeError and supports topic aliases (WithTopicAliases). Shared
+// subscriptions ("$share/<group>/<filter>") work with both versions if the broker
+// supports them.
+func WithProtocolVersion(v ProtocolVersion) Option {
+	return func(h *Handler) {
+		h.protocol = v
+	}
+}
+
+// WithTopicAliases lets an MQTT 5 client replace the topic of repeated QoS 0 messages
+// by a numeric alias, up to the maximum number of aliases the broker allows. This saves
+// bandwidth for frequent messages on long topics. It has no effect with MQTT 3.1.1.
+func WithTopicAliases() Option {
+	return func(h *Handler) {
+		h.topicAliases = true
+	}
+}
@@ -0,0 +1,245 @@
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/womat/golib/mqtt/mqtttest"
+)
+
+// messageLog collects the messages received by a subscription.
+type messageLog struct {
+	mu   sync.Mutex
+	msgs []Message
+}
+
+func (l *messageLog) add(msg Message) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, msg)
+}
+
+func (l *messageLog) get() []Message {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Message(nil), l.msgs...)
+}
+
+func TestMQTT5Properties(t *testing.T) {
+	b := newTestBroker(t)
+
+	var v5Log, v3Log messageLog
+	sub5, err := New(b.URL(), "sub5", WithProtocolVersion(MQTT5))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer sub5.Disconnect()
+	if err := sub5.Subscribe("props/#", 1, v5Log.add); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	sub3, err := New(b.URL(), "sub3")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer sub3.Disconnect()
+	if err := sub3.Subscribe("props/#", 1, v3Log.add); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	pub, err := New(b.URL(), "pub", WithProtocolVersion(MQTT5))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer pub.Disconnect()
+
+	want := Message{
+		Topic:           "props/test",
+		Payload:         []byte(`{"v":1}`),
+		Qos:             1,
+		ResponseTopic:   "props/reply",
+		CorrelationData: []byte{1, 2},
+		UserProperties:  map[string]string{"source": "test"},
+		ContentType:     "application/json",
+		MessageExpiry:   time.Minute,
+	}
+	if err := pub.Publish(want); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	waitFor(t, "messages", func() bool { return len(v5Log.get()) == 1 && len(v3Log.get()) == 1 })
+
+	got := v5Log.get()[0]
+	if got.Topic != want.Topic || !bytes.Equal(got.Payload, want.Payload) || got.ResponseTopic != want.ResponseTopic ||
+		!bytes.Equal(got.CorrelationData, want.CorrelationData) || got.UserProperties["source"] != "test" ||
+		got.ContentType != want.ContentType || got.MessageExpiry != want.MessageExpiry {
+		t.Errorf("MQTT 5 subscriber received %+v, want %+v", got, want)
+	}
+	if got := v3Log.get()[0]; !bytes.Equal(got.Payload, want.Payload) || got.ResponseTopic != "" || got.UserProperties != nil {
+		t.Errorf("MQTT 3.1.1 subscriber received %+v, want the payload only", got)
+	}
+}
+
+func TestMQTT5Connection(t *testing.T) {
+	b := newTestBroker(t, mqtttest.WithAuthentication(func(username, password string) bool {
+		return username == "user" && password == "secret"
+	}))
+
+	_, err := New(b.URL(), "device", WithProtocolVersion(MQTT5), WithWaitForConnection(), WithCredentials("user", "wrong"))
+	var rerr *ReasonCodeError
+	if !errors.As(err, &rerr) || rerr.Code != 0x86 {
+		t.Errorf("New() with wrong password error = %v, want reason code 0x86", err)
+	}
+
+	var connects atomic.Int32
+	h, err := New(b.URL(), "device", WithProtocolVersion(MQTT5), WithWaitForConnection(), WithCredentials("user", "secret"),
+		WithStatusTopic("device"), WithRetryInterval(50*time.Millisecond), WithOnConnected(func() { connects.Add(1) }))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	var log messageLog
+	if err := h.Subscribe("cmd/#", 1, log.add); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	waitFor(t, "online", func() bool {
+		payload, _ := b.Retained("device/status")
+		return string(payload) == StatusOnline
+	})
+
+	// the broker publishes the will; the client reconnects and subscribes again
+	b.DisconnectClient("device")
+	waitFor(t, "reconnect", func() bool { return connects.Load() == 2 && h.ConnectionState().State == StateConnected })
+	if s := h.ConnectionState(); s.LastError == nil {
+		t.Errorf("ConnectionState().LastError = nil after connection loss")
+	}
+	waitFor(t, "online again", func() bool {
+		payload, _ := b.Retained("device/status")
+		return string(payload) == StatusOnline
+	})
+	if err := h.Publish(Message{Topic: "cmd/x", Payload: []byte("1"), Qos: 1}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	waitFor(t, "message after reconnect", func() bool { return len(log.get()) == 1 })
+
+	h.Disconnect()
+	if payload, _ := b.Retained("device/status"); string(payload) != StatusOffline {
+		t.Errorf("status after Disconnect() = %q, want %q", payload, StatusOffline)
+	}
+	if s := h.ConnectionState(); s.State != StateDisconnected {
+		t.Errorf("ConnectionState() after Disconnect() = %v", s.State)
+	}
+}
+
+func TestMQTT5TopicAliases(t *testing.T) {
+	b := newTestBroker(t)
+
+	h, err := New(b.URL(), "device", WithProtocolVersion(MQTT5), WithTopicAliases())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	var log messageLog
+	if err := h.Subscribe("sensors/#", 0, log.add); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	for i := range 5 {
+		if err := h.Publish(Message{Topic: "sensors/boiler/temperature", Payload: []byte(fmt.Sprint(i))}); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	waitFor(t, "messages", func() bool { return len(log.get()) == 5 })
+
+	for _, msg := range log.get() {
+		if msg.Topic != "sensors/boiler/temperature" {
+			t.Errorf("received topic %q", msg.Topic)
+		}
+	}
+	if n := b.AliasedMessages(); n != 4 {
+		t.Errorf("messages sent with topic alias = %d, want 4", n)
+	}
+}
+
+func TestMQTT5SharedSubscription(t *testing.T) {
+	b := newTestBroker(t)
+
+	var received atomic.Int32
+	for i := range 2 {
+		h, err := New(b.URL(), fmt.Sprint("worker", i), WithProtocolVersion(MQTT5))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		defer h.Disconnect()
+		if err := h.Subscribe("$share/workers/jobs/+", 1, func(Message) { received.Add(1) }); err != nil {
+			t.Fatalf("Subscribe() error = %v", err)
+		}
+	}
+
+	pub, err := New(b.URL(), "pub", WithProtocolVersion(MQTT5))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer pub.Disconnect()
+	for i := range 10 {
+		if err := pub.Publish(Message{Topic: "jobs/resize", Payload: []byte(fmt.Sprint(i)), Qos: 1}); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+
+	// every job is delivered to one worker only
+	waitFor(t, "jobs", func() bool { return received.Load() == 10 })
+	time.Sleep(50 * time.Millisecond)
+	if n := received.Load(); n != 10 {
+		t.Errorf("received %d jobs, want 10", n)
+	}
+}
+
+func TestMQTT5Call(t *testing.T) {
+	b := newTestBroker(t)
+
+	server, err := New(b.URL(), "server", WithProtocolVersion(MQTT5))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer server.Disconnect()
+	client, err := New(b.URL(), "client", WithProtocolVersion(MQTT5))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer client.Disconnect()
+
+	if err := server.Serve("rpc/echo", func(req []byte) ([]byte, error) {
+		if len(req) == 0 {
+			return nil, errors.New("empty request")
+		}
+		return req, nil
+	}); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+
+	if resp, err := client.Call(context.Background(), "rpc/echo", []byte("ping")); err != nil || string(resp) != "ping" {
+		t.Errorf("Call() = %q, %v, want ping", resp, err)
+	}
+	if _, err := client.Call(context.Background(), "rpc/echo", nil); !errors.Is(err, ErrRemote) {
+		t.Errorf("Call() error = %v, want %v", err, ErrRemote)
+	}
+}
+
+func TestProtocolVersion(t *testing.T) {
+	for v, want := range map[ProtocolVersion]string{MQTT311: "3.1.1", MQTT5: "5", 3: "ProtocolVersion(3)"} {
+		if got := v.String(); got != want {
+			t.Errorf("ProtocolVersion(%d).String() = %q, want %q", byte(v), got, want)
+		}
+	}
+	if _, err := New("tcp://127.0.0.1:1", "device", WithProtocolVersion(3)); err == nil {
+		t.Errorf("New() with protocol version 3: expected error")
+	}
+	if err := (&ReasonCodeError{Code: 0x87, Reason: "not authorized"}).Error(); err != "mqtt reason code 0x87: not authorized" {
+		t.Errorf("ReasonCodeError.Error() = %q", err)
+	}
+}
@@ -0,0 +1,145 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// PublishContext sends a message like Publish, but returns early with ctx.Err()
+// if ctx is cancelled. If ctx has no deadline, the publish timeout applies.
+//
+// A cancelled message is not queued, but it may still be delivered by the client.
+func (m *Handler) PublishContext(ctx context.Context, msg Message) error {
+	if msg.Topic == "" {
+		return ErrTopicEmpty
+	}
+
+	client, queue, err := m.publishClient()
+	if err != nil {
+		return err
+	}
+	if queue {
+		return m.queue.push(msg)
+	}
+
+	waitCtx, cancel := m.publishContext(ctx)
+	defer cancel()
+
+	err = waitTokenContext(waitCtx, client.publish(msg))
+	return m.publishResult(ctx, client, msg, err)
+}
+
+// PublishAsync sends a message in the background and returns a channel that receives
+// the result of Publish and is closed afterwards. The channel is buffered, so it can
+// be ignored for fire-and-forget messages.
+func (m *Handler) PublishAsync(msg Message) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		defer close(done)
+		done <- m.Publish(msg)
+	}()
+	return done
+}
+
+// PublishBatch sends several messages without waiting for the acknowledgement of each
+// message before sending the next one, and then waits up to the publish timeout for
+// all acknowledgements. With MQTT 3.1.1 the messages are sent in order, with MQTT 5
+// the order is not guaranteed.
+//
+// No message is sent if a topic is empty. The returned error joins the errors of
+// all failed messages; with an offline queue the messages that failed because of the
+// connection are queued instead.
+func (m *Handler) PublishBatch(msgs []Message) error {
+	for i, msg := range msgs {
+		if msg.Topic == "" {
+			return fmt.Errorf("message %d: %w", i, ErrTopicEmpty)
+		}
+	}
+
+	client, queue, err := m.publishClient()
+	if err != nil {
+		return err
+	}
+	if queue {
+		for _, msg := range msgs {
+			if err := m.queue.push(msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tokens := make([]token, len(msgs))
+	for i, msg := range msgs {
+		tokens[i] = client.publish(msg)
+	}
+
+	waitCtx, cancel := m.publishContext(context.Background())
+	defer cancel()
+
+	var errs []error
+	for i, token := range tokens {
+		err := m.publishResult(context.Background(), client, msgs[i], waitTokenContext(waitCtx, token))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("message %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// publishClient returns the client and whether a message must be queued instead.
+func (m *Handler) publishClient() (backend, bool, error) {
+	m.mu.Lock()
+	client := m.client
+	m.mu.Unlock()
+
+	if client == nil {
+		return nil, false, ErrClientNotInitialized
+	}
+
+	// keep the order: nothing overtakes queued messages
+	queue := m.queue != nil && (!client.isConnectionOpen() || m.queue.len() > 0)
+	return client, queue, nil
+}
+
+// publishContext applies the publish timeout if ctx has no deadline.
+func (m *Handler) publishContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, m.publishTimeout)
+}
+
+// publishResult maps the error of a publish: the publish timeout becomes ErrTimeout,
+// and a message that failed because of the connection is queued if an offline queue
+// is configured. Errors of the caller's ctx are returned unchanged.
+func (m *Handler) publishResult(ctx context.Context, client backend, msg Message, err error) error {
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = ErrTimeout
+	}
+	if m.queue != nil && queueable(client, err) {
+		return m.queue.push(msg)
+	}
+	return err
+}
+
+// queueable reports whether a failed message may succeed on the next connection: it
+// timed out or the connection was lost. A message the broker rejected, e.g. with an
+// MQTT 5 ReasonCodeError, would be rejected again.
+func queueable(client backend, err error) bool {
+	return errors.Is(err, ErrTimeout) || !client.isConnectionOpen()
+}
+
+// waitTokenContext waits for a token until ctx is done.
+func waitTokenContext(ctx context.Context, t token) error {
+	select {
+	case <-t.Done():
+		return t.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
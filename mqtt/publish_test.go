@@ -0,0 +1,112 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/womat/golib/mqtt/mqtttest"
+)
+
+func TestPublishContext(t *testing.T) {
+	// while the initial connect is retried, paho holds back the publish
+	b := newTestBroker(t)
+	addr := b.Addr()
+	_ = b.Close()
+
+	h, err := New("tcp://"+addr, "device", WithConnectTimeout(100*time.Millisecond), WithPublishTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	msg := Message{Topic: "queue/test", Payload: []byte("x"), Qos: 1}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := h.PublishContext(ctx, msg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("PublishContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err := h.PublishContext(ctx, msg); !errors.Is(err, context.Canceled) {
+		t.Errorf("PublishContext() error = %v, want %v", err, context.Canceled)
+	}
+
+	if err := h.Publish(msg); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Publish() error = %v, want %v", err, ErrTimeout)
+	}
+	if err := h.PublishBatch([]Message{msg, msg}); !errors.Is(err, ErrTimeout) {
+		t.Errorf("PublishBatch() error = %v, want %v", err, ErrTimeout)
+	}
+	if err := h.PublishContext(context.Background(), Message{}); err != ErrTopicEmpty {
+		t.Errorf("PublishContext() with empty topic error = %v, want %v", err, ErrTopicEmpty)
+	}
+}
+
+func TestPublishAsync(t *testing.T) {
+	var log publishLog
+	b := newTestBroker(t, mqtttest.WithOnPublish(log.record))
+
+	h, err := New(b.URL(), "device")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	done := h.PublishAsync(Message{Topic: "queue/async", Payload: []byte("1"), Qos: 1})
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("PublishAsync() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for PublishAsync()")
+	}
+	if _, ok := <-done; ok {
+		t.Errorf("PublishAsync() channel not closed")
+	}
+	if got := log.get(); len(got) != 1 || got[0] != "1" {
+		t.Errorf("published = %v, want [1]", got)
+	}
+
+	if err := <-h.PublishAsync(Message{}); err != ErrTopicEmpty {
+		t.Errorf("PublishAsync() with empty topic error = %v, want %v", err, ErrTopicEmpty)
+	}
+}
+
+func TestPublishBatch(t *testing.T) {
+	var log publishLog
+	b := newTestBroker(t, mqtttest.WithOnPublish(log.record))
+
+	h, err := New(b.URL(), "device")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	var msgs []Message
+	var want []string
+	for i := range 200 {
+		msgs = append(msgs, Message{Topic: "queue/batch", Payload: []byte(fmt.Sprint(i)), Qos: byte(i % 2)})
+		want = append(want, fmt.Sprint(i))
+	}
+	if err := h.PublishBatch(msgs); err != nil {
+		t.Fatalf("PublishBatch() error = %v", err)
+	}
+
+	waitFor(t, "messages", func() bool { return len(log.get()) >= len(want) })
+	if got := log.get(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("published = %v, want %v", got, want)
+	}
+
+	if err := h.PublishBatch([]Message{{Topic: "queue/batch"}, {}}); !errors.Is(err, ErrTopicEmpty) {
+		t.Errorf("PublishBatch() with empty topic error = %v, want %v", err, ErrTopicEmpty)
+	}
+	if got := log.get(); len(got) != len(want) {
+		t.Errorf("PublishBatch() with empty topic published %d messages", len(got)-len(want))
+	}
+}
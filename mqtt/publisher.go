@@ -0,0 +1,213 @@
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var ErrRateLimited = errors.New("mqtt publish rate limit exceeded")
+
+// Publisher publishes messages. It is implemented by Handler and the publisher decorators
+// NewLoggingPublisher, NewRateLimitedPublisher, NewDedupPublisher and NewFanOutPublisher,
+// so code that only publishes can be tested or extended without a broker.
+type Publisher interface {
+	Publish(msg Message) error
+	PublishContext(ctx context.Context, msg Message) error
+}
+
+// Subscriber registers message handlers for topic filters. It is implemented by Handler.
+type Subscriber interface {
+	Subscribe(topicFilter string, qos byte, handler func(Message)) error
+	Unsubscribe(topicFilters ...string) error
+}
+
+// Connection reports and ends the connection to the broker. It is implemented by Handler.
+type Connection interface {
+	IsConnected() bool
+	ConnectionState() ConnectionState
+	Disconnect()
+}
+
+var (
+	_ Publisher  = (*Handler)(nil)
+	_ Subscriber = (*Handler)(nil)
+	_ Connection = (*Handler)(nil)
+)
+
+// loggingPublisher logs every message, see NewLoggingPublisher.
+type loggingPublisher struct {
+	next   Publisher
+	logger *slog.Logger
+}
+
+// NewLoggingPublisher returns a Publisher that logs every message published to next
+// with level debug, and failed messages with level warn.
+// If logger is nil, slog.Default() is used.
+func NewLoggingPublisher(next Publisher, logger *slog.Logger) Publisher {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &loggingPublisher{next: next, logger: logger}
+}
+
+func (p *loggingPublisher) Publish(msg Message) error {
+	return p.PublishContext(context.Background(), msg)
+}
+
+func (p *loggingPublisher) PublishContext(ctx context.Context, msg Message) error {
+	start := time.Now()
+	err := p.next.PublishContext(ctx, msg)
+
+	attrs := []any{
+		slog.String("topic", msg.Topic),
+		slog.Int("qos", int(msg.Qos)),
+		slog.Bool("retained", msg.Retained),
+		slog.String("payload", string(msg.Payload)),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if err != nil {
+		p.logger.Warn("mqtt publish failed", append(attrs, slog.Any("error", err))...)
+		return err
+	}
+	p.logger.Debug("mqtt publish", attrs...)
+	return nil
+}
+
+// rateLimitedPublisher limits the message rate, see NewRateLimitedPublisher.
+type rateLimitedPublisher struct {
+	next     Publisher
+	interval time.Duration
+	burst    int
+
+	mu  sync.Mutex
+	tat time.Time // theoretical arrival time of the next message if the bucket were empty
+}
+
+// NewRateLimitedPublisher returns a Publisher that publishes at most one message per
+// interval to next, with bursts of up to burst messages (minimum 1).
+//
+// A message that exceeds the rate waits for its turn. PublishContext returns
+// ErrRateLimited without waiting if the context deadline expires before the turn
+// of the message, and the context error if the context is canceled while waiting;
+// the turn of a canceled message is given back to the following messages.
+func NewRateLimitedPublisher(next Publisher, interval time.Duration, burst int) Publisher {
+	return &rateLimitedPublisher{next: next, interval: interval, burst: max(burst, 1)}
+}
+
+func (p *rateLimitedPublisher) Publish(msg Message) error {
+	return p.PublishContext(context.Background(), msg)
+}
+
+func (p *rateLimitedPublisher) PublishContext(ctx context.Context, msg Message) error {
+	wait, err := p.reserve(ctx)
+	if err != nil {
+		return err
+	}
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			p.release()
+			return ctx.Err()
+		}
+	}
+	return p.next.PublishContext(ctx, msg)
+}
+
+// reserve reserves the turn of a message and returns the time to wait for it.
+func (p *rateLimitedPublisher) reserve(ctx context.Context) (time.Duration, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	tat := p.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	wait := tat.Sub(now) - time.Duration(p.burst-1)*p.interval
+	if deadline, ok := ctx.Deadline(); ok && wait > 0 && deadline.Before(now.Add(wait)) {
+		return 0, ErrRateLimited
+	}
+	p.tat = tat.Add(p.interval)
+	return max(wait, 0), nil
+}
+
+// release gives back a turn reserved by reserve that is not used.
+func (p *rateLimitedPublisher) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tat = p.tat.Add(-p.interval)
+}
+
+// dedupPublisher suppresses repeated payloads, see NewDedupPublisher.
+type dedupPublisher struct {
+	next Publisher
+
+	mu   sync.Mutex
+	last map[string][]byte // last published payload by topic
+}
+
+// NewDedupPublisher returns a Publisher that only publishes a message to next if its
+// payload differs from the last payload published to the same topic. Suppressed messages
+// return nil. A failed message is not remembered, so the next message is published again.
+func NewDedupPublisher(next Publisher) Publisher {
+	return &dedupPublisher{next: next, last: make(map[string][]byte)}
+}
+
+func (p *dedupPublisher) Publish(msg Message) error {
+	return p.PublishContext(context.Background(), msg)
+}
+
+func (p *dedupPublisher) PublishContext(ctx context.Context, msg Message) error {
+	p.mu.Lock()
+	last, ok := p.last[msg.Topic]
+	p.mu.Unlock()
+	if ok && bytes.Equal(last, msg.Payload) {
+		return nil
+	}
+
+	if err := p.next.PublishContext(ctx, msg); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.last[msg.Topic] = bytes.Clone(msg.Payload)
+	p.mu.Unlock()
+	return nil
+}
+
+// fanOutPublisher publishes to several publishers, see NewFanOutPublisher.
+type fanOutPublisher []Publisher
+
+// NewFanOutPublisher returns a Publisher that publishes every message to all publishers
+// concurrently, e.g. to Handlers of several brokers. The returned error joins the errors
+// of all failed publishers.
+func NewFanOutPublisher(publishers ...Publisher) Publisher {
+	return fanOutPublisher(publishers)
+}
+
+func (p fanOutPublisher) Publish(msg Message) error {
+	return p.PublishContext(context.Background(), msg)
+}
+
+func (p fanOutPublisher) PublishContext(ctx context.Context, msg Message) error {
+	errs := make([]error, len(p))
+	var wg sync.WaitGroup
+	for i, publisher := range p {
+		wg.Go(func() {
+			if err := publisher.PublishContext(ctx, msg); err != nil {
+				errs[i] = fmt.Errorf("publisher %d: %w", i, err)
+			}
+		})
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,179 @@
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/womat/golib/mqtt/mqtttest"
+)
+
+// fakePublisher records the published messages and fails with err.
+type fakePublisher struct {
+	mu   sync.Mutex
+	msgs []Message
+	err  error
+}
+
+func (p *fakePublisher) Publish(msg Message) error {
+	return p.PublishContext(context.Background(), msg)
+}
+
+func (p *fakePublisher) PublishContext(_ context.Context, msg Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.msgs = append(p.msgs, msg)
+	return nil
+}
+
+// payloads returns the payloads of the published messages.
+func (p *fakePublisher) payloads() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var payloads []string
+	for _, msg := range p.msgs {
+		payloads = append(payloads, string(msg.Payload))
+	}
+	return payloads
+}
+
+func TestLoggingPublisher(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	next := &fakePublisher{}
+	p := NewLoggingPublisher(next, logger)
+
+	if err := p.Publish(Message{Topic: "sensors/temperature", Payload: []byte("22.5"), Qos: 1}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if out := buf.String(); !strings.Contains(out, "level=DEBUG") || !strings.Contains(out, "topic=sensors/temperature") ||
+		!strings.Contains(out, "payload=22.5") {
+		t.Errorf("log = %q", out)
+	}
+
+	buf.Reset()
+	next.err = ErrTimeout
+	if err := p.Publish(Message{Topic: "sensors/temperature"}); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Publish() error = %v, want %v", err, ErrTimeout)
+	}
+	if out := buf.String(); !strings.Contains(out, "level=WARN") || !strings.Contains(out, "error=\"publish timeout\"") {
+		t.Errorf("log = %q", out)
+	}
+}
+
+func TestRateLimitedPublisher(t *testing.T) {
+	next := &fakePublisher{}
+	p := NewRateLimitedPublisher(next, 50*time.Millisecond, 2)
+
+	start := time.Now()
+	for range 4 {
+		if err := p.Publish(Message{Topic: "t", Payload: []byte("x")}); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	// the burst is sent immediately, the 3rd and 4th message wait 50ms each
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("4 messages took %v, want about 100ms", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.PublishContext(ctx, Message{Topic: "t"}); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("PublishContext() error = %v, want %v", err, ErrRateLimited)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := p.PublishContext(ctx, Message{Topic: "t"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("PublishContext() error = %v, want %v", err, context.Canceled)
+	}
+	if n := len(next.payloads()); n != 4 {
+		t.Errorf("published %d messages, want 4", n)
+	}
+
+	// canceled messages give their turn back
+	p = NewRateLimitedPublisher(next, 100*time.Millisecond, 1)
+	if err := p.Publish(Message{Topic: "t"}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	for range 5 {
+		if err := p.PublishContext(ctx, Message{Topic: "t"}); !errors.Is(err, context.Canceled) {
+			t.Errorf("PublishContext() error = %v, want %v", err, context.Canceled)
+		}
+	}
+	start = time.Now()
+	if err := p.Publish(Message{Topic: "t"}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("message after 5 canceled messages waited %v, want at most 100ms", elapsed)
+	}
+}
+
+func TestDedupPublisher(t *testing.T) {
+	next := &fakePublisher{}
+	p := NewDedupPublisher(next)
+
+	for _, msg := range []Message{
+		{Topic: "a", Payload: []byte("1")},
+		{Topic: "a", Payload: []byte("1")},
+		{Topic: "b", Payload: []byte("1")},
+		{Topic: "a", Payload: []byte("2")},
+		{Topic: "a", Payload: []byte("1")},
+		{Topic: "b", Payload: []byte("1")},
+	} {
+		if err := p.Publish(msg); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	if got, want := strings.Join(next.payloads(), ","), "1,1,2,1"; got != want {
+		t.Errorf("published %s, want %s", got, want)
+	}
+
+	// a failed message is published again
+	next.err = ErrTimeout
+	if err := p.Publish(Message{Topic: "c", Payload: []byte("3")}); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Publish() error = %v, want %v", err, ErrTimeout)
+	}
+	next.err = nil
+	if err := p.Publish(Message{Topic: "c", Payload: []byte("3")}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if got, want := strings.Join(next.payloads(), ","), "1,1,2,1,3"; got != want {
+		t.Errorf("published %s, want %s", got, want)
+	}
+}
+
+func TestFanOutPublisher(t *testing.T) {
+	b1, b2 := newTestBroker(t), newTestBroker(t)
+	var publishers []Publisher
+	for _, b := range []string{b1.URL(), b2.URL()} {
+		h, err := New(b, "device")
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		defer h.Disconnect()
+		publishers = append(publishers, h)
+	}
+
+	failing := &fakePublisher{err: ErrTimeout}
+	p := NewFanOutPublisher(append(publishers, failing)...)
+	err := p.Publish(Message{Topic: "state", Payload: []byte("on"), Qos: 1, Retained: true})
+	if !errors.Is(err, ErrTimeout) || !strings.Contains(err.Error(), "publisher 2") {
+		t.Errorf("Publish() error = %v, want %v of publisher 2", err, ErrTimeout)
+	}
+
+	for _, b := range []*mqtttest.Broker{b1, b2} {
+		if payload, _ := b.Retained("state"); string(payload) != "on" {
+			t.Errorf("retained payload = %q, want on", payload)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// QueueStats contains the counters of the offline publish queue.
+type QueueStats struct {
+	Depth   int    // Number of queued messages
+	Dropped uint64 // Number of messages discarded because the queue was full or the broker rejected them
+	Flushed uint64 // Number of queued messages published after a reconnect
+}
+
+// WithOfflineQueue enables a bounded in-memory queue for Publish.
+//
+// While the client is not connected, or a publish times out or loses the connection,
+// Publish queues the message and returns nil. The queue is flushed in order as soon as
+// the connection is (re-)established; until then, newer messages are queued behind older
+// ones. If the queue holds size messages, the oldest message is dropped. A size of 0
+// disables the queue.
+//
+// A message the broker rejects is not queued: Publish returns the error, and a queued
+// message the broker rejects while flushing is dropped.
+func WithOfflineQueue(size int) Option {
+	return func(h *Handler) {
+		h.queueSize = size
+		h.queueDir = ""
+	}
+}
+
+// WithPersistentQueue enables a bounded offline queue like WithOfflineQueue, which is
+// stored in dir (one file per message), so queued messages survive a restart.
+// The directory is created if necessary; New returns an error if it is not usable.
+func WithPersistentQueue(dir string, size int) Option {
+	return func(h *Handler) {
+		h.queueSize = size
+		h.queueDir = dir
+	}
+}
+
+// QueueStats returns the counters of the offline queue.
+// All values are zero if no queue is configured.
+func (m *Handler) QueueStats() QueueStats {
+	if m.queue == nil {
+		return QueueStats{}
+	}
+	return m.queue.stats()
+}
+
+// queueStore stores the queued messages in order.
+type queueStore interface {
+	push(msg Message) error
+	peek() (Message, bool)
+	pop() error
+	len() int
+}
+
+// offlineQueue is a bounded FIFO of messages waiting for a connection.
+type offlineQueue struct {
+	mu      sync.Mutex
+	store   queueStore
+	size    int
+	timeout time.Duration // publish timeout of a queued message
+	removed uint64        // number of messages removed from the head, detects drops during a flush
+	dropped atomic.Uint64
+	flushed atomic.Uint64
+
+	signal chan struct{} // wakes the flusher
+	done   chan struct{} // stops the flusher
+	wg     sync.WaitGroup
+}
+
+// newOfflineQueue creates the queue configured by WithOfflineQueue or WithPersistentQueue.
+func newOfflineQueue(size int, dir string, timeout time.Duration) (*offlineQueue, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("mqtt queue size must be > 0: %d", size)
+	}
+
+	q := &offlineQueue{
+		size:    size,
+		timeout: timeout,
+		signal:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		store:   &memoryStore{},
+	}
+	if dir != "" {
+		store, err := newDiskStore(dir)
+		if err != nil {
+			return nil, err
+		}
+		q.store = store
+		// a restart may have reduced the size
+		for q.store.len() > q.size {
+			_ = q.store.pop()
+			q.dropped.Add(1)
+		}
+	}
+	return q, nil
+}
+
+// push appends a message and drops the oldest one if the queue is full.
+func (q *offlineQueue) push(msg Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.store.len() >= q.size {
+		if err := q.store.pop(); err != nil {
+			return err
+		}
+		q.removed++
+		q.dropped.Add(1)
+	}
+	if err := q.store.push(msg); err != nil {
+		return err
+	}
+
+	q.wake()
+	return nil
+}
+
+// len returns the number of queued messages.
+func (q *offlineQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.store.len()
+}
+
+func (q *offlineQueue) stats() QueueStats {
+	return QueueStats{Depth: q.len(), Dropped: q.dropped.Load(), Flushed: q.flushed.Load()}
+}
+
+// wake triggers a flush attempt.
+func (q *offlineQueue) wake() {
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// run flushes the queue whenever it is woken until stop is called.
+// client returns the current client or nil.
+func (q *offlineQueue) run(client func() backend) {
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		for {
+			select {
+			case <-q.done:
+				return
+			case <-q.signal:
+				q.flush(client())
+			}
+		}
+	}()
+}
+
+// stop stops the flusher; persisted messages stay on disk.
+func (q *offlineQueue) stop() {
+	close(q.done)
+	q.wg.Wait()
+}
+
+// flush publishes the queued messages in order while the connection is open.
+// A message that failed because of the connection stays at the head of the queue for
+// the next attempt; a message the broker rejected is dropped.
+func (q *offlineQueue) flush(client backend) {
+	for client != nil && client.isConnectionOpen() {
+		select {
+		case <-q.done:
+			return
+		default:
+		}
+
+		q.mu.Lock()
+		msg, ok := q.store.peek()
+		removed := q.removed
+		q.mu.Unlock()
+		if !ok {
+			return
+		}
+
+		err := waitToken(client.publish(msg), q.timeout, ErrTimeout)
+		if err != nil && queueable(client, err) {
+			return
+		}
+
+		q.mu.Lock()
+		// push may have dropped and counted the message in the meantime
+		popped := q.removed == removed
+		if popped {
+			_ = q.store.pop()
+			q.removed++
+		}
+		q.mu.Unlock()
+		switch {
+		case !popped:
+		case err != nil:
+			q.dropped.Add(1)
+		default:
+			q.flushed.Add(1)
+		}
+	}
+}
+
+// memoryStore keeps the queued messages in memory.
+type memoryStore struct {
+	msgs []Message
+}
+
+func (s *memoryStore) push(msg Message) error {
+	s.msgs = append(s.msgs, msg)
+	return nil
+}
+
+func (s *memoryStore) peek() (Message, bool) {
+	if len(s.msgs) == 0 {
+		return Message{}, false
+	}
+	return s.msgs[0], true
+}
+
+func (s *memoryStore) pop() error {
+	s.msgs[0] = Message{}
+	s.msgs = s.msgs[1:]
+	return nil
+}
+
+func (s *memoryStore) len() int {
+	return len(s.msgs)
+}
+
+// diskStore keeps every queued message in a file named by its sequence number.
+type diskStore struct {
+	dir  string
+	seqs []uint64 // sequence numbers of the queued messages in order
+	head *Message // cached first message
+	next uint64   // sequence number of the next message
+}
+
+// queueFileExt is the file extension of queued messages.
+const queueFileExt = ".msg"
+
+// newDiskStore opens a queue directory and loads the sequence numbers of the stored messages.
+func newDiskStore(dir string) (*diskStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create mqtt queue directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mqtt queue directory: %w", err)
+	}
+
+	s := &diskStore{dir: dir}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), queueFileExt)
+		if !ok || e.IsDir() {
+			continue
+		}
+		seq, err := strconv.ParseUint(name, 16, 64)
+		if err != nil {
+			continue
+		}
+		s.seqs = append(s.seqs, seq)
+	}
+	slices.Sort(s.seqs)
+	if n := len(s.seqs); n > 0 {
+		s.next = s.seqs[n-1] + 1
+	}
+	return s, nil
+}
+
+// file returns the file name of a sequence number.
+func (s *diskStore) file(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016x%s", seq, queueFileExt))
+}
+
+// push writes the message to a temporary file and renames it, so a crash never leaves a partial message.
+func (s *diskStore) push(msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	file := s.file(s.next)
+	if err := os.WriteFile(file+".tmp", data, 0o600); err != nil {
+		return fmt.Errorf("failed to write queued mqtt message: %w", err)
+	}
+	if err := os.Rename(file+".tmp", file); err != nil {
+		return fmt.Errorf("failed to write queued mqtt message: %w", err)
+	}
+
+	s.seqs = append(s.seqs, s.next)
+	s.next++
+	return nil
+}
+
+// peek returns the first message; unreadable files are skipped and removed.
+func (s *diskStore) peek() (Message, bool) {
+	for s.head == nil && len(s.seqs) > 0 {
+		var msg Message
+		data, err := os.ReadFile(s.file(s.seqs[0]))
+		if err == nil {
+			err = json.Unmarshal(data, &msg)
+		}
+		if err != nil {
+			_ = s.pop()
+			continue
+		}
+		s.head = &msg
+	}
+
+	if s.head == nil {
+		return Message{}, false
+	}
+	return *s.head, true
+}
+
+func (s *diskStore) pop() error {
+	if len(s.seqs) == 0 {
+		return nil
+	}
+	file := s.file(s.seqs[0])
+	s.seqs = s.seqs[1:]
+	s.head = nil
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove queued mqtt message: %w", err)
+	}
+	return nil
+}
+
+func (s *diskStore) len() int {
+	return len(s.seqs)
+}
@@ -0,0 +1,186 @@
+package mqtt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/womat/golib/mqtt/mqtttest"
+)
+
+// publishLog records the payloads published to a test broker.
+type publishLog struct {
+	mu       sync.Mutex
+	payloads []string
+}
+
+func (l *publishLog) record(topic string, payload []byte) {
+	if !strings.HasPrefix(topic, "queue/") {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.payloads = append(l.payloads, string(payload))
+}
+
+func (l *publishLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.payloads...)
+}
+
+func publishN(t *testing.T, h *Handler, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		if err := h.Publish(Message{Topic: "queue/test", Payload: []byte(fmt.Sprint(i)), Qos: 1}); err != nil {
+			t.Fatalf("Publish(%d) error = %v", i, err)
+		}
+	}
+}
+
+func TestOfflineQueue(t *testing.T) {
+	var log publishLog
+	b := newTestBroker(t, mqtttest.WithOnPublish(log.record))
+	addr := b.Addr()
+
+	h, err := New(b.URL(), "device", WithOfflineQueue(3))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	publishN(t, h, 0, 1)
+	if s := h.QueueStats(); s != (QueueStats{}) {
+		t.Errorf("QueueStats() online = %+v, want zero", s)
+	}
+
+	_ = b.Close()
+	waitFor(t, "connection lost", func() bool { return !h.client.isConnectionOpen() })
+
+	// 5 messages do not fit into the queue, the oldest ones are dropped
+	publishN(t, h, 1, 6)
+	if s := h.QueueStats(); s.Depth != 3 || s.Dropped != 2 {
+		t.Errorf("QueueStats() offline = %+v, want depth 3, dropped 2", s)
+	}
+
+	newTestBroker(t, mqtttest.WithAddress(addr), mqtttest.WithOnPublish(log.record))
+	waitFor(t, "flush", func() bool { return h.QueueStats().Depth == 0 })
+	publishN(t, h, 6, 7)
+
+	want := []string{"0", "3", "4", "5", "6"}
+	waitFor(t, "messages", func() bool { return len(log.get()) >= len(want) })
+	if got := log.get(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("published = %v, want %v", got, want)
+	}
+	if s := h.QueueStats(); s != (QueueStats{Dropped: 2, Flushed: 3}) {
+		t.Errorf("QueueStats() = %+v, want dropped 2, flushed 3", s)
+	}
+}
+
+func TestPersistentQueue(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "queue")
+	var log publishLog
+	b := newTestBroker(t, mqtttest.WithOnPublish(log.record))
+	addr := b.Addr()
+	_ = b.Close()
+
+	// the broker is down: the messages are only stored on disk
+	h, err := New("tcp://"+addr, "device", WithPersistentQueue(dir, 10), WithConnectTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	publishN(t, h, 0, 4)
+	h.Disconnect()
+
+	// a corrupt file is skipped
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+queueFileExt))
+	if len(files) != 4 {
+		t.Fatalf("queue files = %v, want 4", files)
+	}
+	if err := os.WriteFile(files[1], []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	newTestBroker(t, mqtttest.WithAddress(addr), mqtttest.WithOnPublish(log.record))
+	h, err = New("tcp://"+addr, "device", WithPersistentQueue(dir, 10))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	want := []string{"0", "2", "3"}
+	waitFor(t, "messages", func() bool { return len(log.get()) >= len(want) })
+	if got := log.get(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("published = %v, want %v", got, want)
+	}
+	waitFor(t, "empty queue", func() bool { return h.QueueStats().Depth == 0 })
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 0 {
+		t.Errorf("queue files after flush = %v, want none", files)
+	}
+}
+
+func TestQueueRejected(t *testing.T) {
+	var log publishLog
+	opts := []mqtttest.Option{
+		mqtttest.WithOnPublish(log.record),
+		mqtttest.WithAuthorization(func(_, topic string, _ bool) bool { return topic != "queue/denied" }),
+	}
+	b := newTestBroker(t, opts...)
+	addr := b.Addr()
+
+	h, err := New(b.URL(), "device", WithProtocolVersion(MQTT5), WithOfflineQueue(10))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	// a rejected message is returned to the caller and not queued
+	var rerr *ReasonCodeError
+	if err := h.Publish(Message{Topic: "queue/denied", Payload: []byte("x"), Qos: 1}); !errors.As(err, &rerr) || rerr.Code != 0x87 {
+		t.Errorf("Publish() to a denied topic error = %v, want reason code 0x87", err)
+	}
+	if s := h.QueueStats(); s != (QueueStats{}) {
+		t.Errorf("QueueStats() after rejected message = %+v, want zero", s)
+	}
+	publishN(t, h, 0, 1)
+
+	// a rejected queued message is dropped and does not block the queue
+	_ = b.Close()
+	waitFor(t, "connection lost", func() bool { return !h.client.isConnectionOpen() })
+	if err := h.Publish(Message{Topic: "queue/denied", Payload: []byte("x"), Qos: 1}); err != nil {
+		t.Fatalf("Publish() offline error = %v", err)
+	}
+	publishN(t, h, 1, 3)
+
+	newTestBroker(t, append(opts, mqtttest.WithAddress(addr))...)
+	waitFor(t, "flush", func() bool { return h.QueueStats().Depth == 0 })
+	publishN(t, h, 3, 4)
+
+	want := []string{"0", "1", "2", "3"}
+	waitFor(t, "messages", func() bool { return len(log.get()) >= len(want) })
+	if got := log.get(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("published = %v, want %v", got, want)
+	}
+	if s := h.QueueStats(); s != (QueueStats{Dropped: 1, Flushed: 2}) {
+		t.Errorf("QueueStats() = %+v, want dropped 1, flushed 2", s)
+	}
+}
+
+func TestQueueOptionErrors(t *testing.T) {
+	if _, err := New("tcp://127.0.0.1:1", "device", WithOfflineQueue(-1)); err == nil {
+		t.Errorf("New() with queue size -1: expected error")
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New("tcp://127.0.0.1:1", "device", WithPersistentQueue(file, 1)); err == nil {
+		t.Errorf("New() with a file as queue directory: expected error")
+	}
+}
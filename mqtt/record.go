@@ -0,0 +1,119 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/womat/golib/keyvalue"
+)
+
+var ErrInvalidRecordKey = errors.New("invalid mqtt record key")
+
+// PublishRecord publishes r as one JSON document to topic, e.g. {"energy":1.5,"power":230}.
+func PublishRecord(p Publisher, topic string, r keyvalue.Record, opts ...PublishOption) error {
+	return PublishJSON(p, topic, r, opts...)
+}
+
+// SubscribeRecord subscribes to topicFilter and decodes every payload as a JSON document
+// into a keyvalue.Record, the inverse of PublishRecord. Numbers are decoded as float64.
+func SubscribeRecord(s Subscriber, topicFilter string, qos byte, handler func(topic string, r keyvalue.Record, err error)) error {
+	return SubscribeJSON(s, topicFilter, qos, handler)
+}
+
+// PublishRecordTopics publishes every field of r as a message of its own to
+// "<prefix>/<key>", in the order of r.GetSortedKeys(). The payload is formatted with
+// r.String(key); other values than bool, int, int64, float64 and string are encoded as JSON.
+//
+// No message is sent if a key is empty or contains a wildcard. The returned error
+// joins the errors of all failed messages.
+func PublishRecordTopics(p Publisher, prefix string, r keyvalue.Record, opts ...PublishOption) error {
+	if strings.ContainsAny(prefix, "+#") {
+		return ErrInvalidTopicFilter
+	}
+	keys := r.GetSortedKeys()
+	for _, key := range keys {
+		if key == "" || strings.ContainsAny(key, "+#") {
+			return fmt.Errorf("%w: %q", ErrInvalidRecordKey, key)
+		}
+	}
+
+	var errs []error
+	for _, key := range keys {
+		payload, err := recordValue(r, key)
+		if err == nil {
+			msg := Message{Topic: recordTopic(prefix, key), Payload: payload}
+			for _, opt := range opts {
+				opt(&msg)
+			}
+			err = p.Publish(msg)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("key %s: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SubscribeRecordTopics subscribes to the topic subtree "<prefix>/#" and reconstructs
+// the record published by PublishRecordTopics, the key being the topic without the prefix.
+// The values are kept as strings; use the converting accessors of keyvalue.Record, e.g. Float64.
+// An empty payload, e.g. a deleted retained message, removes the key.
+//
+// handler is called after every message with the key of the message and a copy of the
+// record with all keys received so far.
+func SubscribeRecordTopics(s Subscriber, prefix string, qos byte, handler func(key string, r keyvalue.Record)) error {
+	if strings.ContainsAny(prefix, "+#") {
+		return ErrInvalidTopicFilter
+	}
+	if handler == nil {
+		return errors.New("mqtt subscribe handler must not be nil")
+	}
+
+	var mu sync.Mutex
+	record := keyvalue.NewRecord()
+	return s.Subscribe(recordTopic(prefix, "#"), qos, func(msg Message) {
+		key, ok := msg.Topic, true
+		if prefix != "" {
+			key, ok = strings.CutPrefix(msg.Topic, prefix+"/")
+		}
+		if !ok || key == "" {
+			return // the prefix itself is no key
+		}
+
+		mu.Lock()
+		if len(msg.Payload) == 0 {
+			delete(record, key)
+		} else {
+			record.Set(key, string(msg.Payload))
+		}
+		r := record.Copy()
+		mu.Unlock()
+
+		handler(key, r)
+	})
+}
+
+// recordTopic returns the topic of a record key.
+func recordTopic(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "/" + key
+}
+
+// recordValue formats the value of a record key.
+func recordValue(r keyvalue.Record, key string) ([]byte, error) {
+	v, _ := r.Value(key)
+	switch v.(type) {
+	case bool, int, int64, float64, string:
+		return []byte(r.String(key)), nil
+	}
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("encode json: %w", err)
+	}
+	return payload, nil
+}
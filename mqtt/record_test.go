@@ -0,0 +1,142 @@
+package mqtt
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/womat/golib/keyvalue"
+)
+
+func TestPublishRecordTopics(t *testing.T) {
+	next := &fakePublisher{}
+	r := keyvalue.Record{
+		"power":    230.5,
+		"energy":   int64(1234),
+		"state":    "on",
+		"online":   true,
+		"phases":   []int{1, 2, 3},
+		"l1/power": 80,
+	}
+	if err := PublishRecordTopics(next, "meter", r, WithQos(1), WithRetained()); err != nil {
+		t.Fatalf("PublishRecordTopics() error = %v", err)
+	}
+
+	var got []string
+	for _, msg := range next.msgs {
+		if msg.Qos != 1 || !msg.Retained {
+			t.Errorf("message %s: qos = %d, retained = %v", msg.Topic, msg.Qos, msg.Retained)
+		}
+		got = append(got, msg.Topic+"="+string(msg.Payload))
+	}
+	want := "meter/energy=1234 meter/l1/power=80 meter/online=true meter/phases=[1,2,3] meter/power=230.5 meter/state=on"
+	if strings.Join(got, " ") != want {
+		t.Errorf("published %s, want %s", strings.Join(got, " "), want)
+	}
+
+	for _, key := range []string{"", "a/+", "#"} {
+		if err := PublishRecordTopics(next, "meter", keyvalue.Record{"ok": 1, key: 1}); !errors.Is(err, ErrInvalidRecordKey) {
+			t.Errorf("PublishRecordTopics() with key %q error = %v, want %v", key, err, ErrInvalidRecordKey)
+		}
+	}
+	if err := PublishRecordTopics(next, "meter/+", r); !errors.Is(err, ErrInvalidTopicFilter) {
+		t.Errorf("PublishRecordTopics() with prefix meter/+ error = %v, want %v", err, ErrInvalidTopicFilter)
+	}
+	if n := len(next.msgs); n != len(r) {
+		t.Errorf("published %d messages, want %d", n, len(r))
+	}
+
+	next.err = ErrTimeout
+	if err := PublishRecordTopics(next, "meter", keyvalue.Record{"a": 1, "b": 2}); !errors.Is(err, ErrTimeout) ||
+		!strings.Contains(err.Error(), "key a") || !strings.Contains(err.Error(), "key b") {
+		t.Errorf("PublishRecordTopics() error = %v, want %v for key a and b", err, ErrTimeout)
+	}
+}
+
+func TestRecordTopics(t *testing.T) {
+	b := newTestBroker(t)
+
+	h, err := New(b.URL(), "device")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	// retained fields of a previous run are received on subscribe
+	if err := PublishRecordTopics(h, "meter", keyvalue.Record{"energy": 1000, "state": "off"}, WithQos(1), WithRetained()); err != nil {
+		t.Fatalf("PublishRecordTopics() error = %v", err)
+	}
+
+	var mu sync.Mutex
+	var last keyvalue.Record
+	var keys []string
+	current := func() (keyvalue.Record, []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		return last, append([]string(nil), keys...)
+	}
+	if err := SubscribeRecordTopics(h, "meter", 1, func(key string, r keyvalue.Record) {
+		mu.Lock()
+		defer mu.Unlock()
+		last, keys = r, append(keys, key)
+	}); err != nil {
+		t.Fatalf("SubscribeRecordTopics() error = %v", err)
+	}
+	waitFor(t, "retained fields", func() bool { _, keys := current(); return len(keys) == 2 })
+
+	if err := PublishRecordTopics(h, "meter", keyvalue.Record{"power": 230.5, "state": "on", "l1/power": 80}, WithQos(1)); err != nil {
+		t.Fatalf("PublishRecordTopics() error = %v", err)
+	}
+	if err := h.Publish(Message{Topic: "meter/energy", Qos: 1, Retained: true}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if err := h.Publish(Message{Topic: "meter", Payload: []byte("x"), Qos: 1}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	waitFor(t, "fields", func() bool { _, keys := current(); return len(keys) == 6 })
+
+	r, keys := current()
+	if got, want := strings.Join(keys[2:], ","), "l1/power,power,state,energy"; got != want {
+		t.Errorf("received keys %s, want %s", got, want)
+	}
+	if got, want := strings.Join(r.GetSortedKeys(), ","), "l1/power,power,state"; got != want {
+		t.Errorf("record keys = %s, want %s", got, want)
+	}
+	if r.Float64("power") != 230.5 || r.Int("l1/power") != 80 || r.String("state") != "on" {
+		t.Errorf("record = %v", r)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	b := newTestBroker(t)
+
+	h, err := New(b.URL(), "device")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	received := make(chan keyvalue.Record, 1)
+	if err := SubscribeRecord(h, "meter", 1, func(_ string, r keyvalue.Record, err error) {
+		if err != nil {
+			t.Errorf("SubscribeRecord() handler error = %v", err)
+		}
+		received <- r
+	}); err != nil {
+		t.Fatalf("SubscribeRecord() error = %v", err)
+	}
+	if err := PublishRecord(h, "meter", keyvalue.Record{"power": 230.5, "state": "on"}, WithQos(1)); err != nil {
+		t.Fatalf("PublishRecord() error = %v", err)
+	}
+
+	select {
+	case r := <-received:
+		if r.Float64("power") != 230.5 || r.String("state") != "on" || len(r) != 2 {
+			t.Errorf("record = %v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for record")
+	}
+}
@@ -0,0 +1,215 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrRemote = errors.New("mqtt rpc failed")
+
+// rpcErrorProperty is the user property that carries the error of an MQTT 5 response.
+const rpcErrorProperty = "error"
+
+// rpcRequest is the payload of a request without MQTT 5 properties.
+type rpcRequest struct {
+	ResponseTopic   string `json:"response_topic"`
+	CorrelationData []byte `json:"correlation_data"`
+	Payload         []byte `json:"payload"`
+}
+
+// rpcResponse is the payload of a response without MQTT 5 properties.
+type rpcResponse struct {
+	CorrelationData []byte `json:"correlation_data"`
+	Payload         []byte `json:"payload,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+// Call sends the request req to topic and waits for the response of a handler
+// registered with Serve. If ctx has no deadline, the publish timeout applies to
+// the whole call. An error returned by the remote handler is wrapped in ErrRemote.
+//
+// With MQTT 5 the request carries the response topic and correlation data as
+// properties. With MQTT 3.1.1 they are sent in a JSON envelope around the payload,
+// so both sides must use Call and Serve.
+//
+// Responses are received on "rpc/reply/<client id>", which is subscribed at the
+// first call, and again after it has been unsubscribed with Unsubscribe.
+//
+// Requests are never put into the offline queue: if the client is not connected,
+// Call returns ErrNotConnected immediately.
+func (m *Handler) Call(ctx context.Context, topic string, req []byte) ([]byte, error) {
+	if topic == "" {
+		return nil, ErrTopicEmpty
+	}
+	replyTopic, err := m.subscribeReplies()
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	key := hex.EncodeToString(id)
+	reply := make(chan Message, 1)
+
+	m.mu.Lock()
+	m.rpc[key] = reply
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.rpc, key)
+		m.mu.Unlock()
+	}()
+
+	ctx, cancel := m.publishContext(ctx)
+	defer cancel()
+
+	msg := Message{Topic: topic, Payload: req, Qos: 1}
+	if m.properties {
+		msg.ResponseTopic = replyTopic
+		msg.CorrelationData = id
+	} else {
+		if msg.Payload, err = json.Marshal(rpcRequest{ResponseTopic: replyTopic, CorrelationData: id, Payload: req}); err != nil {
+			return nil, fmt.Errorf("encode json: %w", err)
+		}
+	}
+	err = m.publishRPC(ctx, msg)
+	if err == nil {
+		select {
+		case resp := <-reply:
+			if e, ok := resp.UserProperties[rpcErrorProperty]; ok {
+				return nil, fmt.Errorf("%w: %s", ErrRemote, e)
+			}
+			return resp.Payload, nil
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("mqtt rpc %s: %w", topic, ErrTimeout)
+	}
+	return nil, err
+}
+
+// publishRPC sends a request or response without the offline queue: a message
+// delivered after the caller has given up would be handled for nothing.
+func (m *Handler) publishRPC(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	client := m.client
+	m.mu.Unlock()
+
+	if client == nil {
+		return ErrClientNotInitialized
+	}
+	if !client.isConnectionOpen() {
+		return ErrNotConnected
+	}
+	return waitTokenContext(ctx, client.publish(msg))
+}
+
+// Serve registers handler for the requests sent by Call to topic, which may contain
+// wildcards. Every request is handled in a new goroutine; the returned payload or
+// error is sent back to the caller. Requests without a response topic are ignored.
+// Like requests, responses are never put into the offline queue.
+func (m *Handler) Serve(topic string, handler func(req []byte) ([]byte, error)) error {
+	if handler == nil {
+		return errors.New("mqtt rpc handler must not be nil")
+	}
+	return m.Subscribe(topic, 1, func(msg Message) {
+		req := rpcRequest{ResponseTopic: msg.ResponseTopic, CorrelationData: msg.CorrelationData, Payload: msg.Payload}
+		if req.ResponseTopic == "" {
+			if err := json.Unmarshal(msg.Payload, &req); err != nil || req.ResponseTopic == "" {
+				return
+			}
+		}
+
+		// handlers must not block, see Subscribe
+		go func() {
+			payload, err := handler(req.Payload)
+			ctx, cancel := m.publishContext(context.Background())
+			defer cancel()
+			_ = m.publishRPC(ctx, m.rpcReply(req, payload, err))
+		}()
+	})
+}
+
+// rpcReply builds the response to a request.
+func (m *Handler) rpcReply(req rpcRequest, payload []byte, err error) Message {
+	msg := Message{Topic: req.ResponseTopic, Qos: 1}
+	if m.properties {
+		msg.Payload = payload
+		msg.CorrelationData = req.CorrelationData
+		if err != nil {
+			msg.Payload = nil
+			msg.UserProperties = map[string]string{rpcErrorProperty: err.Error()}
+		}
+		return msg
+	}
+
+	resp := rpcResponse{CorrelationData: req.CorrelationData, Payload: payload}
+	if err != nil {
+		resp = rpcResponse{CorrelationData: req.CorrelationData, Error: err.Error()}
+	}
+	msg.Payload, _ = json.Marshal(resp) // a struct of strings and bytes always marshals
+	return msg
+}
+
+// subscribeReplies subscribes the reply topic at the first call, or if it has been
+// unsubscribed, and returns it.
+func (m *Handler) subscribeReplies() (string, error) {
+	replyTopic := "rpc/reply/" + strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(m.clientID)
+
+	// concurrent first calls must wait for the subscription
+	m.rpcMu.Lock()
+	defer m.rpcMu.Unlock()
+
+	m.mu.Lock()
+	subscribed := m.replies != nil && slices.Contains(m.subscriptions, m.replies)
+	m.mu.Unlock()
+	if subscribed {
+		return replyTopic, nil
+	}
+
+	// a failed subscribe removes handleReply again, so the next call subscribes anew
+	s, err := m.subscribe(replyTopic, 1, m.handleReply)
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	m.replies = s
+	if m.rpc == nil {
+		m.rpc = make(map[string]chan Message)
+	}
+	m.mu.Unlock()
+	return replyTopic, nil
+}
+
+// handleReply passes a response to the waiting Call.
+func (m *Handler) handleReply(msg Message) {
+	if msg.CorrelationData == nil {
+		var resp rpcResponse
+		if err := json.Unmarshal(msg.Payload, &resp); err != nil {
+			return
+		}
+		msg.CorrelationData, msg.Payload = resp.CorrelationData, resp.Payload
+		if resp.Error != "" {
+			msg.UserProperties = map[string]string{rpcErrorProperty: resp.Error}
+		}
+	}
+
+	m.mu.Lock()
+	reply, ok := m.rpc[hex.EncodeToString(msg.CorrelationData)]
+	m.mu.Unlock()
+	if !ok {
+		return // a late response to a call that has already timed out
+	}
+	select {
+	case reply <- msg:
+	default: // duplicate response
+	}
+}
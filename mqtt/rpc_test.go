@@ -0,0 +1,216 @@
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/womat/golib/mqtt/mqtttest"
+)
+
+func TestCallAndServe(t *testing.T) {
+	b := newTestBroker(t)
+
+	server, err := New(b.URL(), "server")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer server.Disconnect()
+	client, err := New(b.URL(), "client")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer client.Disconnect()
+
+	if err := server.Serve("devices/+/calibrate", func(req []byte) ([]byte, error) {
+		if len(req) == 0 {
+			return nil, errors.New("missing sensor")
+		}
+		return append([]byte("calibrated "), req...), nil
+	}); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+
+	// concurrent calls receive their own responses
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := fmt.Sprint("sensor", i)
+			resp, err := client.Call(context.Background(), "devices/gw1/calibrate", []byte(req))
+			if err != nil || string(resp) != "calibrated "+req {
+				t.Errorf("Call(%s) = %q, %v, want %q", req, resp, err, "calibrated "+req)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := client.Call(context.Background(), "devices/gw1/calibrate", nil); !errors.Is(err, ErrRemote) {
+		t.Errorf("Call() error = %v, want %v", err, ErrRemote)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := client.Call(ctx, "devices/gw1/unknown", nil); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Call() without server error = %v, want %v", err, ErrTimeout)
+	}
+	if _, err := client.Call(context.Background(), "", nil); err != ErrTopicEmpty {
+		t.Errorf("Call() with empty topic error = %v, want %v", err, ErrTopicEmpty)
+	}
+	if err := server.Serve("devices/+/x", nil); err == nil {
+		t.Errorf("Serve() without handler: expected error")
+	}
+}
+
+func TestRPCProperties(t *testing.T) {
+	// with MQTT 5 the response topic, correlation data and error are properties
+	h := &Handler{properties: true, rpc: make(map[string]chan Message)}
+	id := []byte{1, 2, 3}
+	req := rpcRequest{ResponseTopic: "rpc/reply/client", CorrelationData: id}
+
+	msg := h.rpcReply(req, []byte("ok"), nil)
+	if msg.Topic != req.ResponseTopic || string(msg.Payload) != "ok" || !bytes.Equal(msg.CorrelationData, id) {
+		t.Errorf("rpcReply() = %+v", msg)
+	}
+	msg = h.rpcReply(req, []byte("ok"), errors.New("failed"))
+	if msg.Payload != nil || msg.UserProperties[rpcErrorProperty] != "failed" {
+		t.Errorf("rpcReply() with error = %+v", msg)
+	}
+
+	reply := make(chan Message, 1)
+	h.rpc[hex.EncodeToString(id)] = reply
+	h.handleReply(msg)
+	h.handleReply(msg) // a duplicate does not block
+	if got := <-reply; got.UserProperties[rpcErrorProperty] != "failed" {
+		t.Errorf("handleReply() passed %+v", got)
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	// the broker refuses the subscription of the reply topic
+	refusing := newTestBroker(t, mqtttest.WithAuthorization(func(_, topic string, subscribe bool) bool {
+		return !subscribe || !strings.HasPrefix(topic, "rpc/reply/")
+	}))
+	h, err := New(refusing.URL(), "client")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	if _, err := h.Call(context.Background(), "devices/gw1/calibrate", nil); err == nil {
+		t.Error("Call() with failed reply subscription: expected error")
+	}
+	h.mu.Lock()
+	rpc, subscriptions := h.rpc, len(h.subscriptions)
+	h.mu.Unlock()
+	if rpc != nil || subscriptions != 0 {
+		t.Errorf("after failed Call(): rpc = %v, %d subscriptions, want nil, 0", rpc, subscriptions)
+	}
+
+	// requests are not queued while the client is not connected
+	b := newTestBroker(t)
+	h, err = New(b.URL(), "queued", WithOfflineQueue(10))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	_ = b.Close()
+	waitFor(t, "connection lost", func() bool { return !h.client.isConnectionOpen() })
+	start := time.Now()
+	if _, err := h.Call(context.Background(), "devices/gw1/calibrate", nil); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Call() while disconnected error = %v, want %v", err, ErrNotConnected)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Call() while disconnected took %v", d)
+	}
+	if s := h.QueueStats(); s.Depth != 0 {
+		t.Errorf("QueueStats() = %+v, want no queued request", s)
+	}
+}
+
+func TestCallAfterUnsubscribe(t *testing.T) {
+	b := newTestBroker(t)
+
+	h, err := New(b.URL(), "client")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	if err := h.Serve("echo", func(req []byte) ([]byte, error) { return req, nil }); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+	for i := range 2 {
+		if resp, err := h.Call(context.Background(), "echo", []byte("ping")); err != nil || string(resp) != "ping" {
+			t.Errorf("Call() %d = %q, %v, want ping", i, resp, err)
+		}
+		// the reply topic is subscribed again by the next call
+		if err := h.Unsubscribe("rpc/reply/client"); err != nil {
+			t.Fatalf("Unsubscribe() error = %v", err)
+		}
+	}
+}
+
+func TestServeReplyNotQueued(t *testing.T) {
+	var replies atomic.Int32
+	onPublish := mqtttest.WithOnPublish(func(topic string, _ []byte) {
+		if strings.HasPrefix(topic, "rpc/reply/") {
+			replies.Add(1)
+		}
+	})
+	b := newTestBroker(t, onPublish)
+	addr := b.Addr()
+
+	server, err := New(b.URL(), "server", WithOfflineQueue(10), WithRetryInterval(50*time.Millisecond),
+		WithMaxReconnectInterval(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer server.Disconnect()
+	client, err := New(b.URL(), "client")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer client.Disconnect()
+
+	started, release, handled := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	if err := server.Serve("slow", func(req []byte) ([]byte, error) {
+		close(started)
+		<-release
+		defer close(handled)
+		return req, nil
+	}); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() { _, _ = client.Call(ctx, "slow", []byte("late")) }()
+	<-started
+
+	// the response of a request handled while the server is offline is discarded
+	_ = b.Close()
+	waitFor(t, "connection lost", func() bool { return !server.client.isConnectionOpen() })
+	close(release)
+	<-handled
+	time.Sleep(50 * time.Millisecond)
+	if s := server.QueueStats(); s.Depth != 0 {
+		t.Errorf("QueueStats() = %+v, want no queued response", s)
+	}
+
+	newTestBroker(t, mqtttest.WithAddress(addr), onPublish)
+	waitFor(t, "reconnect", func() bool { return server.client.isConnectionOpen() })
+	time.Sleep(100 * time.Millisecond)
+	if n := replies.Load(); n != 0 {
+		t.Errorf("%d responses published after reconnect, want 0", n)
+	}
+}
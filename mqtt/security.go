@@ -0,0 +1,91 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/womat/golib/crypt"
+)
+
+// WithCredentials sets the username and password for the broker.
+func WithCredentials(username, password string) Option {
+	return func(h *Handler) {
+		h.credentials = func() (string, string) {
+			return username, password
+		}
+	}
+}
+
+// WithEncryptedCredentials sets the username and a password stored as crypt.EncryptedString,
+// e.g. read from a configuration file. The password is decrypted on every connect and is
+// not kept in plain text.
+func WithEncryptedCredentials(username string, password crypt.EncryptedString) Option {
+	return func(h *Handler) {
+		h.credentials = func() (string, string) {
+			return username, password.Value()
+		}
+	}
+}
+
+// WithTLSConfig sets the TLS configuration for the broker connection.
+// The broker URL must use the scheme "ssl", "tls", "mqtts" or "wss", e.g. "ssl://broker:8883".
+// WithCAFile and WithClientCertificate are applied to a copy of cfg.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(h *Handler) {
+		h.tlsConfig = cfg
+	}
+}
+
+// WithCAFile adds the PEM encoded CA certificates of file to verify the broker certificate,
+// e.g. for a broker with a certificate signed by a private CA. The system CAs are not used.
+// New returns an error if the file cannot be read or contains no certificate.
+func WithCAFile(file string) Option {
+	return func(h *Handler) {
+		h.caFile = file
+	}
+}
+
+// WithClientCertificate sets a PEM encoded client certificate and private key for
+// mutual TLS authentication. New returns an error if the files cannot be loaded.
+func WithClientCertificate(certFile, keyFile string) Option {
+	return func(h *Handler) {
+		h.certFile = certFile
+		h.keyFile = keyFile
+	}
+}
+
+// buildTLSConfig returns the TLS configuration of the connection, or nil without TLS options.
+func (m *Handler) buildTLSConfig() (*tls.Config, error) {
+	if m.tlsConfig == nil && m.caFile == "" && m.certFile == "" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if m.tlsConfig != nil {
+		cfg = m.tlsConfig.Clone()
+	}
+
+	if m.caFile != "" {
+		pem, err := os.ReadFile(m.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA file %s", m.caFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if m.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(m.certFile, m.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,190 @@
+package mqtt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/womat/golib/crypt"
+	"github.com/womat/golib/mqtt/mqtttest"
+)
+
+// testPKI holds a CA and certificates signed by it, stored as PEM files.
+type testPKI struct {
+	pool       *x509.CertPool
+	server     tls.Certificate
+	caFile     string
+	clientCert string
+	clientKey  string
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	t.Helper()
+	dir := t.TempDir()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	issue := func(serial int64, name string, usage x509.ExtKeyUsage) ([]byte, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der, key
+	}
+	writePEM := func(name, typ string, der []byte) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	p := testPKI{pool: x509.NewCertPool()}
+	p.pool.AddCert(ca)
+	p.caFile = writePEM("ca.pem", "CERTIFICATE", caDER)
+
+	serverDER, serverKey := issue(2, "broker", x509.ExtKeyUsageServerAuth)
+	p.server = tls.Certificate{Certificate: [][]byte{serverDER}, PrivateKey: serverKey}
+
+	clientDER, clientKey := issue(3, "client", x509.ExtKeyUsageClientAuth)
+	keyDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.clientCert = writePEM("client.pem", "CERTIFICATE", clientDER)
+	p.clientKey = writePEM("client.key", "EC PRIVATE KEY", keyDER)
+	return p
+}
+
+func TestMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	b := newTestBroker(t,
+		mqtttest.WithTLS(&tls.Config{
+			Certificates: []tls.Certificate{pki.server},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    pki.pool,
+		}),
+		mqtttest.WithAuthentication(func(username, password string) bool {
+			return username == "gateway" && password == "s3cret"
+		}),
+	)
+
+	h, err := New(b.URL(), "tls-client",
+		WithCAFile(pki.caFile),
+		WithClientCertificate(pki.clientCert, pki.clientKey),
+		WithEncryptedCredentials("gateway", crypt.NewEncryptedString("s3cret")),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	received := make(chan Message, 1)
+	if err := h.Subscribe("secure/#", 1, func(msg Message) { received <- msg }); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := h.Publish(Message{Topic: "secure/state", Payload: []byte("on"), Qos: 1}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	select {
+	case msg := <-received:
+		if msg.Topic != "secure/state" || string(msg.Payload) != "on" {
+			t.Errorf("received %s %q, want secure/state on", msg.Topic, msg.Payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for message over TLS")
+	}
+
+	// without a client certificate the handshake fails
+	_, err = New(b.URL(), "anonymous", WithCAFile(pki.caFile), WithCredentials("gateway", "s3cret"),
+		WithConnectTimeout(time.Second), WithWaitForConnection())
+	if err == nil {
+		t.Error("New() without client certificate: expected error")
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	b := newTestBroker(t, mqtttest.WithAuthentication(func(username, password string) bool {
+		return username == "user" && password == "pass"
+	}))
+
+	h, err := New(b.URL(), "plain-client", WithCredentials("user", "pass"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	if !h.IsConnected() {
+		t.Error("IsConnected() = false, want true")
+	}
+
+	_, err = New(b.URL(), "other-client", WithCredentials("user", "wrong"), WithConnectTimeout(time.Second), WithWaitForConnection())
+	if err == nil {
+		t.Error("New() with wrong password: expected error")
+	}
+}
+
+func TestTLSOptionErrors(t *testing.T) {
+	pki := newTestPKI(t)
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{"missing CA file", WithCAFile(filepath.Join(t.TempDir(), "missing.pem"))},
+		{"empty CA file", WithCAFile(empty)},
+		{"missing key", WithClientCertificate(pki.clientCert, empty)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New("ssl://127.0.0.1:1", "client", tt.opt); err == nil {
+				t.Error("New() expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package mqtt
+
+const (
+	StatusOnline  = "online"  // StatusOnline is the birth payload of WithStatusTopic
+	StatusOffline = "offline" // StatusOffline is the last will payload of WithStatusTopic
+)
+
+// WithWill sets the Last Will and Testament: the broker publishes msg when the
+// connection is lost without a Disconnect(), e.g. after a crash or network failure.
+func WithWill(msg Message) Option {
+	return func(h *Handler) {
+		h.will = &msg
+	}
+}
+
+// WithBirth sets a message that is published after every successful connect,
+// including every automatic reconnect.
+func WithBirth(msg Message) Option {
+	return func(h *Handler) {
+		h.birth = &msg
+	}
+}
+
+// WithStatusTopic implements the common online-status convention: the retained
+// message "<prefix>/status" is "online" while the client is connected and "offline"
+// otherwise. It sets a will and a birth message with QoS 1 and additionally
+// publishes "offline" on Disconnect(), as the broker only sends the will when the
+// connection is lost.
+func WithStatusTopic(prefix string) Option {
+	return func(h *Handler) {
+		topic := prefix + "/status"
+		h.will = &Message{Topic: topic, Payload: []byte(StatusOffline), Qos: 1, Retained: true}
+		h.birth = &Message{Topic: topic, Payload: []byte(StatusOnline), Qos: 1, Retained: true}
+		h.death = h.will
+	}
+}
+
+// validateStatusMessages checks the topics of the will and birth messages.
+func (m *Handler) validateStatusMessages() error {
+	for _, msg := range []*Message{m.will, m.birth} {
+		if msg != nil && msg.Topic == "" {
+			return ErrTopicEmpty
+		}
+	}
+	return nil
+}
+
+// publishBirth publishes the birth message after a connect.
+func (m *Handler) publishBirth(client backend) {
+	if m.birth == nil {
+		return
+	}
+	// A failure means the new connection has already been lost again;
+	// the next connect publishes the birth message again.
+	_ = waitToken(client.publish(*m.birth), m.publishTimeout, ErrTimeout)
+}
+
+// publishDeath publishes the offline status before a graceful disconnect.
+func (m *Handler) publishDeath(client backend) {
+	if m.death == nil || !client.isConnectionOpen() {
+		return
+	}
+	_ = waitToken(client.publish(*m.death), m.publishTimeout, ErrTimeout)
+}
@@ -0,0 +1,82 @@
+package mqtt
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestStatusTopic(t *testing.T) {
+	b := newTestBroker(t)
+
+	observer, err := New(b.URL(), "observer")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer observer.Disconnect()
+
+	var mu sync.Mutex
+	var got []string
+	status := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), got...)
+	}
+	if err := observer.Subscribe("devices/+/status", 1, func(msg Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, string(msg.Payload))
+	}); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	device, err := New(b.URL(), "device", WithStatusTopic("devices/gw1"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	waitFor(t, "online", func() bool { return len(status()) == 1 })
+
+	// the broker publishes the will when the connection breaks, the reconnect the birth message
+	b.DisconnectClient("device")
+	waitFor(t, "offline and online", func() bool { return len(status()) == 3 })
+
+	// a graceful disconnect does not trigger the will, the handler publishes offline itself
+	device.Disconnect()
+	waitFor(t, "offline", func() bool { return len(status()) == 4 })
+
+	want := []string{StatusOnline, StatusOffline, StatusOnline, StatusOffline}
+	for i, s := range status() {
+		if s != want[i] {
+			t.Fatalf("status = %v, want %v", status(), want)
+		}
+	}
+	if payload, ok := b.Retained("devices/gw1/status"); !ok || string(payload) != StatusOffline {
+		t.Errorf("retained status = %q, want %q", payload, StatusOffline)
+	}
+}
+
+func TestWillAndBirth(t *testing.T) {
+	b := newTestBroker(t)
+
+	h, err := New(b.URL(), "device",
+		WithWill(Message{Topic: "device/will", Payload: []byte("gone"), Retained: true}),
+		WithBirth(Message{Topic: "device/birth", Payload: []byte("hello"), Qos: 1, Retained: true}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	waitFor(t, "birth message", func() bool {
+		payload, ok := b.Retained("device/birth")
+		return ok && string(payload) == "hello"
+	})
+	b.DisconnectClient("device")
+	waitFor(t, "will message", func() bool {
+		payload, ok := b.Retained("device/will")
+		return ok && string(payload) == "gone"
+	})
+
+	if _, err := New(b.URL(), "invalid", WithWill(Message{Payload: []byte("x")})); err != ErrTopicEmpty {
+		t.Errorf("New() with empty will topic error = %v, want %v", err, ErrTopicEmpty)
+	}
+}
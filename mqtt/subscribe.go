@@ -0,0 +1,207 @@
+package mqtt
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidTopicFilter = errors.New("invalid mqtt topic filter")
+
+// subscription is a message handler registered with Subscribe.
+type subscription struct {
+	filter  string
+	qos     byte
+	handler func(Message)
+}
+
+// Subscribe registers handler for all messages on topics matching topicFilter.
+// The filter may contain the wildcards '+' (a single level) and '#' (all remaining
+// levels, last level only). A shared subscription "$share/<group>/<filter>" lets the
+// broker distribute the messages among all clients of the group. Several handlers
+// may be registered for the same or overlapping filters; every matching handler
+// receives the message.
+//
+// The subscription is kept by the Handler and renewed automatically after every
+// reconnect. If the client is currently not connected, the subscription is sent to
+// the broker as soon as the connection is established and Subscribe returns nil.
+// If the broker does not acknowledge the subscription, the handler is removed again
+// and the error is returned.
+//
+// Handlers are called sequentially in the order the messages arrive. A handler must
+// not block; Publish from within a handler must be called in a new goroutine.
+func (m *Handler) Subscribe(topicFilter string, qos byte, handler func(Message)) error {
+	_, err := m.subscribe(topicFilter, qos, handler)
+	return err
+}
+
+// subscribe registers a handler like Subscribe and returns its subscription.
+func (m *Handler) subscribe(topicFilter string, qos byte, handler func(Message)) (*subscription, error) {
+	if err := validateTopicFilter(topicFilter); err != nil {
+		return nil, err
+	}
+	if handler == nil {
+		return nil, errors.New("mqtt subscribe handler must not be nil")
+	}
+
+	m.mu.Lock()
+	client := m.client
+	if client == nil {
+		m.mu.Unlock()
+		return nil, ErrClientNotInitialized
+	}
+	s := &subscription{filter: topicFilter, qos: qos, handler: handler}
+	m.subscriptions = append(m.subscriptions, s)
+	qos = m.filterQos(topicFilter)
+	m.mu.Unlock()
+
+	// isConnected is also true while the client (re)connects
+	if !client.isConnectionOpen() {
+		return s, nil // subscribed by resubscribe() when the connection is established
+	}
+	if err := waitToken(client.subscribe(map[string]byte{topicFilter: qos}), subscribeTimeout, ErrSubscribeTimeout); err != nil {
+		m.mu.Lock()
+		m.subscriptions = slices.DeleteFunc(m.subscriptions, func(x *subscription) bool { return x == s })
+		m.mu.Unlock()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Unsubscribe removes all handlers of the given topic filters and unsubscribes them at the broker.
+// If the broker does not acknowledge the unsubscription, the handlers are restored and the
+// error is returned.
+func (m *Handler) Unsubscribe(topicFilters ...string) error {
+	m.mu.Lock()
+	client := m.client
+	if client == nil {
+		m.mu.Unlock()
+		return ErrClientNotInitialized
+	}
+
+	remove := make(map[string]bool, len(topicFilters))
+	for _, filter := range topicFilters {
+		remove[filter] = true
+	}
+	var kept, removed []*subscription
+	for _, s := range m.subscriptions {
+		if remove[s.filter] {
+			removed = append(removed, s)
+		} else {
+			kept = append(kept, s)
+		}
+	}
+	m.subscriptions = kept
+	m.mu.Unlock()
+
+	if len(topicFilters) == 0 || !client.isConnectionOpen() {
+		return nil // the next connection is subscribed without the removed filters
+	}
+	if err := waitToken(client.unsubscribe(topicFilters...), subscribeTimeout, ErrSubscribeTimeout); err != nil {
+		m.mu.Lock()
+		m.subscriptions = append(m.subscriptions, removed...)
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// filterQos returns the highest QoS of all handlers of a topic filter.
+// The caller must hold m.mu.
+func (m *Handler) filterQos(topicFilter string) byte {
+	var qos byte
+	for _, s := range m.subscriptions {
+		if s.filter == topicFilter {
+			qos = max(qos, s.qos)
+		}
+	}
+	return qos
+}
+
+// resubscribe subscribes all topic filters at the broker, e.g. after a reconnect.
+func (m *Handler) resubscribe(client backend) {
+	m.mu.Lock()
+	filters := make(map[string]byte)
+	for _, s := range m.subscriptions {
+		filters[s.filter] = max(filters[s.filter], s.qos)
+	}
+	m.mu.Unlock()
+
+	if len(filters) == 0 {
+		return
+	}
+	// A failure means the new connection has already been lost again;
+	// the next reconnect repeats the subscription.
+	_ = waitToken(client.subscribe(filters), subscribeTimeout, ErrSubscribeTimeout)
+}
+
+// route delivers a received message to all handlers with a matching topic filter.
+func (m *Handler) route(msg Message) {
+	m.mu.Lock()
+	var handlers []func(Message)
+	for _, s := range m.subscriptions {
+		if matchTopic(s.filter, msg.Topic) {
+			handlers = append(handlers, s.handler)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(msg)
+	}
+}
+
+// sharePrefix starts a shared subscription "$share/<group>/<filter>".
+const sharePrefix = "$share/"
+
+// validateTopicFilter checks the placement of the wildcards in a topic filter.
+func validateTopicFilter(filter string) error {
+	if filter == "" {
+		return ErrTopicEmpty
+	}
+	if rest, ok := strings.CutPrefix(filter, sharePrefix); ok {
+		group, f, ok := strings.Cut(rest, "/")
+		if !ok || group == "" || strings.ContainsAny(group, "+#") {
+			return ErrInvalidTopicFilter
+		}
+		return validateTopicFilter(f)
+	}
+
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return ErrInvalidTopicFilter
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return ErrInvalidTopicFilter
+		}
+	}
+	return nil
+}
+
+// matchTopic reports whether topic matches the topic filter.
+// Wildcards at the first level do not match topics starting with '$' (e.g. $SYS).
+// A shared subscription matches the topics of its filter.
+func matchTopic(filter, topic string) bool {
+	if rest, ok := strings.CutPrefix(filter, sharePrefix); ok {
+		_, filter, _ = strings.Cut(rest, "/")
+	}
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		switch {
+		case level == "#":
+			// also matches the parent level, e.g. "a/#" matches "a"
+			return true
+		case i >= len(topicLevels):
+			return false
+		case level != "+" && level != topicLevels[i]:
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
@@ -0,0 +1,265 @@
+package mqtt
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/womat/golib/mqtt/mqtttest"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"sensors/temperature", "sensors/temperature", true},
+		{"sensors/temperature", "sensors/humidity", false},
+		{"sensors/+", "sensors/temperature", true},
+		{"sensors/+", "sensors/kitchen/temperature", false},
+		{"sensors/+/temperature", "sensors/kitchen/temperature", true},
+		{"sensors/#", "sensors/kitchen/temperature", true},
+		{"sensors/#", "sensors", true},
+		{"#", "sensors/temperature", true},
+		{"+/+", "/temperature", true},
+		{"+", "sensors/temperature", false},
+		{"#", "$SYS/uptime", false},
+		{"+/uptime", "$SYS/uptime", false},
+		{"$SYS/#", "$SYS/uptime", true},
+		{"$share/workers/jobs/+", "jobs/resize", true},
+		{"$share/workers/jobs/+", "jobs/resize/1", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchTopic(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("matchTopic(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTopicFilter(t *testing.T) {
+	for _, filter := range []string{"a", "a/+/b", "a/#", "#", "+", "/a//", "$share/g/a/#"} {
+		if err := validateTopicFilter(filter); err != nil {
+			t.Errorf("validateTopicFilter(%q) error = %v", filter, err)
+		}
+	}
+	for _, filter := range []string{"a/#/b", "a/b#", "a+/b", "a/++", "$share/g", "$share//a", "$share/+/a", "$share/g/a/#/b"} {
+		if err := validateTopicFilter(filter); !errors.Is(err, ErrInvalidTopicFilter) {
+			t.Errorf("validateTopicFilter(%q) error = %v, want %v", filter, err, ErrInvalidTopicFilter)
+		}
+	}
+	if err := validateTopicFilter(""); !errors.Is(err, ErrTopicEmpty) {
+		t.Errorf("validateTopicFilter(\"\") error = %v, want %v", err, ErrTopicEmpty)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	m := &Handler{}
+	var got []string
+	handler := func(name string) func(Message) {
+		return func(msg Message) { got = append(got, name+":"+msg.Topic) }
+	}
+	m.subscriptions = []*subscription{
+		{filter: "home/+/temperature", handler: handler("plus")},
+		{filter: "home/#", handler: handler("hash")},
+		{filter: "home/kitchen/temperature", handler: handler("exact")},
+		{filter: "office/#", handler: handler("office")},
+	}
+
+	m.route(Message{Topic: "home/kitchen/temperature"})
+	m.route(Message{Topic: "home/kitchen/humidity"})
+
+	want := []string{
+		"plus:home/kitchen/temperature",
+		"hash:home/kitchen/temperature",
+		"exact:home/kitchen/temperature",
+		"hash:home/kitchen/humidity",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("routed = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("routed = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSubscribeWithoutClient(t *testing.T) {
+	m := &Handler{}
+	if err := m.Subscribe("a/b", 0, func(Message) {}); !errors.Is(err, ErrClientNotInitialized) {
+		t.Errorf("Subscribe() error = %v, want %v", err, ErrClientNotInitialized)
+	}
+	if err := m.Subscribe("a/#/b", 0, func(Message) {}); !errors.Is(err, ErrInvalidTopicFilter) {
+		t.Errorf("Subscribe() error = %v, want %v", err, ErrInvalidTopicFilter)
+	}
+	if err := m.Unsubscribe("a/b"); !errors.Is(err, ErrClientNotInitialized) {
+		t.Errorf("Unsubscribe() error = %v, want %v", err, ErrClientNotInitialized)
+	}
+}
+
+func TestSubscribeResubscribesAfterReconnect(t *testing.T) {
+	b := newTestBroker(t)
+
+	var connects atomic.Int32
+	h, err := New(b.URL(), "subscriber", WithOnConnected(func() { connects.Add(1) }))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	var mu sync.Mutex
+	var got []string
+	record := func(name string) func(Message) {
+		return func(msg Message) {
+			mu.Lock()
+			defer mu.Unlock()
+			got = append(got, name+":"+string(msg.Payload))
+		}
+	}
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got)
+	}
+
+	if err := h.Subscribe("cmd/+/set", 1, record("plus")); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := h.Subscribe("cmd/#", 0, record("hash")); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := h.Publish(Message{Topic: "cmd/light/set", Payload: []byte("1"), Qos: 1}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	waitFor(t, "both handlers", func() bool { return count() == 2 })
+
+	// the broker drops the connection; the client reconnects with a new session
+	b.DisconnectClients()
+	waitFor(t, "reconnect", func() bool { return connects.Load() == 2 })
+	if err := h.Unsubscribe("cmd/#"); err != nil {
+		t.Fatalf("Unsubscribe() error = %v", err)
+	}
+	// the resubscription runs asynchronously after the reconnect
+	waitFor(t, "resubscription", func() bool {
+		_ = h.Publish(Message{Topic: "cmd/light/set", Payload: []byte("2"), Qos: 1})
+		time.Sleep(50 * time.Millisecond)
+		return count() > 2
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, s := range got[2:] {
+		if s != "plus:2" {
+			t.Errorf("after reconnect and Unsubscribe got %v, want only plus:2", got[2:])
+			break
+		}
+	}
+}
+
+func TestSubscribeWhileDisconnected(t *testing.T) {
+	// the broker is down: Subscribe and Unsubscribe only update the handlers
+	b := newTestBroker(t)
+	addr := b.Addr()
+	_ = b.Close()
+
+	h, err := New("tcp://"+addr, "subscriber", WithConnectTimeout(300*time.Millisecond), WithRetryInterval(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Disconnect()
+
+	var mu sync.Mutex
+	var got []string
+	record := func(name string) func(Message) {
+		return func(msg Message) {
+			mu.Lock()
+			defer mu.Unlock()
+			got = append(got, name+":"+string(msg.Payload))
+		}
+	}
+	received := func(s string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		n := 0
+		for _, g := range got {
+			if g == s {
+				n++
+			}
+		}
+		return n
+	}
+
+	if err := h.Subscribe("cmd/#", 1, record("hash")); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := h.Subscribe("cmd/+", 1, record("plus")); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := h.Unsubscribe("cmd/+"); err != nil {
+		t.Fatalf("Unsubscribe() error = %v", err)
+	}
+	h.mu.Lock()
+	n := len(h.subscriptions)
+	h.mu.Unlock()
+	if n != 1 {
+		t.Fatalf("%d handlers registered, want 1", n)
+	}
+
+	// the broker comes up; the client connects and subscribes
+	b = newTestBroker(t, mqtttest.WithAddress(addr))
+	waitFor(t, "subscription", func() bool {
+		b.Publish("cmd/x", []byte("1"), 1, false)
+		time.Sleep(20 * time.Millisecond)
+		return received("hash:1") > 0
+	})
+	b.Publish("cmd/x", []byte("2"), 1, false)
+	waitFor(t, "message", func() bool { return received("hash:2") > 0 })
+	time.Sleep(50 * time.Millisecond)
+	if n := received("hash:2"); n != 1 {
+		t.Errorf("message received %d times, want 1", n)
+	}
+	if n := received("plus:1") + received("plus:2"); n != 0 {
+		t.Errorf("unsubscribed handler received %d messages", n)
+	}
+}
+
+func TestSubscribeRefused(t *testing.T) {
+	b := newTestBroker(t, mqtttest.WithAuthorization(func(_, topic string, subscribe bool) bool {
+		return !subscribe || topic != "secret/#"
+	}))
+
+	tests := []struct {
+		version ProtocolVersion
+		code    byte
+	}{
+		{MQTT311, 0x80},
+		{MQTT5, 0x87},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version.String(), func(t *testing.T) {
+			h, err := New(b.URL(), "subscriber", WithProtocolVersion(tt.version))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer h.Disconnect()
+
+			var rerr *ReasonCodeError
+			if err := h.Subscribe("secret/#", 1, func(Message) {}); !errors.As(err, &rerr) || rerr.Code != tt.code {
+				t.Errorf("Subscribe() of a refused filter error = %v, want reason code 0x%02x", err, tt.code)
+			}
+			if err := h.Subscribe("public/#", 1, func(Message) {}); err != nil {
+				t.Errorf("Subscribe() error = %v", err)
+			}
+			h.mu.Lock()
+			n := len(h.subscriptions)
+			h.mu.Unlock()
+			if n != 1 {
+				t.Errorf("%d handlers registered, want 1", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/womat/golib/keyvalue"
+)
+
+// ThrottleOption configures a publisher created by NewThrottledPublisher.
+type ThrottleOption func(*throttledPublisher)
+
+// WithDeadband sets the deadband of numeric values (default 0): a value is only
+// published if it differs from the last published value by more than d.
+func WithDeadband(d float64) ThrottleOption {
+	return func(p *throttledPublisher) {
+		p.deadband = d
+	}
+}
+
+// WithTopicDeadband sets the deadband of the topics matching topicFilter, overriding
+// WithDeadband. If several filters match a topic, the first one added is used.
+func WithTopicDeadband(topicFilter string, d float64) ThrottleOption {
+	return func(p *throttledPublisher) {
+		p.topicDeadbands = append(p.topicDeadbands, topicDeadband{filter: topicFilter, deadband: d})
+	}
+}
+
+// WithFieldDeadband sets the deadband of a field of JSON object payloads, overriding
+// WithTopicDeadband and WithDeadband, e.g. WithFieldDeadband("power", 10).
+func WithFieldDeadband(key string, d float64) ThrottleOption {
+	return func(p *throttledPublisher) {
+		p.fieldDeadbands[key] = d
+	}
+}
+
+// WithMaxInterval publishes a message even if its value has not changed when the
+// last message of the topic was published at least d ago (default 0, never).
+func WithMaxInterval(d time.Duration) ThrottleOption {
+	return func(p *throttledPublisher) {
+		p.maxInterval = d
+	}
+}
+
+// topicDeadband is the deadband of the topics matching a filter.
+type topicDeadband struct {
+	filter   string
+	deadband float64
+}
+
+// lastPublished is the last message published to a topic.
+type lastPublished struct {
+	payload []byte
+	record  keyvalue.Record // decoded payload if it is a JSON object
+	time    time.Time
+}
+
+// throttledPublisher suppresses unchanged values, see NewThrottledPublisher.
+type throttledPublisher struct {
+	next           Publisher
+	deadband       float64
+	topicDeadbands []topicDeadband
+	fieldDeadbands map[string]float64
+	maxInterval    time.Duration
+
+	mu   sync.Mutex
+	last map[string]lastPublished // by topic
+}
+
+// NewThrottledPublisher returns a Publisher that only publishes a message to next if
+// its value has changed since the last message published to the same topic, e.g. to
+// keep meters that measure every second from flooding the broker.
+// Suppressed messages return nil; a failed message is not remembered.
+//
+// The payloads are compared
+//   - field by field as keyvalue.Record if both are JSON objects: a message is published
+//     if a field was added or removed, a numeric field changed by more than its deadband
+//     or another field changed,
+//   - as numbers if both are numbers and the topic has a deadband > 0,
+//   - byte by byte otherwise.
+//
+// With WithMaxInterval an unchanged value is published again after the interval. This
+// happens with the next message of the topic; there is no timer.
+func NewThrottledPublisher(next Publisher, opts ...ThrottleOption) Publisher {
+	p := &throttledPublisher{
+		next:           next,
+		fieldDeadbands: make(map[string]float64),
+		last:           make(map[string]lastPublished),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func (p *throttledPublisher) Publish(msg Message) error {
+	return p.PublishContext(context.Background(), msg)
+}
+
+func (p *throttledPublisher) PublishContext(ctx context.Context, msg Message) error {
+	now := time.Now()
+	record := decodeRecord(msg.Payload)
+
+	p.mu.Lock()
+	last, ok := p.last[msg.Topic]
+	p.mu.Unlock()
+	if ok && (p.maxInterval <= 0 || now.Sub(last.time) < p.maxInterval) && !p.changed(msg.Topic, last, msg.Payload, record) {
+		return nil
+	}
+
+	if err := p.next.PublishContext(ctx, msg); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.last[msg.Topic] = lastPublished{payload: bytes.Clone(msg.Payload), record: record, time: now}
+	p.mu.Unlock()
+	return nil
+}
+
+// changed reports whether a payload differs from the last published payload of a topic.
+func (p *throttledPublisher) changed(topic string, last lastPublished, payload []byte, record keyvalue.Record) bool {
+	deadband := p.topicDeadband(topic)
+
+	if record != nil && last.record != nil {
+		return p.recordChanged(last.record, record, deadband)
+	}
+	if deadband > 0 {
+		old, err1 := strconv.ParseFloat(string(bytes.TrimSpace(last.payload)), 64)
+		value, err2 := strconv.ParseFloat(string(bytes.TrimSpace(payload)), 64)
+		if err1 == nil && err2 == nil {
+			return math.Abs(value-old) > deadband
+		}
+	}
+	return !bytes.Equal(last.payload, payload)
+}
+
+// recordChanged compares two records field by field.
+func (p *throttledPublisher) recordChanged(last, record keyvalue.Record, deadband float64) bool {
+	if len(last) != len(record) {
+		return true
+	}
+	for _, key := range record.GetSortedKeys() {
+		if !last.Exists(key) {
+			return true
+		}
+		old, _ := last.Value(key)
+		value, _ := record.Value(key)
+
+		oldNumber, ok1 := old.(float64)
+		number, ok2 := value.(float64)
+		if ok1 && ok2 {
+			d, ok := p.fieldDeadbands[key]
+			if !ok {
+				d = deadband
+			}
+			if math.Abs(number-oldNumber) > d {
+				return true
+			}
+			continue
+		}
+		if !reflect.DeepEqual(old, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// topicDeadband returns the deadband of a topic.
+func (p *throttledPublisher) topicDeadband(topic string) float64 {
+	for _, t := range p.topicDeadbands {
+		if matchTopic(t.filter, topic) {
+			return t.deadband
+		}
+	}
+	return p.deadband
+}
+
+// decodeRecord decodes a JSON object payload; it returns nil for other payloads.
+func decodeRecord(payload []byte) keyvalue.Record {
+	payload = bytes.TrimSpace(payload)
+	if len(payload) == 0 || payload[0] != '{' {
+		return nil
+	}
+	var record keyvalue.Record
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return nil
+	}
+	return record
+}
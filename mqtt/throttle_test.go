@@ -0,0 +1,124 @@
+package mqtt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThrottledPublisher(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []ThrottleOption
+		topic    string
+		payloads []string
+		want     string
+	}{
+		{
+			name:     "raw payload",
+			topic:    "meter/state",
+			payloads: []string{"on", "on", "off", "off", "on"},
+			want:     "on,off,on",
+		},
+		{
+			name:     "number without deadband",
+			topic:    "meter/power",
+			payloads: []string{"100", "100", "100.0", "101"},
+			want:     "100,100.0,101",
+		},
+		{
+			name:     "number with deadband",
+			opts:     []ThrottleOption{WithDeadband(5)},
+			topic:    "meter/power",
+			payloads: []string{"100", "104", "105", "106", "95", "94"},
+			want:     "100,106,95",
+		},
+		{
+			name:     "topic deadband",
+			opts:     []ThrottleOption{WithDeadband(100), WithTopicDeadband("meter/+", 1)},
+			topic:    "meter/power",
+			payloads: []string{"100", "100.5", "102"},
+			want:     "100,102",
+		},
+		{
+			name:     "other topic deadband",
+			opts:     []ThrottleOption{WithDeadband(100), WithTopicDeadband("boiler/#", 1)},
+			topic:    "meter/power",
+			payloads: []string{"100", "102", "250"},
+			want:     "100,250",
+		},
+		{
+			name:  "record",
+			opts:  []ThrottleOption{WithDeadband(1), WithFieldDeadband("power", 10)},
+			topic: "meter",
+			payloads: []string{
+				`{"power":100,"energy":5.0,"state":"on"}`,
+				`{"state":"on","energy":5.5,"power":109}`,
+				`{"power":100,"energy":6.1,"state":"on"}`,
+				`{"power":100,"energy":6.1,"state":"off"}`,
+				`{"power":100,"energy":6.1}`,
+				`{"power":111,"energy":6.1}`,
+			},
+			want: `{"power":100,"energy":5.0,"state":"on"}` + "," +
+				`{"power":100,"energy":6.1,"state":"on"}` + "," +
+				`{"power":100,"energy":6.1,"state":"off"}` + "," +
+				`{"power":100,"energy":6.1}` + "," +
+				`{"power":111,"energy":6.1}`,
+		},
+		{
+			name:     "payload type changes",
+			opts:     []ThrottleOption{WithDeadband(1)},
+			topic:    "meter",
+			payloads: []string{`{"power":1}`, `1`, `1.5`, `{"power":1}`},
+			want:     `{"power":1},1,{"power":1}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &fakePublisher{}
+			p := NewThrottledPublisher(next, tt.opts...)
+			for _, payload := range tt.payloads {
+				if err := p.Publish(Message{Topic: tt.topic, Payload: []byte(payload)}); err != nil {
+					t.Fatalf("Publish() error = %v", err)
+				}
+			}
+			if got := strings.Join(next.payloads(), ","); got != tt.want {
+				t.Errorf("published %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThrottledPublisherMaxInterval(t *testing.T) {
+	next := &fakePublisher{}
+	p := NewThrottledPublisher(next, WithMaxInterval(50*time.Millisecond))
+
+	publish := func(topic, payload string) {
+		t.Helper()
+		if err := p.Publish(Message{Topic: topic, Payload: []byte(payload)}); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	publish("a", "1")
+	publish("b", "2")
+	publish("a", "1")
+	time.Sleep(60 * time.Millisecond)
+	publish("a", "1")
+	publish("a", "1")
+	if got, want := strings.Join(next.payloads(), ","), "1,2,1"; got != want {
+		t.Errorf("published %s, want %s", got, want)
+	}
+
+	// a failed message is published again
+	next.err = ErrTimeout
+	if err := p.Publish(Message{Topic: "c", Payload: []byte("3")}); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Publish() error = %v, want %v", err, ErrTimeout)
+	}
+	next.err = nil
+	publish("c", "3")
+	if got, want := strings.Join(next.payloads(), ","), "1,2,1,3"; got != want {
+		t.Errorf("published %s, want %s", got, want)
+	}
+}